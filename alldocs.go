@@ -0,0 +1,98 @@
+package couch
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// AllDocsOptions select the rows returned by AllDocs(), see
+// http://docs.couchdb.org/en/latest/api/database/bulk-api.html#db-all-docs
+type AllDocsOptions struct {
+	Keys        []string // Only these ids, in this order, ignores StartKey and EndKey
+	StartKey    string   // Start at this id, empty for the first one
+	EndKey      string   // Stop at this id (inclusive), empty for the last one
+	Limit       int      // Maximum number of rows, 0 for all
+	Skip        int      // Number of rows to skip
+	Descending  bool     // Return rows in descending order of ids, StartKey must then be the higher id
+	IncludeDocs bool     // Include the documents in the rows, implied if AllDocs() decodes them
+}
+
+// Parameters of an _all_docs request, keys are sent in the body
+func (o *AllDocsOptions) params() map[string]interface{} {
+	params := make(map[string]interface{})
+	if o == nil {
+		return params
+	}
+	if o.Keys == nil {
+		if o.StartKey != "" {
+			key, _ := json.Marshal(o.StartKey)
+			params["startkey"] = string(key)
+		}
+		if o.EndKey != "" {
+			key, _ := json.Marshal(o.EndKey)
+			params["endkey"] = string(key)
+		}
+	}
+	if o.Limit > 0 {
+		params["limit"] = o.Limit
+	}
+	if o.Skip > 0 {
+		params["skip"] = o.Skip
+	}
+	if o.Descending {
+		params["descending"] = true
+	}
+	if o.IncludeDocs {
+		params["include_docs"] = true
+	}
+	return params
+}
+
+// AllDocs queries all documents of a database by id. If docs, a pointer to a slice, isn't nil,
+// the documents are included and decoded into it with the codec of the database, skipping rows
+// without a document like deleted or missing ones:
+//
+//	var people []Person
+//	result, err := db.AllDocs(&couch.AllDocsOptions{StartKey: "person:", Limit: 50}, &people)
+//
+// Page through a database by passing the id of the last row as StartKey and a Skip of 1.
+// With Keys, every key gets a row in the same order, see ViewResultRow.Error.
+func (db *Database) AllDocs(options *AllDocsOptions, docs interface{}, opts ...Option) (*ViewResult, error) {
+	var o AllDocsOptions
+	if options != nil {
+		o = *options
+	}
+	for _, id := range o.Keys {
+		if err := validateDocID(id); err != nil {
+			return nil, err
+		}
+	}
+	if docs != nil {
+		o.IncludeDocs = true
+	}
+	start := time.Now()
+	params := o.params()
+	result := &ViewResult{codec: db.Codec()}
+	url := db.URL() + "/_all_docs" + urlEncode(params)
+	opts = withOptions(db.server.withDefaults(opts), decodeWith(db.Codec()))
+	var resp *http.Response
+	var err error
+	if o.Keys != nil {
+		body := map[string]interface{}{"keys": o.Keys}
+		resp, err = do(url, "POST", db.Cred(), body, result, opts)
+		db.recordQuery("all_docs", "keys", body, len(result.Rows), resp, err, start)
+	} else {
+		resp, err = do(url, "GET", db.Cred(), nil, result, opts)
+		db.recordQuery("all_docs", "", params, len(result.Rows), resp, err, start)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if docs != nil {
+		if err = result.decodeDocs(docs, db.Codec()); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
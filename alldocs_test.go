@@ -0,0 +1,55 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestAllDocs(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Method == "POST" {
+			var body struct{ Keys []string }
+			json.NewDecoder(r.Body).Decode(&body)
+			if len(body.Keys) != 2 || q.Get("startkey") != "" {
+				t.Error("Keys should be sent in the body instead of a range, got", body, q)
+			}
+			w.Write([]byte(`{"total_rows": 3, "rows": [
+				{"key": "bert", "id": "bert", "value": {"rev": "1-b"}},
+				{"key": "nobody", "error": "not_found"}
+			]}`))
+			return
+		}
+		if q.Get("startkey") != `"anna"` || q.Get("limit") != "2" || q.Get("skip") != "1" || q.Get("include_docs") != "true" {
+			t.Error("Unexpected parameters", q)
+		}
+		w.Write([]byte(`{"total_rows": 3, "offset": 1, "rows": [
+			{"key": "bert", "id": "bert", "value": {"rev": "1-b"}, "doc": {"_id": "bert", "_rev": "1-b", "Name": "Bert"}},
+			{"key": "carl", "id": "carl", "value": {"rev": "1-c"}, "doc": {"_id": "carl", "_rev": "1-c", "Name": "Carl"}}
+		]}`))
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	var people []Person
+	result, err := db.AllDocs(&couch.AllDocsOptions{StartKey: "anna", Skip: 1, Limit: 2}, &people)
+	if err != nil {
+		t.Fatal("Querying all documents returned error:", err)
+	}
+	if result.TotalRows != 3 || result.Offset != 1 || len(people) != 2 || people[1].Name != "Carl" {
+		t.Error("Unexpected result", result, people)
+	}
+
+	result, err = db.AllDocs(&couch.AllDocsOptions{Keys: []string{"bert", "nobody"}, StartKey: "x"}, nil)
+	if err != nil {
+		t.Fatal("Querying documents by keys returned error:", err)
+	}
+	if len(result.Rows) != 2 || result.Rows[0].ID != "bert" || result.Rows[1].Error != "not_found" {
+		t.Error("Every key should get a row, got", result.Rows)
+	}
+}
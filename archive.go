@@ -0,0 +1,125 @@
+package couch
+
+import "encoding/json"
+
+// Response of _bulk_get, every result holds the requested revision or an error
+type bulkGetResult struct {
+	Results []struct {
+		ID   string `json:"id"`
+		Docs []struct {
+			OK    json.RawMessage `json:"ok"`
+			Error *couchError     `json:"error"`
+		} `json:"docs"`
+	} `json:"results"`
+}
+
+// ArchiveMatching moves all documents matching a Mango selector to an archive database, e.g. to
+// apply a retention policy. Documents are copied with their attachments and revision ids, then
+// removed from the database, but only once the archive is verified to hold their current revision.
+// With purge enabled they are purged instead of deleted, leaving no tombstones behind, see Purge().
+// Written counts the archived documents, documents edited during the operation are left alone and
+// counted as failed. An error is only returned if a request fails, documents archived up to that
+// point stay archived.
+func (db *Database) ArchiveMatching(selector map[string]interface{}, archive *Database, purge bool, opts ...Option) (*MatchResult, error) {
+	o := newCallOptions(opts)
+	result := &MatchResult{}
+	err := db.eachMatchPage(selector, []string{"_id", "_rev"}, func(docs []DynamicDoc) error {
+		result.Matched += len(docs)
+		archived, err := db.archiveBatch(docs, archive, opts)
+		if err != nil {
+			return err
+		}
+		removed, err := db.removeArchived(archived, purge, opts)
+		if err != nil {
+			return err
+		}
+		result.Written += removed
+		result.Failed += len(docs) - removed
+		o.reportProgress(*result)
+		return nil
+	}, opts)
+	if purge {
+		db.refreshConflictsViewIfExists()
+	}
+	return result, err
+}
+
+// Copy documents with attachments and revision history to the archive, returns the revision
+// ids by document id of the documents the archive verifiably holds
+func (db *Database) archiveBatch(docs []DynamicDoc, archive *Database, opts []Option) (map[string]string, error) {
+	var get bulkGetResult
+	var refs []map[string]string
+	for _, doc := range docs {
+		id, rev := doc.IDRev()
+		refs = append(refs, map[string]string{"id": id, "rev": rev})
+	}
+	url := db.URL() + "/_bulk_get" + urlEncode(map[string]interface{}{"revs": true, "attachments": true})
+	_, err := do(url, "POST", db.Cred(), map[string]interface{}{"docs": refs}, &get, db.server.withDefaults(opts))
+	if err != nil {
+		return nil, err
+	}
+	var copies []json.RawMessage
+	for _, r := range get.Results {
+		for _, d := range r.Docs {
+			if d.Error == nil && len(d.OK) > 0 {
+				copies = append(copies, d.OK)
+			}
+		}
+	}
+	if len(copies) == 0 {
+		return nil, nil
+	}
+
+	// Keep revision ids so that the copies can be verified
+	body := map[string]interface{}{"docs": copies, "new_edits": false}
+	if _, err = do(archive.URL()+"/_bulk_docs", "POST", archive.Cred(), body, nil, archive.server.withDefaults(opts)); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(docs))
+	expected := make(map[string]string, len(docs))
+	for i, doc := range docs {
+		id, rev := doc.IDRev()
+		ids[i], expected[id] = id, rev
+	}
+	rows, err := archive.allDocsByKeys(ids, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	archived := make(map[string]string)
+	for _, row := range rows {
+		if row.Error == "" && !row.Value.Deleted && row.Value.Rev == expected[row.Key] {
+			archived[row.Key] = row.Value.Rev
+		}
+	}
+	return archived, nil
+}
+
+// Delete or purge archived documents, returns how many have been removed
+func (db *Database) removeArchived(archived map[string]string, purge bool, opts []Option) (int, error) {
+	if len(archived) == 0 {
+		return 0, nil
+	}
+	if purge {
+		revs := make(map[string][]string, len(archived))
+		for id, rev := range archived {
+			revs[id] = []string{rev}
+		}
+		purged, err := db.purge(revs, opts)
+		if err != nil {
+			return 0, err
+		}
+		return len(purged), nil
+	}
+	bulk := new(Bulk)
+	for id, rev := range archived {
+		tombstone := DynamicDoc{}
+		tombstone.SetIDRev(id, rev)
+		tombstone.MarkDeleted()
+		bulk.Add(tombstone)
+	}
+	var result MatchResult
+	if err := db.writeBatch(bulk, &result, opts); err != nil {
+		return 0, err
+	}
+	return result.Written, nil
+}
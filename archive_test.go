@@ -0,0 +1,103 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestIntegrationArchiveMatching(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+	archive := server().Database(testReplDB)
+	if archive.Exists() {
+		archive.DropDatabase()
+	}
+	if err := archive.Create(); err != nil {
+		t.Fatal("Creating archive returned error:", err)
+	}
+	defer archive.DropDatabase()
+
+	old := &Person{Name: "Peter", Height: 185}
+	insertTestDoc(old, db, t)
+	insertTestDoc(&Person{Name: "Anna", Height: 170}, db, t)
+	selector := map[string]interface{}{"Name": "Peter"}
+
+	result, err := db.ArchiveMatching(selector, archive, true)
+	if err != nil {
+		t.Fatal("Archiving documents returned error:", err)
+	}
+	if *result != (couch.MatchResult{Matched: 1, Written: 1}) {
+		t.Error("One document should be archived, got", result)
+	}
+	archived := new(Person)
+	if err = archive.Retrieve(old.ID, archived); err != nil || archived.Rev != old.Rev || archived.Name != "Peter" {
+		t.Error("Archive should hold the document with its revision, got", archived, err)
+	}
+	info, _ := db.Info()
+	if info.DocCount != 1 || info.DocDelCount != 0 {
+		t.Error("Purged document should leave no tombstone, got", info)
+	}
+}
+
+func TestArchiveMatchingVerifiesCopies(t *testing.T) {
+	t.Parallel()
+	var deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/people/_find":
+			var q couch.FindQuery
+			json.NewDecoder(r.Body).Decode(&q)
+			if q.Bookmark != "" {
+				w.Write([]byte(`{"docs": []}`))
+				return
+			}
+			w.Write([]byte(`{"docs": [{"_id": "doc1", "_rev": "1-a"}, {"_id": "doc2", "_rev": "1-a"}], "bookmark": "b1"}`))
+		case "/people/_bulk_get":
+			w.Write([]byte(`{"results": [
+				{"id": "doc1", "docs": [{"ok": {"_id": "doc1", "_rev": "1-a", "_attachments": {"a.txt": {"data": "aGk="}}}}]},
+				{"id": "doc2", "docs": [{"ok": {"_id": "doc2", "_rev": "1-a"}}]}]}`))
+		case "/archive/_bulk_docs":
+			var body struct {
+				NewEdits bool `json:"new_edits"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.NewEdits {
+				t.Error("Copies should keep their revision ids")
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`[]`))
+		case "/archive/_all_docs":
+			// doc2 has been edited in the archive in the meantime
+			w.Write([]byte(`{"rows": [{"id": "doc1", "key": "doc1", "value": {"rev": "1-a"}}, {"id": "doc2", "key": "doc2", "value": {"rev": "2-x"}}]}`))
+		case "/people/_bulk_docs":
+			var body struct {
+				Docs []map[string]interface{}
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, doc := range body.Docs {
+				deleted = append(deleted, doc["_id"].(string))
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`[{"id": "doc1", "rev": "2-b", "ok": true}]`))
+		default:
+			t.Error("Unexpected request", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	result, err := s.Database("people").ArchiveMatching(map[string]interface{}{}, s.Database("archive"), false)
+	if err != nil {
+		t.Fatal("Archiving documents returned error:", err)
+	}
+	if *result != (couch.MatchResult{Matched: 2, Written: 1, Failed: 1}) {
+		t.Error("Unexpected counts", result)
+	}
+	if len(deleted) != 1 || deleted[0] != "doc1" {
+		t.Error("Only the verified copy should be deleted, deleted", deleted)
+	}
+}
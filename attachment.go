@@ -0,0 +1,140 @@
+package couch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Attachment describes an attachment returned by GetAttachment() or Attachments().
+type Attachment struct {
+	Name        string
+	ContentType string
+	Length      int64  // -1 if CouchDB didn't send a length, e.g. for compressed attachments
+	Digest      string // Digest as stored by CouchDB, e.g. "md5-..."
+}
+
+// Stub of an attachment in the _attachments of a document
+type attachmentStub struct {
+	ContentType string `json:"content_type"`
+	Length      int64  `json:"length"`
+	Digest      string `json:"digest"`
+}
+
+// Attachments lists the attachments of the latest revision of a document, sorted by name,
+// without downloading their content.
+func (db *Database) Attachments(docID string, opts ...Option) ([]Attachment, error) {
+	var doc struct {
+		Attachments map[string]attachmentStub `json:"_attachments"`
+	}
+	if err := db.retrieve(docID, "", &doc, nil, opts); err != nil {
+		return nil, err
+	}
+	atts := make([]Attachment, 0, len(doc.Attachments))
+	for name, stub := range doc.Attachments {
+		atts = append(atts, Attachment{Name: name, ContentType: stub.ContentType, Length: stub.Length, Digest: stub.Digest})
+	}
+	sort.Slice(atts, func(i, j int) bool { return atts[i].Name < atts[j].Name })
+	return atts, nil
+}
+
+// PutAttachment adds or replaces an attachment of a document and returns the new revision id
+// of the document. The content is streamed from r to CouchDB. Pass an empty rev to create a
+// new document holding only the attachment.
+func (db *Database) PutAttachment(docID, rev, name, contentType string, r io.Reader, opts ...Option) (string, error) {
+	if err := validateDocID(docID); err != nil {
+		return "", err
+	}
+	if err := db.checkQuota([]Identifiable{&Doc{ID: docID}}, opts); err != nil {
+		return "", err
+	}
+	var result insertResult
+	body := &rawBody{r: r, contentType: contentType}
+	if _, err := do(db.attachmentURL(docID, rev, name), "PUT", db.Cred(), body, &result, db.server.withDefaults(opts)); err != nil {
+		return "", err
+	}
+	return result.Rev, nil
+}
+
+// GetAttachment returns the content of an attachment of the latest revision of a document,
+// which has to be closed by the caller. If the document or the attachment doesn't exist,
+// an error matching ErrNotFound is returned.
+func (db *Database) GetAttachment(docID, name string, opts ...Option) (io.ReadCloser, *Attachment, error) {
+	if err := validateDocID(docID); err != nil {
+		return nil, nil, err
+	}
+	var content io.ReadCloser
+	resp, err := do(db.attachmentURL(docID, "", name), "GET", db.Cred(), nil, &content, db.server.withDefaults(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	att := &Attachment{
+		Name:        name,
+		ContentType: resp.Header.Get("Content-Type"),
+		Length:      resp.ContentLength,
+		Digest:      strings.Trim(resp.Header.Get("ETag"), `"`),
+	}
+	if att.Digest != "" && !strings.Contains(att.Digest, "-") {
+		att.Digest = "md5-" + att.Digest
+	}
+	return content, att, nil
+}
+
+// DeleteAttachment removes an attachment from a document and returns the new revision id of the document.
+func (db *Database) DeleteAttachment(docID, rev, name string, opts ...Option) (string, error) {
+	if err := validateDocID(docID); err != nil {
+		return "", err
+	}
+	var result insertResult
+	if _, err := do(db.attachmentURL(docID, rev, name), "DELETE", db.Cred(), nil, &result, db.server.withDefaults(opts)); err != nil {
+		return "", err
+	}
+	return result.Rev, nil
+}
+
+// Url of an attachment, names may contain slashes but every segment is escaped
+func (db *Database) attachmentURL(docID, rev, name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	u := db.docURL(docID) + "/" + strings.Join(segments, "/")
+	if rev != "" {
+		u += "?rev=" + url.QueryEscape(rev)
+	}
+	return u
+}
+
+// Request body that is sent as it is instead of being encoded as json
+type rawBody struct {
+	r           io.Reader
+	contentType string
+}
+
+// Set the body of req, the length is known for readers like *bytes.Reader
+func (b *rawBody) attach(req *http.Request) {
+	tmp, _ := http.NewRequest(req.Method, req.URL.String(), b.r)
+	req.Body, req.ContentLength, req.GetBody = tmp.Body, tmp.ContentLength, tmp.GetBody
+	if b.contentType != "" {
+		req.Header.Set("Content-Type", b.contentType)
+	} else {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+}
+
+// Response body streamed to the caller, the request is cancelled once it is closed
+type streamBody struct {
+	io.ReadCloser
+	cancels []context.CancelFunc
+}
+
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	for _, cancel := range b.cancels {
+		cancel()
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package couch_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestAttachments(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	stored := make(map[string]string)
+	types := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case "PUT":
+			if r.URL.Query().Get("rev") != "1-a" {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"error": "conflict", "reason": "Document update conflict."}`))
+				return
+			}
+			data, _ := ioutil.ReadAll(r.Body)
+			stored[r.URL.EscapedPath()], types[r.URL.EscapedPath()] = string(data), r.Header.Get("Content-Type")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok": true, "id": "doc", "rev": "2-b"}`))
+		case "GET":
+			data, ok := stored[r.URL.EscapedPath()]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error": "not_found", "reason": "Document is missing attachment"}`))
+				return
+			}
+			w.Header().Set("Content-Type", types[r.URL.EscapedPath()])
+			w.Header().Set("ETag", `"rL0Y20zC+Fzt72VPzMSk2A=="`)
+			w.Write([]byte(data))
+		case "DELETE":
+			delete(stored, r.URL.EscapedPath())
+			w.Write([]byte(`{"ok": true, "id": "doc", "rev": "3-c"}`))
+		}
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	rev, err := db.PutAttachment("doc", "1-a", "notes/a b.txt", "text/plain", strings.NewReader("hello"))
+	if err != nil || rev != "2-b" {
+		t.Fatal("Putting an attachment should return the new revision, got", rev, err)
+	}
+	if _, ok := stored["/db/doc/notes/a%20b.txt"]; !ok {
+		t.Error("Attachment name should be escaped, stored are", stored)
+	}
+	if _, err = db.PutAttachment("doc", "0-x", "a.txt", "text/plain", strings.NewReader("hello")); !errors.Is(err, couch.ErrConflict) {
+		t.Error("Putting an attachment with an old revision should conflict, got", err)
+	}
+
+	content, att, err := db.GetAttachment("doc", "notes/a b.txt")
+	if err != nil {
+		t.Fatal("Getting an attachment returned error:", err)
+	}
+	data, _ := ioutil.ReadAll(content)
+	content.Close()
+	if string(data) != "hello" || att.ContentType != "text/plain" || att.Length != 5 || att.Digest != "md5-rL0Y20zC+Fzt72VPzMSk2A==" {
+		t.Error("Unexpected attachment", string(data), att)
+	}
+
+	if rev, err = db.DeleteAttachment("doc", "2-b", "notes/a b.txt"); err != nil || rev != "3-c" {
+		t.Error("Deleting an attachment should return the new revision, got", rev, err)
+	}
+	if _, _, err = db.GetAttachment("doc", "notes/a b.txt"); !errors.Is(err, couch.ErrNotFound) {
+		t.Error("Getting a deleted attachment should fail with ErrNotFound, got", err)
+	}
+}
+
+func TestAttachmentsList(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/doc" || r.URL.Query().Get("attachments") != "" {
+			t.Error("Unexpected request", r.URL)
+		}
+		w.Write([]byte(`{"_id": "doc", "_rev": "2-b", "_attachments": {
+			"photo.jpg": {"content_type": "image/jpeg", "revpos": 2, "digest": "md5-abc", "length": 2048, "stub": true},
+			"notes.txt": {"content_type": "text/plain", "revpos": 1, "digest": "md5-def", "length": 5, "stub": true}
+		}}`))
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	atts, err := db.Attachments("doc")
+	if err != nil {
+		t.Fatal("Listing attachments returned error:", err)
+	}
+	if len(atts) != 2 || atts[0].Name != "notes.txt" || atts[1].ContentType != "image/jpeg" || atts[1].Length != 2048 || atts[1].Digest != "md5-abc" {
+		t.Error("Unexpected attachments", atts)
+	}
+}
@@ -0,0 +1,27 @@
+package couch
+
+import "strconv"
+
+// AttachmentSizeFilter is a filter function passing documents depending on the size of their
+// attachments, e.g. to keep large attachments away from mobile replicas. Deploy it to the source
+// of a replication with SetFilter() and use it with WithAttachmentSizeFilter(). Deletions
+// always pass.
+const AttachmentSizeFilter = `function(doc, req) {
+  if (doc._deleted) { return true; }
+  var threshold = Number(req.query.threshold), large = false;
+  for (var name in doc._attachments || {}) {
+    if (doc._attachments[name].length > threshold) { large = true; }
+  }
+  return req.query.large === "true" ? large : !large;
+}`
+
+// WithAttachmentSizeFilter makes a replication filter documents with AttachmentSizeFilter, which
+// has to be deployed as filter, e.g. "replication/attachment_size". Documents with an attachment
+// larger than threshold bytes are only copied if large is set, all others only if it isn't.
+// Calls other than replications ignore it.
+func WithAttachmentSizeFilter(filter string, threshold int64, large bool) Option {
+	return WithFilter(filter, map[string]string{
+		"threshold": strconv.FormatInt(threshold, 10),
+		"large":     strconv.FormatBool(large),
+	})
+}
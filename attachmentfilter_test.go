@@ -0,0 +1,64 @@
+package couch_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestWithAttachmentSizeFilter(t *testing.T) {
+	t.Parallel()
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	_, err := s.Database("a").ReplicateTo(s.Database("b"), false, couch.WithAttachmentSizeFilter("replication/attachment_size", 1024, false))
+	if err != nil {
+		t.Fatal("Replication returned error:", err)
+	}
+	expected := map[string]interface{}{"threshold": "1024", "large": "false"}
+	if body["filter"] != "replication/attachment_size" || !reflect.DeepEqual(body["query_params"], expected) {
+		t.Error("Replication should use the filter with its parameters, got", body)
+	}
+}
+
+func TestIntegrationAttachmentSizeFilter(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	if err := db.SetFilter("replication", "attachment_size", couch.AttachmentSizeFilter); err != nil {
+		t.Fatal("Setting filter returned error:", err)
+	}
+	attachment := func(size int) couch.DynamicDoc {
+		data := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", size)))
+		return couch.DynamicDoc{"_attachments": map[string]interface{}{
+			"file": map[string]interface{}{"content_type": "text/plain", "data": data},
+		}}
+	}
+	small, large := attachment(10), attachment(2000)
+	insertTestDoc(small, db, t)
+	insertTestDoc(large, db, t)
+
+	options := &couch.ChangesOptions{
+		Filter:      "replication/attachment_size",
+		QueryParams: map[string]string{"threshold": "1024", "large": "false"},
+	}
+	result, err := db.Changes(options)
+	if err != nil {
+		t.Fatal("Reading filtered changes returned error:", err)
+	}
+	smallID, _ := small.IDRev()
+	if len(result.Results) != 1 || result.Results[0].ID != smallID {
+		t.Error("Only the document with a small attachment should pass, got", result.Results)
+	}
+}
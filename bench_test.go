@@ -0,0 +1,80 @@
+package couch_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Server answering every request with the same canned response, so that
+// benchmarks measure the client only
+func benchServer(b *testing.B, response string) *couch.Database {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	b.Cleanup(ts.Close)
+	return couch.NewServer(ts.URL, nil).Database("bench")
+}
+
+func BenchmarkInsert(b *testing.B) {
+	db := benchServer(b, `{"ok":true,"id":"peter","rev":"1-abc"}`)
+	doc := &Person{Name: "Peter", Height: 185, Alive: true}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		doc.ID = ""
+		if err := db.Insert(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRetrieve(b *testing.B) {
+	db := benchServer(b, `{"_id":"peter","_rev":"1-abc","Name":"Peter","Height":185,"Alive":true}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.Retrieve("peter", new(Person)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsertBulk(b *testing.B) {
+	results := make([]string, 100)
+	for i := range results {
+		results[i] = fmt.Sprintf(`{"ok":true,"id":"%d","rev":"1-abc"}`, i)
+	}
+	db := benchServer(b, "["+strings.Join(results, ",")+"]")
+	bulk := new(couch.Bulk)
+	for i := 0; i < 100; i++ {
+		bulk.Add(&Person{Name: "Peter", Height: 185})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.InsertBulk(bulk, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	rows := make([]string, 1000)
+	for i := range rows {
+		rows[i] = fmt.Sprintf(`{"id":"%d","key":"Peter %d","value":%d}`, i, i, i)
+	}
+	db := benchServer(b, `{"total_rows":1000,"offset":0,"rows":[`+strings.Join(rows, ",")+`]}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.Query("app", "by_name", nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
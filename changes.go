@@ -0,0 +1,140 @@
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// SinceNow makes a changes feed start at the current end of the database, so that only
+// later changes are reported. It saves asking for the current sequence with Info() first.
+const SinceNow Seq = "now"
+
+// FeedMode selects how CouchDB delivers changes, see StreamChanges().
+type FeedMode string
+
+// Modes of a changes feed
+const (
+	FeedNormal     FeedMode = "normal"     // Return the changes so far and stop
+	FeedLongpoll   FeedMode = "longpoll"   // Wait for the next changes, request again after every batch
+	FeedContinuous FeedMode = "continuous" // Keep a connection open and receive changes as they happen
+)
+
+// ChangesOptions select the changes returned by Changes(), see
+// http://docs.couchdb.org/en/latest/api/database/changes.html
+type ChangesOptions struct {
+	Since       Seq    // Start after this sequence, SinceNow or empty for the beginning
+	Limit       int    // Maximum number of changes, 0 for all
+	IncludeDocs bool   // Include the documents in the changes
+	Conflicts   bool   // Include the revision ids of conflicts in _conflicts of the documents, needs IncludeDocs
+	Filter      string // Filter function as "design/filter", see SetFilter()
+	// QueryParams are passed to the filter function in req.query. They are sent along with
+	// the other parameters of the request, so they must not be named like one of them.
+	QueryParams map[string]string
+	// SeqInterval makes CouchDB 2.x and later compute the sequence only for every n-th change,
+	// which is considerably faster for large batches. The sequence of the other changes is empty,
+	// use LastSeq of the result to continue a feed.
+	SeqInterval int
+	// Feed is the mode of StreamChanges(), FeedNormal by default. Changes() only supports
+	// FeedNormal and FeedLongpoll.
+	Feed FeedMode
+	// Heartbeat makes CouchDB send an empty line every interval while there are no changes,
+	// which keeps proxies from closing an idle continuous feed.
+	Heartbeat time.Duration
+	// Timeout makes CouchDB end a longpoll or continuous request after waiting that long for
+	// changes, StreamChanges() then requests again.
+	Timeout time.Duration
+}
+
+// Parameters of a changes request
+func (o *ChangesOptions) params() map[string]interface{} {
+	params := make(map[string]interface{})
+	if o == nil {
+		return params
+	}
+	if o.Since != "" {
+		params["since"] = string(o.Since)
+	}
+	if o.Limit > 0 {
+		params["limit"] = o.Limit
+	}
+	if o.IncludeDocs {
+		params["include_docs"] = true
+	}
+	if o.Conflicts {
+		params["conflicts"] = true
+	}
+	if o.Filter != "" {
+		params["filter"] = o.Filter
+	}
+	if o.SeqInterval > 0 {
+		params["seq_interval"] = o.SeqInterval
+	}
+	if o.Feed != "" && o.Feed != FeedNormal {
+		params["feed"] = string(o.Feed)
+	}
+	if o.Heartbeat > 0 {
+		params["heartbeat"] = o.Heartbeat.Milliseconds()
+	}
+	if o.Timeout > 0 {
+		params["timeout"] = o.Timeout.Milliseconds()
+	}
+	for k, v := range o.QueryParams {
+		if _, reserved := params[k]; !reserved {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// ChangeEvent is a change of a document. Doc is only set if the changes are requested with IncludeDocs.
+type ChangeEvent struct {
+	ID      string          `json:"id"`
+	Seq     Seq             `json:"seq"`
+	Deleted bool            `json:"deleted,omitempty"`
+	Changes []ChangeRev     `json:"changes"`
+	Doc     json.RawMessage `json:"doc,omitempty"`
+}
+
+// ChangeRev is a leaf revision of a changed document.
+type ChangeRev struct {
+	Rev string `json:"rev"`
+}
+
+// ChangesResult holds a batch of changes. Pass LastSeq as Since to get the next batch.
+type ChangesResult struct {
+	Results []ChangeEvent `json:"results"`
+	LastSeq Seq           `json:"last_seq"`
+	Pending int64         `json:"pending"`
+}
+
+// Changes returns the changes of a database, in the order they happened.
+// Use StreamChanges() for a continuous feed.
+func (db *Database) Changes(options *ChangesOptions, opts ...Option) (*ChangesResult, error) {
+	if options != nil && options.Feed == FeedContinuous {
+		return nil, errors.New("couch: continuous changes feed needs StreamChanges()")
+	}
+	result := &ChangesResult{}
+	url := db.URL() + "/_changes" + urlEncode(options.params())
+	if _, err := do(url, "GET", db.Cred(), nil, result, db.server.withDefaults(opts)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Ids of the documents changed after a sequence, each one once
+func (db *Database) changedDocIDs(since Seq, opts []Option) ([]string, error) {
+	result, err := db.Changes(&ChangesOptions{Since: since}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(result.Results))
+	var ids []string
+	for _, r := range result.Results {
+		if !seen[r.ID] {
+			seen[r.ID] = true
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids, nil
+}
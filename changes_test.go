@@ -0,0 +1,52 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestChangesOptions(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("since") != "now" || q.Get("seq_interval") != "100" || q.Get("limit") != "10" {
+			t.Error("Options should be passed as parameters, got", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"results": [{"id": "anna", "seq": null, "changes": [{"rev": "1-a"}]}], "last_seq": "12-abc", "pending": 0}`))
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	result, err := db.Changes(&couch.ChangesOptions{Since: couch.SinceNow, Limit: 10, SeqInterval: 100})
+	if err != nil {
+		t.Fatal("Reading changes returned error:", err)
+	}
+	if len(result.Results) != 1 || result.Results[0].Seq != "" || result.Results[0].Changes[0].Rev != "1-a" {
+		t.Error("Changes without sequence should be decoded, got", result.Results)
+	}
+	if result.LastSeq != "12-abc" {
+		t.Error("Last sequence should be decoded, got", result.LastSeq)
+	}
+}
+
+func TestIntegrationChanges(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	now, err := db.Changes(&couch.ChangesOptions{Since: couch.SinceNow})
+	if err != nil {
+		t.Fatal("Reading changes returned error:", err)
+	}
+	peter := &Person{Name: "Peter"}
+	insertTestDoc(peter, db, t)
+	result, err := db.Changes(&couch.ChangesOptions{Since: now.LastSeq, IncludeDocs: true})
+	if err != nil {
+		t.Fatal("Reading changes returned error:", err)
+	}
+	if len(result.Results) != 1 || result.Results[0].ID != peter.ID || len(result.Results[0].Doc) == 0 {
+		t.Error("Changes since now should only contain the new document, got", result.Results)
+	}
+}
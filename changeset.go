@@ -0,0 +1,188 @@
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ChangeSet records changes to several documents and writes them in a single
+// _bulk_docs request. It emulates a transaction on the client side:
+//
+//	cs := db.ChangeSet()
+//	cs.Put(invoice)
+//	cs.Put(account)
+//	cs.Delete(draft.ID, draft.Rev)
+//	err := cs.Commit()
+//
+// Commit() first checks that every recorded revision id is still the latest one, if not,
+// nothing is written. It then submits all changes at once. CouchDB writes each
+// document independently, so if some of them fail, Commit() tries to roll back the ones
+// that succeeded by writing compensating revisions: new documents are deleted, edited ones
+// get their previous content back and deleted ones are restored. This is best-effort only.
+// Other clients can observe the intermediate state and a rollback can itself fail, in which
+// case ChangeSetError.RollbackErr is set.
+type ChangeSet struct {
+	db      *Database
+	changes []change
+}
+
+// A single recorded change
+type change struct {
+	doc Identifiable
+}
+
+// ChangeSet returns an empty change set for the database.
+func (db *Database) ChangeSet() *ChangeSet {
+	return &ChangeSet{db: db}
+}
+
+// Put records an insert or edit of a document. As with Insert(), a document without
+// an id will be created, otherwise its revision id has to be the latest one.
+func (cs *ChangeSet) Put(doc Identifiable) {
+	cs.changes = append(cs.changes, change{doc: doc})
+}
+
+// Delete records the deletion of a document.
+func (cs *ChangeSet) Delete(docID, revID string) {
+	doc := DynamicDoc{"_deleted": true}
+	doc.SetIDRev(docID, revID)
+	cs.changes = append(cs.changes, change{doc: doc})
+}
+
+// Len returns the number of recorded changes.
+func (cs *ChangeSet) Len() int {
+	return len(cs.changes)
+}
+
+// ChangeSetError describes why a commit failed. Failed holds the error of every document
+// that couldn't be written, keyed by document id. RollbackErr is set if compensating
+// already applied changes didn't work out.
+type ChangeSetError struct {
+	Failed      map[string]error
+	RollbackErr error
+}
+
+// Error implements the error interface.
+func (e *ChangeSetError) Error() string {
+	var ids []string
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	msg := "couch: change set failed for " + strings.Join(ids, ", ")
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(", rollback incomplete: %v", e.RollbackErr)
+	}
+	return msg
+}
+
+// Commit validates and writes all recorded changes, see ChangeSet for the semantics.
+// On success, all documents carry their new revision ids and the change set is emptied.
+// After a rollback, the revision ids of the documents are outdated, retrieve them again.
+func (cs *ChangeSet) Commit(opts ...Option) error {
+	if len(cs.changes) == 0 {
+		return nil
+	}
+	originals, err := cs.validate(opts)
+	if err != nil {
+		return err
+	}
+
+	bulk := new(Bulk)
+	for _, c := range cs.changes {
+		bulk.Add(c.doc)
+	}
+	results, err := cs.db.insertBulk(bulk, false, opts)
+	if err != nil {
+		return err
+	}
+
+	failed := make(map[string]error)
+	for i, result := range results {
+		if !result.Ok {
+			id, _ := cs.changes[i].doc.IDRev()
+			failed[id] = result.err()
+		}
+	}
+	if len(failed) == 0 {
+		cs.changes = nil
+		return nil
+	}
+	return &ChangeSetError{Failed: failed, RollbackErr: cs.rollback(results, originals, opts)}
+}
+
+// Check that all revision ids are the latest ones. Returns the latest stored
+// revision of every existing document, keyed by document id, to be able to roll back.
+// Deleted documents are treated like documents that never existed.
+func (cs *ChangeSet) validate(opts []Option) (map[string]allDocsRow, error) {
+	var ids []string
+	for _, c := range cs.changes {
+		if id, _ := c.doc.IDRev(); id != "" {
+			if err := validateDocID(id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+	}
+	originals := make(map[string]allDocsRow)
+	if len(ids) == 0 {
+		return originals, nil
+	}
+	rows, err := cs.db.allDocsByKeys(ids, true, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.Error == "" && !row.Value.Deleted {
+			originals[row.Key] = row
+		}
+	}
+
+	stale := make(map[string]error)
+	for _, c := range cs.changes {
+		id, rev := c.doc.IDRev()
+		if id == "" {
+			continue
+		}
+		if current, exists := originals[id]; exists && current.Value.Rev != rev {
+			stale[id] = couchError{Type: "conflict", Reason: "revision " + rev + " is not the latest one"}
+		}
+		if _, exists := originals[id]; !exists && rev != "" {
+			stale[id] = couchError{Type: "not_found", Reason: "missing"}
+		}
+	}
+	if len(stale) > 0 {
+		return nil, &ChangeSetError{Failed: stale}
+	}
+	return originals, nil
+}
+
+// Write compensating revisions for all changes that have been applied
+func (cs *ChangeSet) rollback(results []bulkResult, originals map[string]allDocsRow, opts []Option) error {
+	compensation := new(Bulk)
+	for _, result := range results {
+		if !result.Ok {
+			continue
+		}
+		original, existed := originals[result.ID]
+		if !existed {
+			// Document has been created, delete it again
+			doc := DynamicDoc{"_deleted": true}
+			doc.SetIDRev(result.ID, result.Rev)
+			compensation.Add(doc)
+		} else {
+			// Document has been edited or deleted, restore its content
+			var doc rawDoc
+			if err := json.Unmarshal(original.Doc, &doc); err != nil {
+				return err
+			}
+			doc.SetIDRev(result.ID, result.Rev)
+			compensation.Add(doc)
+		}
+	}
+	if len(compensation.Docs) == 0 {
+		return nil
+	}
+	_, err := cs.db.InsertBulk(compensation, false, opts...)
+	return err
+}
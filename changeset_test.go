@@ -0,0 +1,49 @@
+package couch_test
+
+import (
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestIntegrationChangeSet(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	peter := &Person{Name: "Peter", Height: 185}
+	anna := &Person{Name: "Anna", Height: 170}
+	insertTestDoc(peter, db, t)
+	insertTestDoc(anna, db, t)
+
+	// Commit edits and a deletion at once
+	cs := db.ChangeSet()
+	peter.Height = 186
+	cs.Put(peter)
+	cs.Delete(anna.ID, anna.Rev)
+	cs.Put(&Person{Name: "Stefan"})
+	if err := cs.Commit(); err != nil {
+		t.Fatal("Committing change set returned error:", err)
+	}
+	if cs.Len() != 0 {
+		t.Error("Committed change set should be empty, has", cs.Len(), "changes")
+	}
+
+	// A stale revision must prevent the whole change set from being written
+	stale := *peter
+	peter.Height = 187
+	insertTestDoc(peter, db, t)
+	cs.Put(&stale)
+	newcomer := &Person{Name: "Eva"}
+	cs.Put(newcomer)
+	err := cs.Commit()
+	csErr, ok := err.(*couch.ChangeSetError)
+	if !ok {
+		t.Fatal("Committing stale revision should return ChangeSetError, got", err)
+	}
+	if _, failed := csErr.Failed[peter.ID]; !failed {
+		t.Error("Stale document should be reported as failed:", csErr)
+	}
+	if newcomer.ID != "" {
+		t.Error("No document should have been written for an invalid change set, got", newcomer)
+	}
+}
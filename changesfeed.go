@@ -0,0 +1,121 @@
+package couch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// Line of a continuous changes feed, the last one only carries LastSeq
+type feedLine struct {
+	ChangeEvent
+	LastSeq Seq `json:"last_seq"`
+}
+
+// StreamChanges passes the changes of a database to fn as they are received, until ctx is done,
+// fn returns an error or options.Limit changes have been passed. With FeedNormal it stops at the
+// current end of the database, with FeedLongpoll and FeedContinuous it waits for further changes
+// and requests again whenever CouchDB ends a request. Returns the sequence to continue from along
+// with the reason to stop, ctx.Err() if ctx is done:
+//
+//	since, err := db.StreamChanges(ctx, &couch.ChangesOptions{
+//		Since:     couch.SinceNow,
+//		Feed:      couch.FeedContinuous,
+//		Heartbeat: 10 * time.Second,
+//	}, func(e couch.ChangeEvent) error {
+//		log.Println(e.ID, "changed")
+//		return nil
+//	})
+//
+// Waiting feeds aren't limited by the timeout of the server, use ctx and options.Timeout instead.
+func (db *Database) StreamChanges(ctx context.Context, options *ChangesOptions, fn func(ChangeEvent) error, opts ...Option) (Seq, error) {
+	var o ChangesOptions
+	if options != nil {
+		o = *options
+	}
+	remaining := o.Limit
+	if o.Feed == "" || o.Feed == FeedNormal {
+		return db.streamBatch(ctx, o, &remaining, fn, opts)
+	}
+	opts = withOptions(db.server.withDefaults(opts), WithTimeout(0), WithContext(ctx))
+	for {
+		o.Limit = remaining
+		since, err := db.streamBatch(ctx, o, &remaining, fn, opts)
+		if since != "" {
+			o.Since = since
+		}
+		if ctx.Err() != nil {
+			return o.Since, ctx.Err()
+		}
+		if err != nil || (o.Limit > 0 && remaining == 0) {
+			return o.Since, err
+		}
+	}
+}
+
+// Pass the changes of a single request to fn, counting them down from remaining if there is a limit
+func (db *Database) streamBatch(ctx context.Context, o ChangesOptions, remaining *int, fn func(ChangeEvent) error, opts []Option) (Seq, error) {
+	deliver := func(e ChangeEvent) error {
+		if err := fn(e); err != nil {
+			return err
+		}
+		if *remaining > 0 {
+			*remaining--
+		}
+		return nil
+	}
+	if o.Feed != FeedContinuous {
+		result, err := db.Changes(&o, withOptions(opts, WithContext(ctx))...)
+		if err != nil {
+			return "", err
+		}
+		var last Seq
+		for _, e := range result.Results {
+			if err = deliver(e); err != nil {
+				return last, err
+			}
+			last = e.Seq
+		}
+		return result.LastSeq, nil
+	}
+
+	var body io.ReadCloser
+	url := db.URL() + "/_changes" + urlEncode(o.params())
+	if _, err := do(url, "GET", db.Cred(), nil, &body, opts); err != nil {
+		return "", err
+	}
+	defer closeBody(body)
+	var last Seq
+	r := bufio.NewReader(body)
+	for {
+		line, err := r.ReadBytes('\n')
+		// Empty lines are heartbeats
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var l feedLine
+			if jsonErr := json.Unmarshal(line, &l); jsonErr != nil {
+				return last, jsonErr
+			}
+			if l.LastSeq != "" {
+				return l.LastSeq, nil
+			}
+			if err := deliver(l.ChangeEvent); err != nil {
+				return last, err
+			}
+			if l.Seq != "" {
+				last = l.Seq
+			}
+		}
+		if err == io.EOF {
+			// CouchDB ends a feed with last_seq, anything else is a broken connection
+			return last, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return last, ctx.Err()
+			}
+			return last, err
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package couch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestStreamChangesContinuous(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var sinces []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("feed") != "continuous" || q.Get("heartbeat") != "50" {
+			t.Error("Unexpected parameters", r.URL.RawQuery)
+		}
+		mu.Lock()
+		sinces = append(sinces, q.Get("since"))
+		n := len(sinces)
+		mu.Unlock()
+		flusher := w.(http.Flusher)
+		if n == 1 {
+			// First connection ends like a CouchDB timeout
+			fmt.Fprint(w, `{"seq": "1-a", "id": "anna", "changes": [{"rev": "1-x"}]}`+"\n\n")
+			fmt.Fprint(w, `{"last_seq": "1-a", "pending": 0}`+"\n")
+			return
+		}
+		fmt.Fprint(w, "\n")
+		flusher.Flush()
+		fmt.Fprint(w, `{"seq": "2-b", "id": "bert", "deleted": true, "changes": [{"rev": "2-y"}]}`+"\n")
+		flusher.Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+	db.Server().SetTimeout(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var ids []string
+	since, err := db.StreamChanges(ctx, &couch.ChangesOptions{Since: couch.SinceNow, Feed: couch.FeedContinuous, Heartbeat: 50 * time.Millisecond}, func(e couch.ChangeEvent) error {
+		ids = append(ids, e.ID)
+		if e.ID == "bert" {
+			go func() {
+				// Outlive the timeout of the server to show that it doesn't apply
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Error("Cancelled feed should return context.Canceled, got", err)
+	}
+	if since != "2-b" || fmt.Sprint(ids) != "[anna bert]" {
+		t.Error("Unexpected changes", ids, "ending at", since)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(sinces) != "[now 1-a]" {
+		t.Error("Feed should reconnect from the last sequence, requested", sinces)
+	}
+}
+
+func TestStreamChangesLongpoll(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("feed") != "longpoll" || r.URL.Query().Get("timeout") != "1000" {
+			t.Error("Unexpected parameters", r.URL.RawQuery)
+		}
+		switch r.URL.Query().Get("since") {
+		case "":
+			w.Write([]byte(`{"results": [{"seq": "1-a", "id": "anna"}], "last_seq": "1-a"}`))
+		default:
+			t.Error("Unexpected since", r.URL.Query().Get("since"))
+		}
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	// A limit ends a waiting feed
+	calls := 0
+	since, err := db.StreamChanges(context.Background(), &couch.ChangesOptions{Feed: couch.FeedLongpoll, Timeout: time.Second, Limit: 1}, func(e couch.ChangeEvent) error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 1 || since != "1-a" {
+		t.Error("Feed should stop after the limit, got", calls, since, err)
+	}
+
+	if _, err = db.Changes(&couch.ChangesOptions{Feed: couch.FeedContinuous}); err == nil {
+		t.Error("Changes() shouldn't accept a continuous feed")
+	}
+}
+
+func TestStreamChangesCallbackError(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"seq": "1-a", "id": "anna"}, {"seq": "2-b", "id": "bert"}], "last_seq": "2-b"}`))
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	stop := errors.New("stop")
+	since, err := db.StreamChanges(context.Background(), nil, func(e couch.ChangeEvent) error {
+		if e.ID == "bert" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || since != "1-a" {
+		t.Error("Feed should stop at the last processed change, got", since, err)
+	}
+}
@@ -0,0 +1,167 @@
+package couch
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for everything a server schedules, like polling, retries, supervisors
+// such as watchdogs and sync agents, lock expiry and the intervals of quota checks and query caches.
+// Replace it with a *ManualClock to run code depending on it without waiting, see SetClock(). Durations
+// of calls, as in journals and slow query logs, are always measured with the system time.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// Clock reading the system time
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SetClock sets the clock a server and its databases schedule with, see Clock.
+// nil (the default) uses the system time.
+func (s *Server) SetClock(c Clock) {
+	s.clk = c
+}
+
+// Clock of a server, the system clock unless one has been set
+func (s *Server) clock() Clock {
+	if s.clk == nil {
+		return systemClock{}
+	}
+	return s.clk
+}
+
+// Backoff computes how long to wait before a retry, retry is 0 for the first one.
+type Backoff interface {
+	Delay(retry int) time.Duration
+}
+
+// ExponentialBackoff waits Initial before the first retry and twice as long before every
+// further one, up to Max unless it is 0. Without Max, delays stop growing before they overflow.
+type ExponentialBackoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Delay implements Backoff.
+func (b ExponentialBackoff) Delay(retry int) time.Duration {
+	d := b.Initial
+	for i := 0; i < retry && (b.Max <= 0 || d < b.Max) && d <= math.MaxInt64/2; i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// Default backoff of a server, see SetBackoff()
+var defaultBackoff = ExponentialBackoff{Initial: 100 * time.Millisecond, Max: 30 * time.Second}
+
+// SetBackoff sets the delays between retries of a server and its databases, nil (the default)
+// waits 100ms before the first retry, doubling up to 30s. Settings of a single feature, like
+// Webhook.Backoff, take precedence.
+func (s *Server) SetBackoff(b Backoff) {
+	s.retry = b
+}
+
+// Backoff of a server, the default one unless one has been set
+func (s *Server) backoff() Backoff {
+	if s.retry == nil {
+		return defaultBackoff
+	}
+	return s.retry
+}
+
+// ManualClock is a Clock that only moves when told to, for tests of code that polls or retries:
+//
+//	clock := couch.NewManualClock(time.Now())
+//	server.SetClock(clock)
+//	go follower.Process(ctx, fn)
+//	clock.WaitForWaiters(1)
+//	clock.Advance(time.Second) // Next poll
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []manualWaiter
+	changed chan struct{}
+}
+
+// Channel of a call to After() and when it fires
+type manualWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewManualClock returns a clock standing at now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now, changed: make(chan struct{})}
+}
+
+// Now implements Clock.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After implements Clock, the channel receives once the clock has been advanced by d.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, manualWaiter{at: c.now.Add(d), ch: ch})
+	c.notify()
+	return ch
+}
+
+// Advance moves the clock forward and fires the channels of After() that are due.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = pending
+	c.notify()
+}
+
+// Waiters returns the number of calls to After() that haven't fired yet.
+func (c *ManualClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// WaitForWaiters blocks until at least n calls to After() are pending, so that a test knows
+// the code under test is waiting before it advances the clock.
+func (c *ManualClock) WaitForWaiters(n int) {
+	c.mu.Lock()
+	for len(c.waiters) < n {
+		changed := c.changed
+		c.mu.Unlock()
+		<-changed
+		c.mu.Lock()
+	}
+	c.mu.Unlock()
+}
+
+// Wake up everyone in WaitForWaiters(), called with the lock held
+func (c *ManualClock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
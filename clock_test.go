@@ -0,0 +1,134 @@
+package couch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	t.Parallel()
+	b := couch.ExponentialBackoff{Initial: time.Second, Max: 5 * time.Second}
+	var delays []time.Duration
+	for retry := 0; retry < 5; retry++ {
+		delays = append(delays, b.Delay(retry))
+	}
+	if fmt.Sprint(delays) != "[1s 2s 4s 5s 5s]" {
+		t.Error("Unexpected delays", delays)
+	}
+	if d := (couch.ExponentialBackoff{Initial: time.Second}).Delay(10); d != 1024*time.Second {
+		t.Error("Backoff without maximum should keep doubling, got", d)
+	}
+	if d := (couch.ExponentialBackoff{Initial: time.Second}).Delay(100); d <= 0 {
+		t.Error("Backoff without maximum shouldn't overflow, got", d)
+	}
+}
+
+func TestManualClock(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := couch.NewManualClock(start)
+	short, long := clock.After(time.Second), clock.After(time.Minute)
+	clock.Advance(30 * time.Second)
+	select {
+	case now := <-short:
+		if !now.Equal(start.Add(30 * time.Second)) {
+			t.Error("Channel should receive the current time, got", now)
+		}
+	default:
+		t.Error("Channel should fire once the clock passed it")
+	}
+	select {
+	case <-long:
+		t.Error("Channel shouldn't fire before its time")
+	default:
+	}
+	if clock.Waiters() != 1 {
+		t.Error("One waiter should be left, got", clock.Waiters())
+	}
+}
+
+func TestWebhookRetriesWithManualClock(t *testing.T) {
+	t.Parallel()
+	couchdb := followerServer(t)
+	defer couchdb.Close()
+
+	var mu sync.Mutex
+	attempts := 0
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attempts++; attempts <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		cancel()
+	}))
+	defer receiver.Close()
+
+	clock := couch.NewManualClock(time.Now())
+	s := couch.NewServer(couchdb.URL, nil)
+	s.SetClock(clock)
+	s.SetBackoff(couch.ExponentialBackoff{Initial: time.Hour}) // Webhooks without a backoff use the server's
+	bridge := couch.NewWebhookBridge(s.Database("people").Follower("webhooks"), &couch.Webhook{
+		URL:        receiver.URL,
+		MaxRetries: 2,
+	})
+	done := make(chan error)
+	go func() { done <- bridge.Run(ctx) }()
+
+	// Hours of retries pass without waiting for them
+	clock.WaitForWaiters(1)
+	clock.Advance(time.Hour)
+	clock.WaitForWaiters(1)
+	clock.Advance(2 * time.Hour)
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Error("Bridge should run until cancelled, got", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 3 {
+		t.Error("Delivery should succeed on the third attempt, got", attempts)
+	}
+}
+
+func TestManualClockLock(t *testing.T) {
+	t.Parallel()
+	var renewals int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&renewals, 1)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"ok": true, "id": "lock:invoices", "rev": "%d-a"}`, n)
+	}))
+	defer ts.Close()
+	clock := couch.NewManualClock(time.Now())
+	s := couch.NewServer(ts.URL, nil)
+	s.SetClock(clock)
+
+	lock, err := s.Database("db").Lock("invoices", "worker1", 3*time.Minute)
+	if err != nil {
+		t.Fatal("Acquiring lock returned error:", err)
+	}
+	clock.WaitForWaiters(1)
+	clock.Advance(time.Minute) // A third of the ttl passed, time to renew
+	clock.WaitForWaiters(1)
+	if n := atomic.LoadInt32(&renewals); n != 2 || !lock.Held() {
+		t.Error("Lock should be renewed after a third of its ttl, got requests:", n)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.Close(ctx)
+	clock.Advance(3 * time.Minute)
+	if lock.Held() {
+		t.Error("Lock that wasn't renewed should expire with the clock")
+	}
+}
@@ -0,0 +1,92 @@
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// Fields describing the revision history of a document in a database, meaningless in any other
+var revisionFields = []string{"_rev", "_revisions", "_revs_info", "_conflicts", "_deleted_conflicts", "_local_seq"}
+
+// CloneForInsert returns a deep copy of doc, of the same type, that can be inserted into an unrelated
+// database. The revision and revision history are removed, so the copy starts a history of its own
+// instead of failing with a conflict or, worse, passing as an edit of a document that happens to have
+// the same revision. Attachment stubs are removed as well since they only refer to attachments stored
+// in the source database, inline attachments including their data are kept. The id is kept, set
+// another one with SetIDRev() if needed:
+//
+//	clone, err := couch.CloneForInsert(person)
+//	if err == nil {
+//		err = archive.Insert(clone)
+//	}
+//
+// Fields kept in Extras are copied, numbers in a DynamicDoc keep their precision.
+func CloneForInsert(doc Identifiable) (Identifiable, error) {
+	v := reflect.ValueOf(doc)
+	if doc == nil || (v.Kind() == reflect.Ptr || v.Kind() == reflect.Map) && v.IsNil() {
+		return nil, errors.New("couch: cannot clone nil document")
+	}
+	codec := JSONCodec{UseNumber: true}
+	enc, err := codec.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(enc, &fields); err != nil {
+		return nil, err
+	}
+	for _, f := range revisionFields {
+		delete(fields, f)
+	}
+	if err := stripAttachmentStubs(fields); err != nil {
+		return nil, err
+	}
+	if enc, err = json.Marshal(fields); err != nil {
+		return nil, err
+	}
+
+	var clone reflect.Value
+	if v.Kind() == reflect.Ptr {
+		clone = reflect.New(v.Type().Elem())
+	} else {
+		clone = reflect.New(v.Type())
+	}
+	if err := codec.Unmarshal(enc, clone.Interface()); err != nil {
+		return nil, err
+	}
+	if v.Kind() != reflect.Ptr {
+		clone = clone.Elem()
+	}
+	return clone.Interface().(Identifiable), nil
+}
+
+// Remove the attachments of a document that are stubs, and _attachments if no attachment is left
+func stripAttachmentStubs(fields map[string]json.RawMessage) error {
+	raw, ok := fields["_attachments"]
+	if !ok {
+		return nil
+	}
+	var atts map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &atts); err != nil {
+		return err
+	}
+	for name, att := range atts {
+		var stub struct {
+			Stub bool `json:"stub"`
+		}
+		if err := json.Unmarshal(att, &stub); err != nil {
+			return err
+		}
+		if stub.Stub {
+			delete(atts, name)
+		}
+	}
+	if len(atts) == 0 {
+		delete(fields, "_attachments")
+		return nil
+	}
+	enc, err := json.Marshal(atts)
+	fields["_attachments"] = enc
+	return err
+}
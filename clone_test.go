@@ -0,0 +1,59 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestCloneForInsert(t *testing.T) {
+	t.Parallel()
+	p := &PersonWithExtras{Name: "Anna", Extras: couch.Extras{"nickname": json.RawMessage(`"Annie"`)}}
+	p.SetIDRev("anna", "3-abc")
+	c, err := couch.CloneForInsert(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := c.(*PersonWithExtras)
+	if clone == p || clone.ID != "anna" || clone.Rev != "" || clone.Name != "Anna" || string(clone.Extras["nickname"]) != `"Annie"` {
+		t.Error("Clone should be a copy without revision, got", clone)
+	}
+	clone.Extras["nickname"] = json.RawMessage(`"Ann"`)
+	if string(p.Extras["nickname"]) != `"Annie"` || p.Rev != "3-abc" {
+		t.Error("Original shouldn't change, got", p)
+	}
+
+	var doc couch.DynamicDoc
+	json.Unmarshal([]byte(`{
+		"_id": "bert", "_rev": "2-def", "_revisions": {"start": 2, "ids": ["def", "abc"]},
+		"_conflicts": ["2-xyz"], "big": 9007199254740993, "tags": ["a"],
+		"_attachments": {
+			"photo.jpg": {"content_type": "image/jpeg", "stub": true, "length": 4},
+			"note.txt": {"content_type": "text/plain", "data": "aGk="}
+		}
+	}`), &doc)
+	c, err = couch.CloneForInsert(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := json.Marshal(c)
+	expected := `{"_attachments":{"note.txt":{"content_type":"text/plain","data":"aGk="}},"_id":"bert","big":9007199254740993,"tags":["a"]}`
+	if string(enc) != expected {
+		t.Error("Unexpected clone", string(enc))
+	}
+	c.(couch.DynamicDoc)["tags"].([]interface{})[0] = "b"
+	if doc["tags"].([]interface{})[0] != "a" {
+		t.Error("Clone should be deep")
+	}
+
+	doc = couch.DynamicDoc{"_id": "carl", "_attachments": map[string]interface{}{"a": map[string]interface{}{"stub": true}}}
+	c, _ = couch.CloneForInsert(doc)
+	if _, ok := c.(couch.DynamicDoc)["_attachments"]; ok {
+		t.Error("Only stubs shouldn't leave _attachments, got", c)
+	}
+
+	if _, err := couch.CloneForInsert((*Person)(nil)); err == nil {
+		t.Error("Cloning nil should fail")
+	}
+}
@@ -0,0 +1,99 @@
+package couch
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrServerClosed is returned by calls to a server after Close().
+var ErrServerClosed = errors.New("couch: server closed")
+
+// Background resources of a server and whether it is closed
+type lifecycle struct {
+	mu        sync.Mutex
+	closed    bool
+	done      chan struct{}
+	resources map[interface{}]func() error
+}
+
+// Channel that is closed once a server is closed
+func (s *Server) done() <-chan struct{} {
+	s.life.mu.Lock()
+	defer s.life.mu.Unlock()
+	if s.life.done == nil {
+		s.life.done = make(chan struct{})
+	}
+	return s.life.done
+}
+
+// Register a background resource, stop is called when the server is closed.
+// Returns ErrServerClosed if the server is closed already.
+func (s *Server) register(resource interface{}, stop func() error) error {
+	s.life.mu.Lock()
+	defer s.life.mu.Unlock()
+	if s.life.closed {
+		return ErrServerClosed
+	}
+	if s.life.resources == nil {
+		s.life.resources = make(map[interface{}]func() error)
+	}
+	s.life.resources[resource] = stop
+	return nil
+}
+
+// Remove a background resource after it stopped
+func (s *Server) unregister(resource interface{}) {
+	s.life.mu.Lock()
+	defer s.life.mu.Unlock()
+	delete(s.life.resources, resource)
+}
+
+// Close shuts down everything running in the background for a server and its databases, like
+// sync agents, compaction advisors and followers, and cancels calls in flight. Calls made after
+// Close return ErrServerClosed. It waits for background resources to stop until ctx is done.
+// Closing a server again does nothing.
+func (s *Server) Close(ctx context.Context) error {
+	s.life.mu.Lock()
+	if s.life.closed {
+		s.life.mu.Unlock()
+		return nil
+	}
+	s.life.closed = true
+	if s.life.done == nil {
+		s.life.done = make(chan struct{})
+	}
+	done := s.life.done
+	stops := make([]func() error, 0, len(s.life.resources))
+	for _, stop := range s.life.resources {
+		stops = append(stops, stop)
+	}
+	s.life.mu.Unlock()
+
+	// Stop resources first, they may need to clean up with a few calls of their own
+	errs := make(chan error, len(stops))
+	for _, stop := range stops {
+		go func(stop func() error) { errs <- stop() }(stop)
+	}
+	var err error
+	for range stops {
+		select {
+		case e := <-errs:
+			if err == nil {
+				err = e
+			}
+		case <-ctx.Done():
+			close(done)
+			return ctx.Err()
+		}
+	}
+	close(done)
+	return err
+}
+
+// End early when the server is closed
+func closeWith(done <-chan struct{}) Option {
+	return func(o *callOptions) {
+		o.closing = done
+	}
+}
@@ -0,0 +1,81 @@
+package couch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestServerClose(t *testing.T) {
+	t.Parallel()
+	ts := followerServer(t)
+	defer ts.Close()
+	s := couch.NewServer(ts.URL, nil)
+	db := s.Database("people")
+
+	advisor := db.CompactionAdvisor(0.5)
+	if err := advisor.Start(time.Hour, false, nil); err != nil {
+		t.Fatal("Starting compaction advisor returned error:", err)
+	}
+	follower := db.Follower("close")
+	follower.SetPollInterval(time.Hour)
+	processed := make(chan error, 1)
+	go func() {
+		processed <- follower.ProcessBatches(context.Background(), 10, func([]couch.ChangeEvent) error { return nil })
+	}()
+	time.Sleep(100 * time.Millisecond) // Let the follower catch up and wait for more changes
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatal("Closing server returned error:", err)
+	}
+	select {
+	case err := <-processed:
+		if !errors.Is(err, couch.ErrServerClosed) {
+			t.Error("Follower should stop with ErrServerClosed, got", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Follower didn't stop after server was closed")
+	}
+	if err := db.CompactionAdvisor(0.5).Start(time.Hour, false, nil); !errors.Is(err, couch.ErrServerClosed) {
+		t.Error("Starting compaction advisor on closed server should fail, got", err)
+	}
+	if _, err := db.Info(); !errors.Is(err, couch.ErrServerClosed) {
+		t.Error("Calls to closed server should return ErrServerClosed, got", err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Error("Closing server again returned error:", err)
+	}
+}
+
+func TestServerCloseCancelsCalls(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+	s := couch.NewServer(ts.URL, nil)
+
+	called := make(chan error, 1)
+	go func() {
+		_, err := s.Database("slow").Info()
+		called <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal("Closing server returned error:", err)
+	}
+	if err := <-called; err == nil || time.Since(start) > 2*time.Second {
+		t.Error("Call in flight should be cancelled when the server is closed, got", err)
+	}
+}
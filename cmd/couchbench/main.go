@@ -0,0 +1,288 @@
+// Command couchbench generates load against a CouchDB database with the couch package and
+// reports throughput and latency percentiles per operation, e.g. to size a CouchDB instance
+// or to compare the performance of client changes:
+//
+//	couchbench -url http://127.0.0.1:5984 -user admin -password secret \
+//		-duration 30s -concurrency 16 -mix read=60,write=30,view=5,changes=5
+//
+// The database is created if necessary and seeded with -docs documents of -size bytes, which
+// the read operations pick from. Views are queried on a design document _design/couchbench.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Operations a workload can mix
+var operations = []string{"read", "write", "view", "changes"}
+
+// Settings of a benchmark run
+type config struct {
+	url         string
+	user        string
+	password    string
+	db          string
+	duration    time.Duration
+	concurrency int
+	mix         string
+	docs        int
+	size        int
+	timeout     time.Duration
+}
+
+func main() {
+	var c config
+	flag.StringVar(&c.url, "url", "http://127.0.0.1:5984", "CouchDB server")
+	flag.StringVar(&c.user, "user", "", "User name, no authentication if empty")
+	flag.StringVar(&c.password, "password", "", "Password of the user")
+	flag.StringVar(&c.db, "db", "couchbench", "Database to run against, created if it doesn't exist")
+	flag.DurationVar(&c.duration, "duration", 10*time.Second, "How long to generate load")
+	flag.IntVar(&c.concurrency, "concurrency", 4, "Number of concurrent clients")
+	flag.StringVar(&c.mix, "mix", "read=60,write=30,view=5,changes=5", "Weights of the operations read, write, view and changes")
+	flag.IntVar(&c.docs, "docs", 1000, "Number of documents to seed the database with")
+	flag.IntVar(&c.size, "size", 256, "Size of the payload of every document in bytes")
+	flag.DurationVar(&c.timeout, "timeout", 10*time.Second, "Time limit of a single operation")
+	flag.Parse()
+	if err := run(c, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "couchbench:", err)
+		os.Exit(1)
+	}
+}
+
+// Document written and read by the benchmark
+type benchDoc struct {
+	couch.Doc
+	N       int    `json:"n"`
+	Payload string `json:"payload"`
+}
+
+// Design document with the view queried by view operations
+func benchDesignDoc() *couch.DesignDoc {
+	d := couch.NewDesignDoc("couchbench")
+	d.Views["by_n"] = couch.View{Map: `function(doc) { if (doc.n !== undefined) { emit(doc.n, null); } }`}
+	return d
+}
+
+// Seed the database, generate load and write the report to out
+func run(c config, out io.Writer) error {
+	weights, err := parseMix(c.mix)
+	if err != nil {
+		return err
+	}
+	if c.concurrency < 1 || c.docs < 1 {
+		return errors.New("concurrency and docs must be at least 1")
+	}
+	var cred *couch.Credentials
+	if c.user != "" {
+		cred = couch.NewCredentials(c.user, c.password)
+	}
+	s := couch.NewServer(c.url, cred)
+	s.SetTimeout(c.timeout)
+	db, err := s.EnsureDatabase(c.db, &couch.DatabaseSetup{DesignDocs: []*couch.DesignDoc{benchDesignDoc()}})
+	if err != nil {
+		return err
+	}
+	ids, err := seed(db, c.docs, c.size)
+	if err != nil {
+		return err
+	}
+
+	results := newStats()
+	deadline := time.Now().Add(c.duration)
+	var wg sync.WaitGroup
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			w := &worker{db: db, ids: ids, size: c.size, rnd: rand.New(rand.NewSource(seed))}
+			for time.Now().Before(deadline) {
+				op := pick(weights, w.rnd)
+				start := time.Now()
+				err := w.do(op)
+				results.add(op, time.Since(start), err)
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+	results.report(out, c.duration)
+	return nil
+}
+
+// Insert n documents with a payload of size bytes, returns their ids
+func seed(db *couch.Database, n, size int) ([]string, error) {
+	bulk := new(couch.Bulk)
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("seed-%08d", i)
+		doc := &benchDoc{N: i, Payload: strings.Repeat("x", size)}
+		doc.SetIDRev(ids[i], "")
+		bulk.Add(doc)
+	}
+	// Documents seeded by an earlier run already exist and fail with a conflict, which is fine,
+	// only failed requests are reported as a *BatchError
+	_, err := db.InsertBulk(bulk, false, couch.WithBatchSize(500))
+	var batchErr *couch.BatchError
+	if errors.As(err, &batchErr) {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Client generating load, every worker has its own random source and changes feed
+type worker struct {
+	db    *couch.Database
+	ids   []string
+	size  int
+	rnd   *rand.Rand
+	since couch.Seq
+}
+
+// Run a single operation
+func (w *worker) do(op string) error {
+	switch op {
+	case "read":
+		return w.db.Retrieve(w.ids[w.rnd.Intn(len(w.ids))], &benchDoc{})
+	case "write":
+		return w.db.Insert(&benchDoc{N: w.rnd.Intn(len(w.ids)), Payload: strings.Repeat("x", w.size)})
+	case "view":
+		_, err := w.db.Query("couchbench", "by_n", map[string]interface{}{"startkey": w.rnd.Intn(len(w.ids)), "limit": 10})
+		return err
+	case "changes":
+		result, err := w.db.Changes(&couch.ChangesOptions{Since: w.since, Limit: 100})
+		if err != nil {
+			return err
+		}
+		w.since = result.LastSeq
+		if len(result.Results) == 0 {
+			w.since = "" // Caught up, read the feed again from the start
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown operation %s", op)
+}
+
+// Weight of an operation in a workload
+type weight struct {
+	op     string
+	weight int
+}
+
+// Parse a workload like "read=60,write=40", operations not mentioned aren't run
+func parseMix(mix string) ([]weight, error) {
+	var weights []weight
+	total := 0
+	for _, part := range strings.Split(mix, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid mix %q, expected op=weight", part)
+		}
+		known := false
+		for _, op := range operations {
+			known = known || op == kv[0]
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown operation %q, expected one of %s", kv[0], strings.Join(operations, ", "))
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid weight %q for %s", kv[1], kv[0])
+		}
+		if n > 0 {
+			weights = append(weights, weight{kv[0], n})
+			total += n
+		}
+	}
+	if total == 0 {
+		return nil, errors.New("mix has no operation with a positive weight")
+	}
+	return weights, nil
+}
+
+// Pick an operation at random according to the weights
+func pick(weights []weight, rnd *rand.Rand) string {
+	total := 0
+	for _, w := range weights {
+		total += w.weight
+	}
+	n := rnd.Intn(total)
+	for _, w := range weights {
+		if n < w.weight {
+			return w.op
+		}
+		n -= w.weight
+	}
+	return weights[len(weights)-1].op
+}
+
+// Latencies and errors of all operations, safe for concurrent use
+type stats struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	lastErr   map[string]error
+}
+
+func newStats() *stats {
+	return &stats{latencies: make(map[string][]time.Duration), errors: make(map[string]int), lastErr: make(map[string]error)}
+}
+
+// Record the outcome of an operation, failed ones don't count towards latencies
+func (s *stats) add(op string, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors[op]++
+		s.lastErr[op] = err
+		return
+	}
+	s.latencies[op] = append(s.latencies[op], d)
+}
+
+// Write a table of throughput and latency percentiles per operation
+func (s *stats) report(out io.Writer, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(out, "%-8s %8s %7s %9s %10s %10s %10s %10s\n", "op", "ok", "errors", "ops/s", "p50", "p90", "p99", "max")
+	for _, op := range operations {
+		l := s.latencies[op]
+		if len(l) == 0 && s.errors[op] == 0 {
+			continue
+		}
+		sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+		fmt.Fprintf(out, "%-8s %8d %7d %9.1f %10s %10s %10s %10s\n", op, len(l), s.errors[op],
+			float64(len(l))/duration.Seconds(), percentile(l, 50), percentile(l, 90), percentile(l, 99), percentile(l, 100))
+	}
+	for _, op := range operations {
+		if err := s.lastErr[op]; err != nil {
+			fmt.Fprintf(out, "last %s error: %v\n", op, err)
+		}
+	}
+}
+
+// Nearest-rank percentile of sorted latencies, 0 if there are none
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1].Round(time.Microsecond)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMix(t *testing.T) {
+	weights, err := parseMix("read=3, write=1,view=0")
+	if err != nil {
+		t.Fatal("Parsing mix returned error:", err)
+	}
+	if len(weights) != 2 || weights[0] != (weight{"read", 3}) || weights[1] != (weight{"write", 1}) {
+		t.Error("Unexpected weights", weights)
+	}
+	for _, mix := range []string{"read", "delete=1", "read=-1", "read=0"} {
+		if _, err := parseMix(mix); err == nil {
+			t.Error("Invalid mix should be rejected:", mix)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	weights := []weight{{"read", 3}, {"write", 1}}
+	rnd := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		counts[pick(weights, rnd)]++
+	}
+	if counts["read"] < 2800 || counts["read"] > 3200 || counts["read"]+counts["write"] != 4000 {
+		t.Error("Operations should be picked according to their weights, got", counts)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var l []time.Duration
+	for i := 1; i <= 100; i++ {
+		l = append(l, time.Duration(i)*time.Millisecond)
+	}
+	if p := percentile(l, 50); p != 50*time.Millisecond {
+		t.Error("Expected p50 of 50ms, got", p)
+	}
+	if p := percentile(l, 99); p != 99*time.Millisecond {
+		t.Error("Expected p99 of 99ms, got", p)
+	}
+	if p := percentile(l, 100); p != 100*time.Millisecond {
+		t.Error("Expected maximum of 100ms, got", p)
+	}
+	if p := percentile(nil, 50); p != 0 {
+		t.Error("Percentile without latencies should be 0, got", p)
+	}
+}
+
+func TestReport(t *testing.T) {
+	s := newStats()
+	s.add("read", time.Millisecond, nil)
+	s.add("read", 3*time.Millisecond, nil)
+	s.add("write", 0, errors.New("conflict"))
+	var out bytes.Buffer
+	s.report(&out, time.Second)
+	report := out.String()
+	if !strings.Contains(report, "read") || !strings.Contains(report, "last write error: conflict") || strings.Contains(report, "view") {
+		t.Error("Unexpected report", report)
+	}
+}
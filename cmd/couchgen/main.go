@@ -0,0 +1,284 @@
+// Command couchgen generates typed repositories for document types, binding them to a
+// couch.Database. Annotate a struct with a comment and run go generate:
+//
+//	//go:generate couchgen -file person.go
+//
+//	//couch:repository
+//	type Person struct {
+//		couch.Doc
+//		Name string
+//	}
+//
+// For every annotated struct, couchgen writes a type PersonRepository with the methods
+// Get, Put, Delete, Query and Changes into person_couch.go next to the source file.
+//
+// Databases usually hold documents of many types, which the repository tells apart by a string
+// field of the struct given with the annotation, e.g. //couch:repository Type=person. Put then
+// sets the field, Get reports documents of other types as not found and Changes skips them. Without it, only design
+// documents are skipped. Deleted documents don't carry their type, their changes are always
+// passed on.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Comment marking a struct to generate a repository for
+const annotationPrefix = "//couch:repository"
+
+func main() {
+	file := flag.String("file", os.Getenv("GOFILE"), "Go source file with annotated structs")
+	flag.Parse()
+	if err := run(*file); err != nil {
+		fmt.Fprintln(os.Stderr, "couchgen:", err)
+		os.Exit(1)
+	}
+}
+
+// Generate the repositories of a source file and write them next to it
+func run(file string) error {
+	if file == "" {
+		return errors.New("no source file given")
+	}
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	out, err := generate(file, src)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return errors.New("no struct annotated with " + annotationPrefix + " in " + file)
+	}
+	return ioutil.WriteFile(strings.TrimSuffix(file, ".go")+"_couch.go", out, 0644)
+}
+
+// Generate the repositories for the annotated structs of a source file, nil if there are none
+func generate(filename string, src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	types, err := annotatedStructs(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	data := struct {
+		Package  string
+		Types    []repository
+		Filtered bool
+	}{Package: f.Name.Name, Types: types}
+	for _, r := range types {
+		data.Filtered = data.Filtered || r.TypeField != ""
+	}
+	if err = repositoryTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// Repository to generate for an annotated struct, TypeField is the field holding the type of
+// its documents and TypeValue the type, both empty if documents aren't filtered
+type repository struct {
+	Name      string
+	TypeField string
+	TypeValue string
+}
+
+// Repositories of the struct types annotated with a repository comment
+func annotatedStructs(f *ast.File) ([]repository, error) {
+	var types []repository
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+			args, ok := annotation(doc)
+			if !ok {
+				continue
+			}
+			r := repository{Name: ts.Name.Name}
+			if args != "" {
+				field, value := splitArg(args)
+				if field == "" || value == "" {
+					return nil, fmt.Errorf("%s: annotation expects Field=type, got %q", r.Name, args)
+				}
+				if !hasStringField(st, field) {
+					return nil, fmt.Errorf("%s: no string field %s", r.Name, field)
+				}
+				r.TypeField, r.TypeValue = field, value
+			}
+			types = append(types, r)
+		}
+	}
+	return types, nil
+}
+
+// Arguments of the annotation in a doc comment, and whether it has a line with the annotation
+func annotation(doc *ast.CommentGroup) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, c := range doc.List {
+		text := strings.TrimSpace(c.Text)
+		if text == annotationPrefix {
+			return "", true
+		}
+		if strings.HasPrefix(text, annotationPrefix+" ") {
+			return strings.TrimSpace(strings.TrimPrefix(text, annotationPrefix)), true
+		}
+	}
+	return "", false
+}
+
+// Split an argument like Type=person
+func splitArg(arg string) (string, string) {
+	i := strings.Index(arg, "=")
+	if i < 0 {
+		return "", ""
+	}
+	return strings.TrimSpace(arg[:i]), strings.TrimSpace(arg[i+1:])
+}
+
+// Whether a struct declares a field of type string
+func hasStringField(st *ast.StructType, name string) bool {
+	for _, field := range st.Fields.List {
+		ident, ok := field.Type.(*ast.Ident)
+		if !ok || ident.Name != "string" {
+			continue
+		}
+		for _, n := range field.Names {
+			if n.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var repositoryTemplate = template.Must(template.New("repository").Parse(`// Code generated by couchgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	{{if .Filtered}}"fmt"
+	{{end}}"strings"
+
+	"github.com/patrickjuchli/couch"
+)
+{{range .Types}}{{$name := .Name}}
+// {{$name}}Repository reads and writes {{$name}} documents.
+type {{$name}}Repository struct {
+	db *couch.Database
+}
+
+// New{{$name}}Repository returns a repository for {{$name}} documents in a database.
+func New{{$name}}Repository(db *couch.Database) *{{$name}}Repository {
+	return &{{$name}}Repository{db: db}
+}
+
+// Database returns the database of the repository.
+func (r *{{$name}}Repository) Database() *couch.Database {
+	return r.db
+}
+
+// Get retrieves a document by id.{{if .TypeField}} Documents whose {{.TypeField}} isn't {{printf "%q" .TypeValue}} are not found.{{end}}
+func (r *{{$name}}Repository) Get(id string, opts ...couch.Option) (*{{$name}}, error) {
+	doc := new({{$name}})
+	if err := r.db.Retrieve(id, doc, opts...); err != nil {
+		return nil, err
+	}
+{{- if .TypeField}}
+	if doc.{{.TypeField}} != {{printf "%q" .TypeValue}} {
+		return nil, fmt.Errorf("couch: %s is not a {{.TypeValue}}: %w", id, couch.ErrNotFound)
+	}
+{{- end}}
+	return doc, nil
+}
+
+// Put inserts or updates a document.
+func (r *{{$name}}Repository) Put(doc *{{$name}}, opts ...couch.Option) error {
+{{- if .TypeField}}
+	doc.{{.TypeField}} = {{printf "%q" .TypeValue}}
+{{- end}}
+	return r.db.Insert(doc, opts...)
+}
+
+// Delete deletes a document.
+func (r *{{$name}}Repository) Delete(doc *{{$name}}, opts ...couch.Option) error {
+	id, rev := doc.IDRev()
+	return r.db.Delete(id, rev, opts...)
+}
+
+// Query returns the documents of the rows of a view.
+func (r *{{$name}}Repository) Query(designID, viewID string, options map[string]interface{}, opts ...couch.Option) ([]{{$name}}, error) {
+	var docs []{{$name}}
+	err := r.db.QueryDocs(designID, viewID, options, &docs, opts...)
+	return docs, err
+}
+
+// {{$name}}Change is a change of a {{$name}} document, Doc is nil for deleted documents.
+type {{$name}}Change struct {
+	ID      string
+	Seq     couch.Seq
+	Deleted bool
+	Doc     *{{$name}}
+}
+
+// Changes returns the changes after a sequence including the documents, and the sequence to continue with.
+// Design documents{{if .TypeField}} and documents whose {{.TypeField}} isn't {{printf "%q" .TypeValue}}{{end}} are skipped,
+// deleted documents don't carry their type and are always included.
+func (r *{{$name}}Repository) Changes(since couch.Seq, limit int, opts ...couch.Option) ([]{{$name}}Change, couch.Seq, error) {
+	result, err := r.db.Changes(&couch.ChangesOptions{Since: since, Limit: limit, IncludeDocs: true}, opts...)
+	if err != nil {
+		return nil, since, err
+	}
+	changes := make([]{{$name}}Change, 0, len(result.Results))
+	for _, c := range result.Results {
+		if strings.HasPrefix(c.ID, "_design/") {
+			continue
+		}
+		change := {{$name}}Change{ID: c.ID, Seq: c.Seq, Deleted: c.Deleted}
+		if !c.Deleted && len(c.Doc) > 0 {
+			change.Doc = new({{$name}})
+			if err = r.db.Codec().Unmarshal(c.Doc, change.Doc); err != nil {
+				return nil, since, err
+			}
+{{- if .TypeField}}
+			if change.Doc.{{.TypeField}} != {{printf "%q" .TypeValue}} {
+				continue
+			}
+{{- end}}
+		}
+		changes = append(changes, change)
+	}
+	return changes, result.LastSeq, nil
+}
+{{end}}`))
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const source = `package people
+
+import "github.com/patrickjuchli/couch"
+
+//couch:repository
+type Person struct {
+	couch.Doc
+	Name string
+}
+
+// Car is not annotated
+type Car struct {
+	couch.Doc
+}
+
+type (
+	//couch:repository Type=pet
+	Pet struct {
+		couch.Doc
+		Type string
+	}
+)
+`
+
+func TestGenerate(t *testing.T) {
+	out, err := generate("people.go", []byte(source))
+	if err != nil {
+		t.Fatal("Generating repositories returned error:", err)
+	}
+	code := string(out)
+	for _, expected := range []string{"package people", "type PersonRepository struct", "type PetRepository struct",
+		"func (r *PersonRepository) Get(id string", "func (r *PetRepository) Changes("} {
+		if !strings.Contains(code, expected) {
+			t.Error("Generated code should contain", expected)
+		}
+	}
+	if strings.Contains(code, "CarRepository") {
+		t.Error("Structs without annotation should be skipped")
+	}
+	for _, expected := range []string{`doc.Type != "pet"`, `change.Doc.Type != "pet"`, `doc.Type = "pet"`, `strings.HasPrefix(c.ID, "_design/")`} {
+		if !strings.Contains(code, expected) {
+			t.Error("Generated code should filter by type with", expected)
+		}
+	}
+	if strings.Count(code, "!= \"pet\"") != 2 {
+		t.Error("Only the repository of pets should filter by type")
+	}
+}
+
+func TestGenerateInvalidType(t *testing.T) {
+	for _, annotation := range []string{"//couch:repository Kind=person", "//couch:repository Type"} {
+		src := "package people\n\n" + annotation + "\ntype Person struct {\n\tType string\n}\n"
+		if _, err := generate("people.go", []byte(src)); err == nil {
+			t.Error("Annotation without a string field and type should fail:", annotation)
+		}
+	}
+}
+
+func TestGenerateWithoutAnnotations(t *testing.T) {
+	out, err := generate("people.go", []byte("package people\n\ntype Car struct{}\n"))
+	if err != nil || out != nil {
+		t.Error("Source without annotations should generate nothing, got", string(out), err)
+	}
+}
@@ -0,0 +1,406 @@
+package couch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Codec encodes documents to JSON and decodes them from JSON. A database uses
+// JSONCodec unless another codec is set with SetCodec(). Implement it to plug in
+// a faster JSON package or to customize the encoding of certain types:
+//
+//	type jsoniterCodec struct{}
+//
+//	func (jsoniterCodec) Marshal(v interface{}) ([]byte, error)      { return jsoniter.Marshal(v) }
+//	func (jsoniterCodec) Unmarshal(data []byte, v interface{}) error { return jsoniter.Unmarshal(data, v) }
+//
+//	db.SetCodec(jsoniterCodec{})
+//
+// Besides documents, a codec decodes view results, so values of rows are subject to it as well.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is a Codec based on encoding/json. With UseNumber enabled, numbers decoded
+// into interface{} values become json.Number instead of float64, this keeps large integers intact.
+// With DisallowUnknownFields enabled, decoding fails for object keys that don't match a struct
+// field, unless the struct keeps them in an Extras field.
+type JSONCodec struct {
+	UseNumber             bool
+	DisallowUnknownFields bool
+}
+
+// Marshal implements Codec.
+func (c JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	enc, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return mergeExtras(enc, reflect.ValueOf(v))
+}
+
+// Unmarshal implements Codec.
+func (c JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	var err error
+	if c.UseNumber || c.DisallowUnknownFields {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if c.UseNumber {
+			dec.UseNumber()
+		}
+		if c.DisallowUnknownFields && !hasExtras(reflect.TypeOf(v)) {
+			dec.DisallowUnknownFields()
+		}
+		err = dec.Decode(v)
+	} else {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		return err
+	}
+	return fillExtras(data, reflect.ValueOf(v), jsonFieldNames)
+}
+
+// SetCodec sets the codec a database uses for documents, pass nil to use JSONCodec again.
+func (db *Database) SetCodec(c Codec) {
+	db.docCodec = c
+}
+
+// Codec returns the codec a database uses for documents.
+func (db *Database) Codec() Codec {
+	if db.docCodec == nil {
+		return JSONCodec{}
+	}
+	return db.docCodec
+}
+
+// Encode a document with the codec of the database
+func (db *Database) encodeDoc(doc interface{}) (json.RawMessage, error) {
+	return db.Codec().Marshal(doc)
+}
+
+// ConventionCodec maps struct fields to JSON following conventions instead of
+// requiring json tags on every field:
+//
+//   - Field names are converted to snake_case, e.g. HeightInCm becomes height_in_cm
+//   - Fields are omitted if they have their zero value
+//   - Fields tagged with `couch:"-"` are excluded
+//
+// Fields with a json tag, like the ones of Doc, are encoded as the tag says.
+// A field can also be renamed with a couch tag, e.g. `couch:"size"`.
+// With DisallowUnknownFields enabled, decoding fails for object keys that don't match
+// a struct field, unless the struct keeps them in an Extras field.
+type ConventionCodec struct {
+	DisallowUnknownFields bool
+}
+
+// Marshal implements Codec.
+func (ConventionCodec) Marshal(v interface{}) ([]byte, error) {
+	tree, err := conventionTree(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	enc, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	return mergeExtras(enc, reflect.ValueOf(v))
+}
+
+// Unmarshal implements Codec.
+func (c ConventionCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(v)}
+	}
+	if err := conventionAssign(tree, rv.Elem(), c.DisallowUnknownFields); err != nil {
+		return err
+	}
+	return fillExtras(data, rv, conventionFieldNames)
+}
+
+// Field of a struct as mapped by ConventionCodec
+type conventionField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// Fields of a struct type following the conventions, embedded structs are flattened
+func conventionFields(t reflect.Type) []conventionField {
+	var fields []conventionField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+		jsonTag, hasJSON := f.Tag.Lookup("json")
+		couchTag := f.Tag.Get("couch")
+		if couchTag == "-" || jsonTag == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && !hasJSON && ft.Kind() == reflect.Struct {
+			for _, embedded := range conventionFields(ft) {
+				embedded.index = append([]int{i}, embedded.index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		field := conventionField{name: snakeCase(f.Name), index: []int{i}, omitEmpty: true}
+		if hasJSON {
+			parts := strings.Split(jsonTag, ",")
+			if parts[0] != "" {
+				field.name = parts[0]
+			}
+			field.omitEmpty = false
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					field.omitEmpty = true
+				}
+			}
+		} else if couchTag != "" {
+			field.name = couchTag
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// Convert a field name like UserID to user_id
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var buf bytes.Buffer
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && !unicode.IsUpper(runes[i-1])
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if i > 0 && (prevLower || nextLower) && runes[i-1] != '_' {
+				buf.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// Types that encode and decode themselves
+var (
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// Build a tree of values encoding/json can encode, with struct fields following the conventions
+func conventionTree(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Type().Implements(marshalerType) {
+		return v.Interface(), nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return conventionTree(v.Elem())
+	case reflect.Struct:
+		if reflect.PtrTo(v.Type()).Implements(marshalerType) && v.CanAddr() {
+			return v.Addr().Interface(), nil
+		}
+		obj := make(map[string]interface{})
+		for _, f := range conventionFields(v.Type()) {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			tree, err := conventionTree(fv)
+			if err != nil {
+				return nil, err
+			}
+			obj[f.name] = tree
+		}
+		return obj, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8) {
+			return v.Interface(), nil
+		}
+		arr := make([]interface{}, v.Len())
+		for i := range arr {
+			tree, err := conventionTree(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = tree
+		}
+		return arr, nil
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return v.Interface(), nil
+		}
+		obj := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			tree, err := conventionTree(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			obj[key.String()] = tree
+		}
+		return obj, nil
+	}
+	return v.Interface(), nil
+}
+
+// Get a possibly embedded field, false if it is behind a nil pointer
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// Same semantics as omitempty of encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Assign a decoded JSON tree to v, mapping struct fields following the conventions.
+// Everything that doesn't contain structs is left to encoding/json. With strict enabled,
+// keys that don't match a field of a struct without Extras are an error.
+func conventionAssign(tree interface{}, v reflect.Value, strict bool) error {
+	if tree == nil {
+		return jsonAssign(tree, v)
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return conventionAssign(tree, v.Elem(), strict)
+	}
+	if reflect.PtrTo(v.Type()).Implements(unmarshalerType) {
+		return jsonAssign(tree, v)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return jsonAssign(tree, v)
+		}
+		if strict && !hasExtras(v.Type()) {
+			if err := checkUnknownFields(obj, v.Type()); err != nil {
+				return err
+			}
+		}
+		for _, f := range conventionFields(v.Type()) {
+			value, ok := obj[f.name]
+			if !ok {
+				continue
+			}
+			if err := conventionAssign(value, allocFieldByIndex(v, f.index), strict); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		arr, ok := tree.([]interface{})
+		if !ok {
+			return jsonAssign(tree, v)
+		}
+		slice := reflect.MakeSlice(v.Type(), len(arr), len(arr))
+		for i, elem := range arr {
+			if err := conventionAssign(elem, slice.Index(i), strict); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Map:
+		obj, ok := tree.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return jsonAssign(tree, v)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for key, value := range obj {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := conventionAssign(value, elem, strict); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	}
+	return jsonAssign(tree, v)
+}
+
+// Report the first key of obj that ConventionCodec doesn't map to a field of t
+func checkUnknownFields(obj map[string]interface{}, t reflect.Type) error {
+	names := conventionFieldNames(t)
+	for key := range obj {
+		if !names[strings.ToLower(key)] {
+			return fmt.Errorf("couch: unknown field %q in %v", key, t)
+		}
+	}
+	return nil
+}
+
+// Get a possibly embedded field, allocating nil pointers on the way
+func allocFieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// Assign a decoded JSON tree to v using encoding/json
+func jsonAssign(tree interface{}, v reflect.Value) error {
+	enc, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(enc, v.Addr().Interface())
+}
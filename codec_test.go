@@ -0,0 +1,184 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+type Account struct {
+	couch.Doc
+	OwnerName  string
+	UserID     int64
+	Tags       []string
+	Address    *Address
+	Password   string `couch:"-"`
+	Size       int    `couch:"size_in_kb"`
+	ExplicitOK bool   `json:"explicit"`
+}
+
+type Address struct {
+	StreetName string
+}
+
+func TestConventionCodec(t *testing.T) {
+	t.Parallel()
+	codec := couch.ConventionCodec{}
+	acc := &Account{OwnerName: "Anna", UserID: 1 << 60, Address: &Address{StreetName: "Main"}, Password: "secret", Size: 3}
+	acc.SetIDRev("acc", "1-a")
+
+	enc, err := codec.Marshal(acc)
+	if err != nil {
+		t.Fatal("Encoding with convention codec returned error:", err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(enc, &fields)
+	expected := map[string]interface{}{
+		"_id":        "acc",
+		"_rev":       "1-a",
+		"owner_name": "Anna",
+		"user_id":    float64(1 << 60),
+		"address":    map[string]interface{}{"street_name": "Main"},
+		"size_in_kb": float64(3),
+		"explicit":   false,
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Error("Convention codec encoded", string(enc), "expected", expected)
+	}
+
+	decoded := new(Account)
+	if err = codec.Unmarshal(enc, decoded); err != nil {
+		t.Fatal("Decoding with convention codec returned error:", err)
+	}
+	acc.Password = ""
+	if !reflect.DeepEqual(decoded, acc) {
+		t.Error("Convention codec decoded", decoded, "expected", acc)
+	}
+}
+
+func TestJSONCodecUseNumber(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"_id":"counter","_rev":"1-a","value":9007199254740993}`))
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("counters")
+	db.SetCodec(couch.JSONCodec{UseNumber: true})
+	doc := make(couch.DynamicDoc)
+	if err := db.Retrieve("counter", &doc); err != nil {
+		t.Fatal("Retrieving document returned error:", err)
+	}
+	if doc["value"] != json.Number("9007199254740993") {
+		t.Errorf("Large integer should be decoded as json.Number, got %#v", doc["value"])
+	}
+}
+
+type PersonWithExtras struct {
+	couch.Doc
+	Name   string
+	Extras couch.Extras `json:"-"`
+}
+
+func TestExtrasRoundTrip(t *testing.T) {
+	t.Parallel()
+	data := []byte(`{"_id":"peter","Name":"Peter","nickname":"Pete","score":{"total":3}}`)
+	for _, codec := range []couch.Codec{couch.JSONCodec{}, couch.ConventionCodec{}} {
+		var p PersonWithExtras
+		if err := codec.Unmarshal(data, &p); err != nil {
+			t.Fatal("Decoding document returned error:", err)
+		}
+		if len(p.Extras) != 2 || string(p.Extras["nickname"]) != `"Pete"` {
+			t.Errorf("Unknown fields should be kept in Extras, got %T %v", codec, p.Extras)
+		}
+
+		p.Name = "Peter Pan"
+		enc, err := codec.Marshal(&p)
+		if err != nil {
+			t.Fatal("Encoding document returned error:", err)
+		}
+		var fields map[string]interface{}
+		json.Unmarshal(enc, &fields)
+		if fields["nickname"] != "Pete" || fields["score"] == nil {
+			t.Errorf("Unknown fields should be written back, %T encoded %s", codec, enc)
+		}
+		if fields["Name"] != "Peter Pan" && fields["name"] != "Peter Pan" {
+			t.Errorf("Known fields should take precedence, %T encoded %s", codec, enc)
+		}
+	}
+}
+
+func TestDynamicDocNumbers(t *testing.T) {
+	t.Parallel()
+	var doc couch.DynamicDoc
+	data := []byte(`{"_id":"big","value":9007199254740993,"nested":{"ratio":0.5}}`)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal("Decoding dynamic document returned error:", err)
+	}
+	if doc["value"] != json.Number("9007199254740993") {
+		t.Errorf("Number should be decoded as json.Number, got %#v", doc["value"])
+	}
+	nested, _ := doc["nested"].(map[string]interface{})
+	if nested["ratio"] != json.Number("0.5") {
+		t.Errorf("Nested number should be decoded as json.Number, got %#v", nested["ratio"])
+	}
+	enc, _ := json.Marshal(doc)
+	if !strings.Contains(string(enc), `"value":9007199254740993`) {
+		t.Error("Number should be encoded unchanged, got", string(enc))
+	}
+}
+
+func TestStrictDecode(t *testing.T) {
+	t.Parallel()
+	data := []byte(`{"_id":"peter","Name":"Peter","Height":180,"nickname":"Pete"}`)
+	for _, codec := range []couch.Codec{couch.JSONCodec{DisallowUnknownFields: true}, couch.ConventionCodec{DisallowUnknownFields: true}} {
+		var p Person
+		if err := codec.Unmarshal(data, &p); err == nil {
+			t.Errorf("%T should report unknown fields", codec)
+		}
+		var withExtras PersonWithExtras
+		if err := codec.Unmarshal(data, &withExtras); err != nil {
+			t.Errorf("%T should keep unknown fields in Extras, got error: %v", codec, err)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer ts.Close()
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	var p Person
+	if err := db.Retrieve("peter", &p); err != nil {
+		t.Fatal("Retrieving document returned error:", err)
+	}
+	if err := db.Retrieve("peter", &p, couch.StrictDecode()); err == nil {
+		t.Error("Retrieving document with unknown fields in strict mode should return error")
+	}
+}
+
+func TestConflictRevisionsError(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"ok":{"_id":"peter","_rev":"2-a","Name":"Peter","Height":"tall"}},{"ok":{"_id":"peter","_rev":"2-b","Name":"Pete","Height":180}}]`))
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	conflict, err := db.ConflictFor("peter")
+	if err != nil || conflict == nil {
+		t.Fatal("Expected a conflict, got", conflict, err)
+	}
+	var revs []Person
+	if err = conflict.Revisions(&revs); err == nil {
+		t.Error("Revisions with a type mismatch should return error")
+	}
+	var dynamic []couch.DynamicDoc
+	if err = conflict.Revisions(&dynamic, couch.StrictDecode()); err != nil || len(dynamic) != 2 {
+		t.Error("Revisions as dynamic documents should work, got", dynamic, err)
+	}
+}
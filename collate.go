@@ -0,0 +1,52 @@
+package couch
+
+import "encoding/json"
+
+// CouchDB sorts keys by type first: null, false, true, numbers, strings, arrays
+// and objects. Strings are compared following the Unicode Collation Algorithm, not
+// byte-wise, see http://docs.couchdb.org/en/latest/ddocs/views/collation.html
+//
+// The helpers below build key ranges that work with this collation. Use nil
+// as the lowest possible key.
+
+// HighString sorts after all strings that are used in practice. Append it to a
+// string prefix to get the upper bound of a prefix range.
+const HighString = "\ufff0"
+
+// Empty object, sorting after all other values
+type highKey struct{}
+
+// HighKey sorts after all other keys, it is encoded as an empty JSON object.
+// Use it as the last element of an array key to get the upper bound of an array prefix range.
+var HighKey = highKey{}
+
+// StringPrefixRange returns the start and end key matching all strings starting with prefix.
+func StringPrefixRange(prefix string) (start, end string) {
+	return prefix, prefix + HighString
+}
+
+// ArrayPrefixRange returns the start and end key matching all array keys starting with the
+// given elements, e.g. ArrayPrefixRange("person") matches ["person", "Anna"] and ["person", 1, 2].
+func ArrayPrefixRange(prefix ...interface{}) (start, end []interface{}) {
+	start = append([]interface{}{}, prefix...)
+	end = append(append([]interface{}{}, prefix...), HighKey)
+	return start, end
+}
+
+// KeyRange returns the options to query a view for all keys between start and end,
+// both inclusive. Add further options to the returned map as needed:
+//
+//	options, _ := couch.KeyRange(couch.ArrayPrefixRange("person"))
+//	options["limit"] = 10
+//	db.Query("app", "by_type", options)
+func KeyRange(start, end interface{}) (map[string]interface{}, error) {
+	startKey, err := json.Marshal(start)
+	if err != nil {
+		return nil, err
+	}
+	endKey, err := json.Marshal(end)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"startkey": string(startKey), "endkey": string(endKey)}, nil
+}
@@ -0,0 +1,52 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestStringPrefixRange(t *testing.T) {
+	t.Parallel()
+	start, end := couch.StringPrefixRange("abc")
+	if start != "abc" || end != "abc\ufff0" {
+		t.Error("Wrong string prefix range:", start, end)
+	}
+}
+
+func TestArrayPrefixRange(t *testing.T) {
+	t.Parallel()
+	options, err := couch.KeyRange(couch.ArrayPrefixRange("person", 1))
+	if err != nil {
+		t.Fatal("Encoding key range returned error:", err)
+	}
+	if options["startkey"] != `["person",1]` || options["endkey"] != `["person",1,{}]` {
+		t.Error("Wrong array prefix range:", options)
+	}
+}
+
+func TestDocsWithPrefix(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/db/_all_docs" || q.Get("startkey") != `"person:"` || q.Get("endkey") != "\"person:\U0010ffff\"" || q.Get("include_docs") != "true" {
+			t.Error("Unexpected request", r.URL.Path, q)
+		}
+		w.Write([]byte(`{"rows": [
+			{"id": "person:anna", "doc": {"_id": "person:anna", "_rev": "1-a", "Name": "Anna"}},
+			{"id": "person:bert", "doc": {"_id": "person:bert", "_rev": "1-b", "Name": "Bert"}}
+		]}`))
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	var people []Person
+	if err := db.DocsWithPrefix("person:", &people); err != nil {
+		t.Fatal("Getting documents by prefix returned error:", err)
+	}
+	if len(people) != 2 || people[0].Name != "Anna" || people[1].ID != "person:bert" {
+		t.Error("Unexpected documents", people)
+	}
+}
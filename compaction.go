@@ -0,0 +1,163 @@
+package couch
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Databases smaller than this are never worth compacting
+const defaultMinCompactionSize = 1 << 20
+
+// Number of samples a CompactionAdvisor keeps
+const maxInfoSamples = 64
+
+// InfoSample is the information about a database at a point in time.
+type InfoSample struct {
+	Time time.Time
+	Info *DatabaseInfo
+}
+
+// CompactionAdvice is the result of sampling a database. Rates are per second and
+// computed from the previous sample, they are 0 for the first one.
+type CompactionAdvice struct {
+	Sample        InfoSample
+	Fragmentation float64
+	UpdateRate    float64 // Updates
+	DocCountRate  float64 // Change of the number of documents
+	FileGrowth    float64 // Change of the file size in bytes
+	Compact       bool    // Whether compaction is recommended
+	Compacting    bool    // Whether compaction has been triggered or is already running
+}
+
+// CompactionAdvisor monitors how a database changes over time and recommends compaction
+// once the share of its file occupied by old revisions passes a threshold:
+//
+//	advisor := db.CompactionAdvisor(0.5)
+//	advisor.Start(time.Hour, true, func(a *couch.CompactionAdvice, err error) {
+//		log.Printf("%.0f%% fragmented, compacting: %v", a.Fragmentation*100, a.Compacting)
+//	})
+//
+// An advisor can also be sampled manually with Sample().
+type CompactionAdvisor struct {
+	db        *Database
+	threshold float64
+	minSize   int64
+
+	mu       sync.Mutex
+	samples  []InfoSample
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// CompactionAdvisor returns an advisor recommending compaction when the fragmentation
+// of a database, see DatabaseInfo.Fragmentation(), passes threshold.
+func (db *Database) CompactionAdvisor(threshold float64) *CompactionAdvisor {
+	return &CompactionAdvisor{db: db, threshold: threshold, minSize: defaultMinCompactionSize}
+}
+
+// SetMinFileSize sets the file size in bytes below which compaction is never recommended, 1 MB by default.
+func (a *CompactionAdvisor) SetMinFileSize(size int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.minSize = size
+}
+
+// Samples returns the samples taken so far, the oldest first.
+func (a *CompactionAdvisor) Samples() []InfoSample {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]InfoSample(nil), a.samples...)
+}
+
+// Sample takes a sample of the database and returns the advice derived from it.
+func (a *CompactionAdvisor) Sample(opts ...Option) (*CompactionAdvice, error) {
+	info, err := a.db.Info(opts...)
+	if err != nil {
+		return nil, err
+	}
+	sample := InfoSample{Time: a.db.server.clock().Now(), Info: info}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	advice := &CompactionAdvice{
+		Sample:        sample,
+		Fragmentation: info.Fragmentation(),
+		Compacting:    info.CompactRunning,
+	}
+	advice.Compact = !info.CompactRunning && info.FileSize() >= a.minSize && advice.Fragmentation >= a.threshold
+	if n := len(a.samples); n > 0 {
+		prev := a.samples[n-1]
+		if secs := sample.Time.Sub(prev.Time).Seconds(); secs > 0 {
+			advice.UpdateRate = float64(info.UpdateSeq.Number()-prev.Info.UpdateSeq.Number()) / secs
+			advice.DocCountRate = float64(info.DocCount-prev.Info.DocCount) / secs
+			advice.FileGrowth = float64(info.FileSize()-prev.Info.FileSize()) / secs
+		}
+	}
+	a.samples = append(a.samples, sample)
+	if len(a.samples) > maxInfoSamples {
+		a.samples = a.samples[len(a.samples)-maxInfoSamples:]
+	}
+	return advice, nil
+}
+
+// Start samples the database every interval in the background until Stop() is called. If
+// autoCompact is enabled, compaction is triggered whenever it is recommended. Every advice
+// or error is passed to notify, which may be nil.
+func (a *CompactionAdvisor) Start(interval time.Duration, autoCompact bool, notify func(*CompactionAdvice, error)) error {
+	if interval <= 0 {
+		return errors.New("couch: compaction advisor interval must be positive")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stop != nil {
+		return errors.New("couch: compaction advisor is already running")
+	}
+	err := a.db.server.register(a, func() error {
+		a.Stop()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go a.run(interval, autoCompact, notify)
+	return nil
+}
+
+// Stop ends sampling started with Start().
+func (a *CompactionAdvisor) Stop() {
+	a.mu.Lock()
+	stop, done := a.stop, a.done
+	a.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	a.stopOnce.Do(func() { close(stop) })
+	<-done
+	a.db.server.unregister(a)
+}
+
+// Sample every interval until stopped
+func (a *CompactionAdvisor) run(interval time.Duration, autoCompact bool, notify func(*CompactionAdvice, error)) {
+	defer close(a.done)
+	clock := a.db.server.clock()
+	for {
+		advice, err := a.Sample()
+		if err == nil && autoCompact && advice.Compact {
+			if err = a.db.Compact(); err == nil {
+				advice.Compacting = true
+			}
+		}
+		if notify != nil {
+			notify(advice, err)
+		}
+		select {
+		case <-a.stop:
+			return
+		case <-clock.After(interval):
+		}
+	}
+}
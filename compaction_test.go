@@ -0,0 +1,60 @@
+package couch_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestCompactionAdvisor(t *testing.T) {
+	t.Parallel()
+	var samples, compactions int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && r.URL.Path == "/people/_compact" {
+			atomic.AddInt32(&compactions, 1)
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"ok":true}`))
+			return
+		}
+		// Every sample the file grows by 1 MB of old revisions
+		n := atomic.AddInt32(&samples, 1)
+		fmt.Fprintf(w, `{"db_name":"people","update_seq":"%d-abc","sizes":{"file":%d,"active":%d}}`, n*10, (n+1)<<20, 1<<20)
+	}))
+	defer ts.Close()
+
+	advisor := couch.NewServer(ts.URL, nil).Database("people").CompactionAdvisor(0.6)
+	advice, err := advisor.Sample()
+	if err != nil {
+		t.Fatal("Sampling returned error:", err)
+	}
+	if advice.Compact || advice.Fragmentation != 0.5 {
+		t.Error("Fragmentation below threshold should not recommend compaction, got", advice)
+	}
+	advice, _ = advisor.Sample()
+	if !advice.Compact || advice.UpdateRate <= 0 || advice.FileGrowth <= 0 {
+		t.Error("Fragmentation above threshold should recommend compaction, got", advice)
+	}
+	if len(advisor.Samples()) != 2 {
+		t.Error("Advisor should keep samples, got", advisor.Samples())
+	}
+
+	notified := make(chan *couch.CompactionAdvice, 10)
+	err = advisor.Start(5*time.Millisecond, true, func(a *couch.CompactionAdvice, err error) {
+		notified <- a
+	})
+	if err != nil {
+		t.Fatal("Starting advisor returned error:", err)
+	}
+	if a := <-notified; !a.Compacting {
+		t.Error("Advisor should compact automatically, got", a)
+	}
+	advisor.Stop()
+	if atomic.LoadInt32(&compactions) == 0 {
+		t.Error("Compaction should have been triggered")
+	}
+}
@@ -1,18 +1,68 @@
 package couch
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
 var (
-	// Design document for conflicts view
+	// Design document for conflicts view, default for databases
+	// that don't configure their own with SetConflictsView()
 	ConflictsDesignID = "conflicts"
 
-	// Name of the view to query documents with conflicts
+	// Name of the view to query documents with conflicts, default for databases
+	// that don't configure their own with SetConflictsView()
 	ConflictsViewID = "all"
 )
 
+// Map function collecting document ids with conflicts
+const defaultConflictsMap = `function(doc) { if (doc._conflicts) { emit(null, null); } }`
+
+// Per-database configuration of the conflicts view
+type conflictsConfig struct {
+	designID string
+	viewID   string
+	mapFn    string
+}
+
+// SetConflictsView configures the design document and view a database uses to find conflicts,
+// instead of the package-wide defaults ConflictsDesignID and ConflictsViewID. mapFn is deployed
+// when the view is created, it must only emit rows for documents with conflicts, e.g.
+//
+//	function(doc) { if (doc._conflicts) { emit(doc.type, null); } }
+//
+// Pass an empty mapFn to use the default map function, which emits null keys.
+func (db *Database) SetConflictsView(designID, viewID, mapFn string) {
+	db.conflicts = conflictsConfig{designID: designID, viewID: viewID, mapFn: mapFn}
+}
+
+// ConflictsView returns the design document and view a database uses to find conflicts.
+func (db *Database) ConflictsView() (designID, viewID string) {
+	designID, viewID = db.conflicts.designID, db.conflicts.viewID
+	if designID == "" {
+		designID = ConflictsDesignID
+	}
+	if viewID == "" {
+		viewID = ConflictsViewID
+	}
+	return
+}
+
+// Map function of the conflicts view
+func (db *Database) conflictsMap() string {
+	if db.conflicts.mapFn == "" {
+		return defaultConflictsMap
+	}
+	return db.conflicts.mapFn
+}
+
+// Checks if the conflicts view of a database exists
+func (db *Database) hasConflictsView() bool {
+	return db.HasView(db.ConflictsView())
+}
+
 // Describes a conflict between different document revisions.
 // Opaque type, use associated methods.
 type Conflict struct {
@@ -34,6 +84,58 @@ func (db *Database) ConflictFor(docID string) (*Conflict, error) {
 	return &Conflict{revisions: openLeaves, docID: docID, db: db}, nil
 }
 
+// DocID returns the id of the conflicted document.
+func (c *Conflict) DocID() string {
+	return c.docID
+}
+
+// Revs returns the revision ids of the conflicting revisions, in the order Revisions() returns
+// them. It returns nil once the conflict has been solved.
+func (c *Conflict) Revs() []string {
+	if !c.isReal() {
+		return nil
+	}
+	revs := make([]string, len(c.revisions))
+	for i, doc := range c.revisions {
+		_, revs[i] = doc.IDRev()
+	}
+	return revs
+}
+
+// Winner returns the revision id CouchDB currently delivers for the document when it's
+// retrieved without a revision. CouchDB picks the revision with the longest history, ties are
+// broken by comparing revision ids, so all replicas agree on it without coordination.
+// Winner returns an empty string once the conflict has been solved.
+func (c *Conflict) Winner() string {
+	var winner string
+	for _, rev := range c.Revs() {
+		if winner == "" || revWins(rev, winner) {
+			winner = rev
+		}
+	}
+	return winner
+}
+
+// Checks if revision a wins over revision b, following CouchDB's deterministic order
+func revWins(a, b string) bool {
+	genA, hashA := splitRev(a)
+	genB, hashB := splitRev(b)
+	if genA != genB {
+		return genA > genB
+	}
+	return hashA > hashB
+}
+
+// Splits a revision id like "2-abc" into its generation and hash
+func splitRev(rev string) (int, string) {
+	parts := strings.SplitN(rev, "-", 2)
+	if len(parts) != 2 {
+		return 0, rev
+	}
+	gen, _ := strconv.Atoi(parts[0])
+	return gen, parts[1]
+}
+
 // Solves a conflict with a final document. It will set the revision id of
 // the document to the final revision id that CouchDB will report once the operation is complete.
 //
@@ -43,6 +145,9 @@ func (db *Database) ConflictFor(docID string) (*Conflict, error) {
 // Be aware that while you solve a conflict, another party might have done so right before
 // you. In this case of a lost update you will receive an error. You should
 // then ask about the state of the conflict again using db.ConflictFor(myDocID).
+//
+// If the database has a conflicts view, it is refreshed afterwards so that
+// ConflictsCount() immediately reflects the solution.
 func (c *Conflict) SolveWith(finalDoc Identifiable) error {
 	if !c.isReal() {
 		return nil
@@ -56,13 +161,51 @@ func (c *Conflict) SolveWith(finalDoc Identifiable) error {
 	leaves.Add(finalDoc)
 
 	// Close all other open branches by marking their leaves deleted
+	losing := c.Revs()[1:]
 	for _, rev := range c.revisions[1:] {
-		rev["_deleted"] = true
+		rev.MarkDeleted()
 		leaves.Add(rev)
 	}
 	_, err := c.db.InsertBulk(leaves, true)
 	if err == nil {
 		c.revisions = nil
+		c.db.refreshConflictsViewIfExists()
+		_, rev = finalDoc.IDRev()
+		c.db.reportResolution(id, ResolvedWithDoc, rev, losing)
+	}
+	return err
+}
+
+// SolveByChoosing solves a conflict by keeping the existing revision revID and deleting the leaves
+// of all other branches, for when one of the conflicting revisions is simply correct. revID must be
+// one of Revs(). As with SolveWith(), the conflict c no longer holds any revisions afterwards and
+// the conflicts view, if the database has one, is refreshed.
+func (c *Conflict) SolveByChoosing(revID string, opts ...Option) error {
+	if !c.isReal() {
+		return nil
+	}
+	chosen := false
+	leaves := new(Bulk)
+	var losing []string
+	for _, doc := range c.revisions {
+		id, rev := doc.IDRev()
+		if rev == revID {
+			chosen = true
+			continue
+		}
+		tombstone := DynamicDoc{"_deleted": true}
+		tombstone.SetIDRev(id, rev)
+		leaves.Add(tombstone)
+		losing = append(losing, rev)
+	}
+	if !chosen {
+		return fmt.Errorf("couch: revision %s is not one of the conflicting revisions of %s", revID, c.docID)
+	}
+	_, err := c.db.InsertBulk(leaves, true, opts...)
+	if err == nil {
+		c.revisions = nil
+		c.db.refreshConflictsViewIfExists()
+		c.db.reportResolution(c.docID, ResolvedByChoosing, revID, losing)
 	}
 	return err
 }
@@ -78,14 +221,20 @@ func (c *Conflict) SolveWith(finalDoc Identifiable) error {
 //  var revs interface{}
 //  var revs []map[string]interface{}
 //
-// Note that map[string]interface{} will not work.
-func (c *Conflict) Revisions(v interface{}) {
+// Note that map[string]interface{} will not work. Revisions that don't fit v, e.g.
+// because of a type mismatch, are reported as an error. Pass StrictDecode() to also
+// report fields v has no place for.
+func (c *Conflict) Revisions(v interface{}, opts ...Option) error {
 	// Converting []map[string]interface{} to a type provided by the user.
 	// Using Marshal/Unmarshal is not exactly a great solution but still
 	// faster and less memory intensive than e.g. the mapstructure package.
 	// Alternative?
-	tmp, _ := json.Marshal(c.revisions)
-	json.Unmarshal(tmp, v)
+	codec := newCallOptions(withOptions([]Option{decodeWith(c.db.Codec())}, opts...)).decoder()
+	tmp, err := codec.Marshal(c.revisions)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(tmp, v)
 }
 
 // IsReal checks if there are really conflicting revisions to solve.
@@ -94,12 +243,12 @@ func (c *Conflict) isReal() bool {
 }
 
 // Returns all conflicts in a database. To do so, a dedicated view is necessary at
-// [db-url]/_design/conflicts/_view/all. If it doesn't exist and forceView is enabled,
-// it will be automatically set up.
+// [db-url]/_design/conflicts/_view/all, see SetConflictsView() to configure a different one.
+// If it doesn't exist and forceView is enabled, it will be automatically set up.
 //
 // Note, that if the database is already large at that point, this operation can take
 // a very long time. It's recommended to call this method or ConflictsCount() right after
-// creating a new database.
+// creating a new database. Use IterateConflicts() for databases with many conflicts.
 func (db *Database) Conflicts(forceView bool) (docIDs []string, err error) {
 	result, err := db.queryConflictView(forceView, false)
 	if err != nil {
@@ -121,7 +270,8 @@ func (db *Database) ConflictsCount(forceView bool) (int, error) {
 		return 0, err
 	}
 	if len(result.Rows) > 0 {
-		return result.Rows[0].ValueInt(), nil
+		count, err := result.Rows[0].ValueFloat()
+		return int(count), err
 	}
 	return 0, nil
 }
@@ -129,18 +279,41 @@ func (db *Database) ConflictsCount(forceView bool) (int, error) {
 func (db *Database) queryConflictView(forceView bool, reduce bool) (*ViewResult, error) {
 	options := map[string]interface{}{
 		"reduce": reduce,
+		"update": true,
 	}
 	err := db.ensureConflictView(forceView)
 	if err != nil {
 		return nil, err
 	}
-	result, err := db.Query(ConflictsDesignID, ConflictsViewID, options)
+	designID, viewID := db.ConflictsView()
+	result, err := db.Query(designID, viewID, options)
 	return result, err
 }
 
+// RefreshConflictsView brings the conflicts view up to date, e.g. after conflicts have been
+// solved or documents have been purged. It returns an error if the view doesn't exist.
+func (db *Database) RefreshConflictsView() error {
+	options := map[string]interface{}{
+		"reduce": false,
+		"update": true,
+		"limit":  0,
+	}
+	designID, viewID := db.ConflictsView()
+	_, err := db.Query(designID, viewID, options)
+	return err
+}
+
+// Refresh the conflicts view after documents changed, databases without the view are
+// left alone. Errors only go to the error handler, the view will be updated by the next query anyway.
+func (db *Database) refreshConflictsViewIfExists() {
+	if db.hasConflictsView() {
+		db.server.handleError(db.RefreshConflictsView())
+	}
+}
+
 // Make sure a conflict view exist, if not, create it if forceView is enabled
 func (db *Database) ensureConflictView(forceView bool) error {
-	if db.HasView(ConflictsDesignID, ConflictsViewID) {
+	if db.hasConflictsView() {
 		return nil
 	}
 	if !forceView {
@@ -151,16 +324,11 @@ func (db *Database) ensureConflictView(forceView bool) error {
 }
 
 // Inserts a design document with a view containting a map function to collect
-// document ids with conflicts and a reduce function to count them.
+// document ids with conflicts and a reduce function to count them. Other views
+// of the design document are kept.
 func (db *Database) createConflictView() error {
-	view := view{}
-	view.Map = `function(doc) { if (doc._conflicts) { emit(null, null); } }`
-	view.Reduce = `_count`
-	design := newDesign()
-	design.Views["all"] = view
-	design.SetIDRev("_design/"+ConflictsDesignID, "")
-	err := db.Insert(design)
-	return err
+	designID, viewID := db.ConflictsView()
+	return db.ensureView(designID, viewID, View{Map: db.conflictsMap(), Reduce: "_count"}, nil)
 }
 
 // Used to read out CouchDBs answer to open_revs and filter by 'ok' field (=available revision)
@@ -173,7 +341,7 @@ type openRevision struct {
 func (db *Database) openRevsFor(docID string) ([]openRevision, error) {
 	params := map[string]interface{}{"open_revs": "all"}
 	var revs []openRevision
-	err := db.retrieve(docID, "", &revs, params)
+	err := db.retrieve(docID, "", &revs, params, nil)
 	return revs, err
 }
 
@@ -181,8 +349,7 @@ func (db *Database) openRevsFor(docID string) ([]openRevision, error) {
 func filterOpenLeafDocs(revs []openRevision) []DynamicDoc {
 	var openRevs []DynamicDoc
 	for _, rev := range revs {
-		del, ok := rev.Doc["_deleted"]
-		if !ok || del == false {
+		if !rev.Doc.IsDeleted() {
 			openRevs = append(openRevs, rev.Doc)
 		}
 	}
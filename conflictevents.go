@@ -0,0 +1,89 @@
+package couch
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Number of changes a conflict stream asks for at once
+const conflictEventsBatch = 100
+
+// ConflictEvent reports a change that left a document in conflict. Err is set if the stream
+// ended because of a failed request or a closed server, it is the last event then.
+type ConflictEvent struct {
+	DocID     string
+	Seq       Seq
+	Winner    string   // Revision CouchDB delivers for the document
+	Conflicts []string // Other open revisions, losing against Winner
+	Err       error
+}
+
+// Revisions of a document in a change, as delivered with conflicts=true
+type conflictingDoc struct {
+	Rev       string   `json:"_rev"`
+	Deleted   bool     `json:"_deleted"`
+	Conflicts []string `json:"_conflicts"`
+}
+
+// ConflictEvents streams conflicts as they are created, e.g. by replications, so that a resolution
+// daemon can react to them instead of polling the conflicts view. It follows the changes of the
+// database from now on and reports every change that leaves a document in conflict, a document
+// changed again before it is solved is reported again. Use db.ConflictFor() to solve a conflict.
+// The channel is closed when ctx is done or after an event carrying an error.
+func (db *Database) ConflictEvents(ctx context.Context, opts ...Option) <-chan ConflictEvent {
+	events := make(chan ConflictEvent)
+	go db.streamConflicts(ctx, events, withOptions(opts, WithContext(ctx)))
+	return events
+}
+
+// Follow changes and send conflicts until ctx is done or a request fails
+func (db *Database) streamConflicts(ctx context.Context, events chan<- ConflictEvent, opts []Option) {
+	defer close(events)
+	send := func(e ConflictEvent) bool {
+		select {
+		case events <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	options := ChangesOptions{Since: SinceNow, IncludeDocs: true, Conflicts: true, Limit: conflictEventsBatch}
+	for {
+		result, err := db.Changes(&options, opts...)
+		if err != nil {
+			if ctx.Err() == nil {
+				send(ConflictEvent{Err: err})
+			}
+			return
+		}
+		for _, change := range result.Results {
+			if e, ok := conflictEvent(change); ok && !send(e) {
+				return
+			}
+		}
+		options.Since = result.LastSeq
+		if len(result.Results) == conflictEventsBatch {
+			continue // Not caught up yet
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-db.server.done():
+			send(ConflictEvent{Err: ErrServerClosed})
+			return
+		case <-db.server.clock().After(defaultPollInterval):
+		}
+	}
+}
+
+// Conflict reported by a change, if the changed document is in conflict
+func conflictEvent(change ChangeEvent) (ConflictEvent, bool) {
+	var doc conflictingDoc
+	if len(change.Doc) == 0 || json.Unmarshal(change.Doc, &doc) != nil {
+		return ConflictEvent{}, false
+	}
+	if doc.Deleted || len(doc.Conflicts) == 0 {
+		return ConflictEvent{}, false
+	}
+	return ConflictEvent{DocID: change.ID, Seq: change.Seq, Winner: doc.Rev, Conflicts: doc.Conflicts}, true
+}
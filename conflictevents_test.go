@@ -0,0 +1,61 @@
+package couch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestConflictEvents(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("include_docs") != "true" || q.Get("conflicts") != "true" {
+			t.Error("Conflicts should be requested with the documents, got", r.URL.RawQuery)
+		}
+		if q.Get("since") != "now" {
+			w.Write([]byte(`{"results": [], "last_seq": "3-c"}`))
+			return
+		}
+		w.Write([]byte(`{"results": [
+			{"id": "anna", "seq": "1-a", "changes": [{"rev": "2-a"}], "doc": {"_id": "anna", "_rev": "2-a"}},
+			{"id": "bert", "seq": "2-b", "changes": [{"rev": "3-b"}], "doc": {"_id": "bert", "_rev": "3-b", "_conflicts": ["3-a", "2-c"]}},
+			{"id": "carl", "seq": "3-c", "deleted": true, "changes": [{"rev": "4-c"}], "doc": {"_id": "carl", "_rev": "4-c", "_deleted": true}}
+		], "last_seq": "3-c"}`))
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	ctx, cancel := context.WithCancel(context.Background())
+	events := db.ConflictEvents(ctx)
+	e := <-events
+	if e.Err != nil || e.DocID != "bert" || e.Seq != "2-b" || e.Winner != "3-b" || len(e.Conflicts) != 2 {
+		t.Error("Only the conflicted document should be reported, got", e)
+	}
+	cancel()
+	for e := range events {
+		t.Error("Stream should end quietly when the context is done, got", e)
+	}
+}
+
+func TestConflictEventsError(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "unauthorized", "reason": "You are not authorized to access this db."}`))
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	var errs []error
+	for e := range db.ConflictEvents(context.Background()) {
+		errs = append(errs, e.Err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], couch.ErrUnauthorized) {
+		t.Error("Stream should end with the error of the failed request, got", errs)
+	}
+}
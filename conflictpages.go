@@ -0,0 +1,113 @@
+package couch
+
+import "encoding/json"
+
+// Size of the first page of conflicts, every further page is twice as large up to
+// maxConflictsPageSize, so that the first conflicts arrive quickly and large databases
+// are still read with few requests
+const (
+	firstConflictsPageSize = 100
+	maxConflictsPageSize   = 10000
+)
+
+// ConflictIterator pages through the documents with conflicts of a database, see IterateConflicts().
+type ConflictIterator struct {
+	db        *Database
+	forceView bool
+	opts      []Option
+	pageSize  int
+	maxSize   int
+
+	ids      []string
+	current  string
+	startKey string // Json encoded key of the last row, empty before the first page
+	startID  string
+	last     bool
+	err      error
+}
+
+// IterateConflicts returns an iterator over the ids of all documents with conflicts, reading the
+// conflicts view in pages instead of loading it with a single request like Conflicts() does. Pages
+// grow from 100 to 10000 rows, pass WithBatchSize() to change the largest one:
+//
+//	it := db.IterateConflicts(true)
+//	for it.Next() {
+//		c, err := db.ConflictFor(it.DocID())
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// See Conflicts() for the view and forceView.
+func (db *Database) IterateConflicts(forceView bool, opts ...Option) *ConflictIterator {
+	maxSize := newCallOptions(opts).batchSize
+	if maxSize <= 0 {
+		maxSize = maxConflictsPageSize
+	}
+	pageSize := firstConflictsPageSize
+	if pageSize > maxSize {
+		pageSize = maxSize
+	}
+	return &ConflictIterator{db: db, forceView: forceView, opts: opts, pageSize: pageSize, maxSize: maxSize}
+}
+
+// Next advances to the next document with conflicts, it returns false when there are no more
+// or a request failed, see Err().
+func (it *ConflictIterator) Next() bool {
+	for len(it.ids) == 0 {
+		if it.last || it.err != nil {
+			return false
+		}
+		it.err = it.fetch()
+	}
+	it.current, it.ids = it.ids[0], it.ids[1:]
+	return true
+}
+
+// DocID returns the id of the current document.
+func (it *ConflictIterator) DocID() string {
+	return it.current
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *ConflictIterator) Err() error {
+	return it.err
+}
+
+// Read the next page of the conflicts view, continuing after the last row of the previous one
+func (it *ConflictIterator) fetch() error {
+	options := map[string]interface{}{
+		"reduce": false,
+		"limit":  it.pageSize,
+	}
+	if it.startKey == "" {
+		if err := it.db.ensureConflictView(it.forceView); err != nil {
+			return err
+		}
+	} else {
+		options["startkey"] = it.startKey
+		options["startkey_docid"] = it.startID
+		options["skip"] = 1
+	}
+	designID, viewID := it.db.ConflictsView()
+	result, err := it.db.Query(designID, viewID, options, it.opts...)
+	if err != nil {
+		return err
+	}
+	it.last = len(result.Rows) < it.pageSize
+	for _, row := range result.Rows {
+		it.ids = append(it.ids, row.ID)
+	}
+	if n := len(result.Rows); n > 0 {
+		key, err := json.Marshal(result.Rows[n-1].Key)
+		if err != nil {
+			return err
+		}
+		it.startKey, it.startID = string(key), result.Rows[n-1].ID
+	}
+	if it.pageSize *= 2; it.pageSize > it.maxSize {
+		it.pageSize = it.maxSize
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Serves a conflicts view with n rows, keyed by type like a custom map function would, and
+// records the limit of every query
+func conflictsViewServer(t *testing.T, n int, limits *[]int, mu *sync.Mutex) *httptest.Server {
+	type row struct {
+		Key string `json:"key"`
+		ID  string `json:"id"`
+	}
+	var rows []row
+	for _, key := range []string{"car", "person"} {
+		for i := 0; i < n/2; i++ {
+			rows = append(rows, row{Key: key, ID: fmt.Sprintf("%s-%04d", key, i)})
+		}
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			return
+		}
+		q := r.URL.Query()
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		mu.Lock()
+		*limits = append(*limits, limit)
+		mu.Unlock()
+		start := 0
+		if q.Get("startkey") != "" {
+			var key string
+			if err := json.Unmarshal([]byte(q.Get("startkey")), &key); err != nil {
+				t.Error("Start key should be json, got", q.Get("startkey"))
+			}
+			for start < len(rows) && (rows[start].Key < key || rows[start].Key == key && rows[start].ID < q.Get("startkey_docid")) {
+				start++
+			}
+			skip, _ := strconv.Atoi(q.Get("skip"))
+			start += skip
+		}
+		end := start + limit
+		if end > len(rows) {
+			end = len(rows)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"total_rows": len(rows), "rows": rows[start:end]})
+	}))
+}
+
+func TestIterateConflicts(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var limits []int
+	server := conflictsViewServer(t, 1000, &limits, &mu)
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	seen := make(map[string]bool)
+	it := db.IterateConflicts(false, couch.WithBatchSize(300))
+	for it.Next() {
+		if seen[it.DocID()] {
+			t.Error("Document returned twice:", it.DocID())
+		}
+		seen[it.DocID()] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal("Iterating conflicts returned error:", err)
+	}
+	if len(seen) != 1000 {
+		t.Error("Expected 1000 documents with conflicts, got", len(seen))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(limits) != "[100 200 300 300 300]" {
+		t.Error("Pages should grow up to the batch size, got", limits)
+	}
+}
+
+func TestIterateConflictsError(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	it := db.IterateConflicts(false)
+	if it.Next() || it.Err() == nil {
+		t.Error("Iterating without a conflicts view should fail")
+	}
+}
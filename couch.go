@@ -2,6 +2,7 @@ package couch
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,12 +10,32 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Server represents a CouchDB instance.
 type Server struct {
-	url  string
-	cred *Credentials
+	url        string
+	cred       *Credentials
+	timeout    time.Duration
+	logger     Logger
+	onError    ErrorHandler
+	client     *http.Client
+	replAuth   ReplicationAuth
+	life       lifecycle
+	canary     string
+	dbPrefix   string
+	userAgent  string
+	clientName string
+	journal    *journal
+	clk        Clock
+	retry      Backoff
+	session    *session
+	welcome    welcomeCache
+
+	sessionStore SessionStore
 }
 
 // NewServer returns a handle to a CouchDB instance.
@@ -22,6 +43,53 @@ func NewServer(url string, cred *Credentials) *Server {
 	return &Server{url: url, cred: cred}
 }
 
+// SetTimeout sets a default time limit for calls to the server, including reading the
+// response. It applies to all databases of the server, 0 (the default) means no limit.
+// Single calls can override it with WithTimeout(). Starting a replication is exempt
+// since it can take arbitrarily long.
+func (s *Server) SetTimeout(d time.Duration) {
+	s.timeout = d
+}
+
+// SetHTTPClient sets the HTTP client used for all calls to the server and its databases,
+// e.g. to configure TLS or a proxy. nil (the default) means http.DefaultClient.
+func (s *Server) SetHTTPClient(c *http.Client) {
+	s.client = c
+}
+
+// SetDatabasePrefix sets a prefix for the names of all databases of a server, e.g. "staging_", so
+// that several environments can share a server. Database names stay the same in code, the prefix
+// is only added to URLs, including those in replications, and removed by AllDatabases(). System
+// databases like _replicator are not prefixed.
+func (s *Server) SetDatabasePrefix(prefix string) {
+	s.dbPrefix = prefix
+}
+
+// Name of a database on the server, including the prefix unless it is a system database
+func (s *Server) qualifiedName(name string) string {
+	if strings.HasPrefix(name, "_") {
+		return name
+	}
+	return s.dbPrefix + name
+}
+
+// AllDatabases returns the names of all databases of a server. If the server has a prefix,
+// only databases with the prefix are returned, without it.
+func (s *Server) AllDatabases(opts ...Option) ([]string, error) {
+	var all []string
+	_, err := do(s.URL()+"/_all_dbs", "GET", s.Cred(), nil, &all, s.withDefaults(opts))
+	if err != nil || s.dbPrefix == "" {
+		return all, err
+	}
+	names := make([]string, 0, len(all))
+	for _, name := range all {
+		if strings.HasPrefix(name, s.dbPrefix) {
+			names = append(names, strings.TrimPrefix(name, s.dbPrefix))
+		}
+	}
+	return names, nil
+}
+
 // Database returns a reference to a database. This method will
 // not check if the database really exists.
 func (s *Server) Database(name string) *Database {
@@ -38,10 +106,16 @@ func (s *Server) Cred() *Credentials {
 	return s.cred
 }
 
+// Check whether a CouchDB instance is reachable and answers requests
+func (s *Server) ping(opts ...Option) error {
+	_, err := do(s.URL()+"/", "GET", s.Cred(), nil, nil, s.withDefaults(opts))
+	return err
+}
+
 // ActiveTasks returns all currently active tasks of a CouchDB instance.
-func (s *Server) ActiveTasks() ([]Task, error) {
+func (s *Server) ActiveTasks(opts ...Option) ([]Task, error) {
 	var tasks []Task
-	_, err := Do(s.URL()+"/_active_tasks", "GET", s.Cred(), nil, &tasks)
+	_, err := do(s.URL()+"/_active_tasks", "GET", s.Cred(), nil, &tasks, s.withDefaults(opts))
 	return tasks, err
 }
 
@@ -67,11 +141,23 @@ type Identifiable interface {
 	IDRev() (id string, rev string)
 }
 
+// Deletable is implemented by documents that know whether they are deleted, Doc and
+// DynamicDoc do. Inserting a document marked as deleted deletes it, like Delete() does.
+type Deletable interface {
+
+	// IsDeleted returns whether the document is marked as deleted
+	IsDeleted() bool
+
+	// MarkDeleted marks the document as deleted
+	MarkDeleted()
+}
+
 // Doc defines a basic struct for CouchDB documents. Add it
 // as an anonymous field to your custom struct.
 type Doc struct {
-	ID  string `json:"_id,omitempty"`
-	Rev string `json:"_rev,omitempty"`
+	ID      string `json:"_id,omitempty"`
+	Rev     string `json:"_rev,omitempty"`
+	Deleted bool   `json:"_deleted,omitempty"`
 }
 
 // Implement Identifiable
@@ -85,10 +171,33 @@ func (ref *Doc) IDRev() (id string, rev string) {
 	return
 }
 
+// Implement Deletable
+func (ref *Doc) IsDeleted() bool {
+	return ref.Deleted
+}
+
+// Implement Deletable
+func (ref *Doc) MarkDeleted() {
+	ref.Deleted = true
+}
+
 // DynamicDoc can be used for CouchDB documents without
-// any implicit schema.
+// any implicit schema. Numbers are decoded as json.Number instead of float64,
+// so that integers beyond 2^53 survive a round trip unchanged.
 type DynamicDoc map[string]interface{}
 
+// UnmarshalJSON implements json.Unmarshaler, keeping numbers as json.Number.
+func (m *DynamicDoc) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return err
+	}
+	*m = fields
+	return nil
+}
+
 // Implement Identifiable
 func (m DynamicDoc) IDRev() (id string, rev string) {
 	id, _ = m["_id"].(string)
@@ -99,18 +208,64 @@ func (m DynamicDoc) IDRev() (id string, rev string) {
 // Implement Identifiable
 func (m DynamicDoc) SetIDRev(id string, rev string) {
 	m["_id"] = id
+	if rev == "" {
+		delete(m, "_rev")
+		return
+	}
 	m["_rev"] = rev
 }
 
+// Implement Deletable
+func (m DynamicDoc) IsDeleted() bool {
+	deleted, _ := m["_deleted"].(bool)
+	return deleted
+}
+
+// Implement Deletable
+func (m DynamicDoc) MarkDeleted() {
+	m["_deleted"] = true
+}
+
+// Document kept in its original JSON encoding, used where documents are
+// written back without interpreting their content
+type rawDoc map[string]json.RawMessage
+
+// Implement Identifiable
+func (m rawDoc) IDRev() (id string, rev string) {
+	json.Unmarshal(m["_id"], &id)
+	json.Unmarshal(m["_rev"], &rev)
+	return
+}
+
+// Implement Identifiable
+func (m rawDoc) SetIDRev(id string, rev string) {
+	m["_id"], _ = json.Marshal(id)
+	if rev == "" {
+		delete(m, "_rev")
+		return
+	}
+	m["_rev"], _ = json.Marshal(rev)
+}
+
 // Task describes an active task running on an instance,
-// like a continuous replication or indexing.
+// like a continuous replication or indexing. Use Decode() or
+// Server.TasksByType() to work with typed fields.
 type Task map[string]interface{}
 
 // Database represents a database of a CouchDB instance.
 type Database struct {
-	name   string
-	cred   *Credentials
-	server *Server
+	name        string
+	cred        *Credentials
+	server      *Server
+	idGen       IDGenerator
+	parentField string
+	conflicts   conflictsConfig
+	docCodec    Codec
+	slowLog     *slowQueryLog
+	quota       *quotaGuard
+	cache       *queryCache
+	onResolved  func(ConflictResolution)
+	sizeWarn    *sizeWarning
 }
 
 // Cred returns the credentials associated with the database. If there aren't any
@@ -132,24 +287,36 @@ func (db *Database) Server() *Server {
 	return db.server
 }
 
-// Create a new database on the CouchDB instance.
-func (db *Database) Create() error {
-	_, err := Do(db.URL(), "PUT", db.Cred(), nil, nil)
+// Create a new database on the CouchDB instance. If the name of the database
+// violates CouchDB's naming rules, an *InvalidNameError is returned without contacting the server.
+func (db *Database) Create(opts ...Option) error {
+	if err := validateDBName(db.server.qualifiedName(db.name)); err != nil {
+		return err
+	}
+	_, err := do(db.URL(), "PUT", db.Cred(), nil, nil, db.server.withDefaults(opts))
 	return err
 }
 
 // DropDatabase deletes a database.
-func (db *Database) DropDatabase() error {
-	_, err := Do(db.URL(), "DELETE", db.Cred(), nil, nil)
+func (db *Database) DropDatabase(opts ...Option) error {
+	_, err := do(db.URL(), "DELETE", db.Cred(), nil, nil, db.server.withDefaults(opts))
 	return err
 }
 
-// Exists returns true if a database really exists.
+// Exists returns true if a database really exists. Errors are passed to the error handler of the server,
+// use ExistsErr() to tell a missing database from an unreachable server.
 func (db *Database) Exists() bool {
-	exists, _ := checkHead(db.URL())
+	exists, err := db.ExistsErr()
+	db.server.handleError(err)
 	return exists
 }
 
+// ExistsErr returns true if a database exists and false if it doesn't. Other failures,
+// like an unreachable server or missing permissions, are returned as an error.
+func (db *Database) ExistsErr(opts ...Option) (bool, error) {
+	return checkHead(db.URL(), db.Cred(), db.server.withDefaults(opts))
+}
+
 // CouchDB result of document insert
 type insertResult struct {
 	ID  string
@@ -159,14 +326,58 @@ type insertResult struct {
 
 // Insert a document as follows: If doc has an ID, it will edit the existing document,
 // if not, create a new one. In case of an edit, the doc will be assigned the new revision id.
-func (db *Database) Insert(doc Identifiable) error {
-	var result insertResult
+// Reserved ids starting with an underscore (other than _design/ and _local/) are rejected
+// with an *InvalidIDError. See SetIDGenerator() to assign ids to new documents client-side
+// and WithMerge() to resolve conflicts while writing.
+func (db *Database) Insert(doc Identifiable, opts ...Option) error {
 	var err error
 	id, _ := doc.IDRev()
+	if err = validateDocID(id); err != nil {
+		return err
+	}
+	if id == "" && db.idGen != nil {
+		if id, err = db.idGen(); err != nil {
+			return err
+		}
+		doc.SetIDRev(id, "")
+	}
+	o := newCallOptions(opts)
+	err = db.insert(doc, opts)
+	merged := false
+	for attempt := 0; errors.Is(err, ErrConflict) && attempt < o.mergeRetries; attempt++ {
+		resolved, resolveErr := db.resolveConflict(doc, o.merge, opts)
+		if resolveErr != nil {
+			return resolveErr
+		}
+		if resolved == nil {
+			return err
+		}
+		doc, merged = resolved, true
+		err = db.insert(doc, opts)
+	}
+	if err == nil && merged {
+		id, rev := doc.IDRev()
+		db.reportResolution(id, ResolvedByMerge, rev, nil)
+	}
+	return err
+}
+
+// Write a single document and update it with its id and revision id
+func (db *Database) insert(doc Identifiable, opts []Option) error {
+	var result insertResult
+	if err := db.checkQuota([]Identifiable{doc}, opts); err != nil {
+		return err
+	}
+	id, _ := doc.IDRev()
+	body, err := db.encodeDoc(doc)
+	if err != nil {
+		return err
+	}
+	db.checkDocSize(doc, body)
 	if id == "" {
-		_, err = Do(db.URL(), "POST", db.Cred(), doc, &result)
+		_, err = do(db.URL(), "POST", db.Cred(), body, &result, db.server.withDefaults(opts))
 	} else {
-		_, err = Do(db.docURL(id), "PUT", db.Cred(), doc, &result)
+		_, err = do(db.docURL(id), "PUT", db.Cred(), body, &result, db.server.withDefaults(opts))
 	}
 	if err != nil {
 		return err
@@ -176,15 +387,45 @@ func (db *Database) Insert(doc Identifiable) error {
 }
 
 // Delete removes a document from the database.
-func (db *Database) Delete(docID, revID string) error {
+func (db *Database) Delete(docID, revID string, opts ...Option) error {
+	if err := validateDocID(docID); err != nil {
+		return err
+	}
 	url := db.docURL(docID) + `?rev=` + revID
-	_, err := Do(url, "DELETE", db.Cred(), nil, nil)
+	_, err := do(url, "DELETE", db.Cred(), nil, nil, db.server.withDefaults(opts))
 	return err
 }
 
+// CouchDB result of purge
+type purgeResult struct {
+	Purged map[string][]string `json:"purged"`
+}
+
+// Purge removes revisions of a document from the database entirely, as if they had never
+// existed. Unlike deleted revisions, purged ones are not replicated. Returns the revision
+// ids that have been purged. If the database has a conflicts view, it is refreshed afterwards.
+func (db *Database) Purge(docID string, revIDs []string, opts ...Option) ([]string, error) {
+	if err := validateDocID(docID); err != nil {
+		return nil, err
+	}
+	purged, err := db.purge(map[string][]string{docID: revIDs}, opts)
+	if err != nil {
+		return nil, err
+	}
+	db.refreshConflictsViewIfExists()
+	return purged[docID], nil
+}
+
+// Purge revisions of any number of documents, returns the purged revisions by document id
+func (db *Database) purge(revs map[string][]string, opts []Option) (map[string][]string, error) {
+	var result purgeResult
+	_, err := do(db.URL()+"/_purge", "POST", db.Cred(), revs, &result, db.server.withDefaults(opts))
+	return result.Purged, err
+}
+
 // Url returns the absolute url to a database
 func (db *Database) URL() string {
-	return db.server.url + "/" + db.name
+	return db.server.url + "/" + db.server.qualifiedName(db.name)
 }
 
 // DocUrl returns the absolute url to a document
@@ -197,18 +438,40 @@ func (db *Database) Name() string {
 	return db.name
 }
 
-// Retrieve gets the latest revision of a document, the result will be written into doc
-func (db *Database) Retrieve(docID string, doc Identifiable) error {
-	return db.retrieve(docID, "", doc, nil)
+// NotFoundError is returned when a document can't be retrieved. Deleted tells apart documents
+// that have been deleted from ones that never existed. ErrorType() reports "not_found" for it.
+type NotFoundError struct {
+	ID      string
+	Deleted bool
+	err     couchError
+}
+
+// Error implements the error interface.
+func (e *NotFoundError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying CouchDB error.
+func (e *NotFoundError) Unwrap() error {
+	return e.err
+}
+
+// Retrieve gets the latest revision of a document, the result will be written into doc.
+// If the document doesn't exist or has been deleted, a *NotFoundError is returned.
+func (db *Database) Retrieve(docID string, doc Identifiable, opts ...Option) error {
+	return db.retrieve(docID, "", doc, nil, opts)
 }
 
 // RetrieveRevision gets a specific revision of a document, the result will be written into doc
-func (db *Database) RetrieveRevision(docID, revID string, doc Identifiable) error {
-	return db.retrieve(docID, revID, doc, nil)
+func (db *Database) RetrieveRevision(docID, revID string, doc Identifiable, opts ...Option) error {
+	return db.retrieve(docID, revID, doc, nil, opts)
 }
 
 // Generic method to get one or more documents
-func (db *Database) retrieve(id, revID string, doc interface{}, options map[string]interface{}) error {
+func (db *Database) retrieve(id, revID string, doc interface{}, options map[string]interface{}, opts []Option) error {
+	if err := validateDocID(id); err != nil {
+		return err
+	}
 	if revID != "" {
 		if options == nil {
 			options = make(map[string]interface{})
@@ -216,7 +479,10 @@ func (db *Database) retrieve(id, revID string, doc interface{}, options map[stri
 		options["rev"] = revID
 	}
 	url := db.docURL(id) + urlEncode(options)
-	_, err := Do(url, "GET", db.Cred(), nil, &doc)
+	_, err := do(url, "GET", db.Cred(), nil, doc, withOptions(db.server.withDefaults(opts), decodeWith(db.Codec())))
+	if cErr, ok := err.(couchError); ok && cErr.Type == "not_found" {
+		return &NotFoundError{ID: id, Deleted: cErr.Reason == "deleted", err: cErr}
+	}
 	return err
 }
 
@@ -242,6 +508,12 @@ func (bulk *Bulk) Find(id, rev string) Identifiable {
 	return nil
 }
 
+// Bulk with documents encoded by the codec of a database
+type encodedBulk struct {
+	Docs         []json.RawMessage `json:"docs"`
+	AllOrNothing bool              `json:"all_or_nothing"`
+}
+
 // CouchDB result of bulk insert
 type bulkResult struct {
 	ID     string
@@ -255,100 +527,492 @@ type bulkResult struct {
 // or per-document. See http://docs.couchdb.org/en/latest/api/database/bulk-api.html#bulk-documents-transaction-semantics
 // After the transaction the method may return a new bulk of documents that couldn't be inserted.
 // If this is the case you will still get an error reporting the issue.
-func (db *Database) InsertBulk(bulk *Bulk, allOrNothing bool) (*Bulk, error) {
-	var results []bulkResult
-	bulk.AllOrNothing = allOrNothing
-	_, err := Do(db.URL()+"/_bulk_docs", "POST", db.Cred(), bulk, &results)
+//
+// Pass WithBatchSize() to send large bulks in several requests, the semantics then apply to each
+// batch. If a request fails, e.g. because the deadline of the context passed to WithContext()
+// is exceeded, a *BatchError tells how many batches have been written and the returned bulk
+// also holds the documents of all batches from the failed one on, so that it can be inserted
+// again to resume.
+func (db *Database) InsertBulk(bulk *Bulk, allOrNothing bool, opts ...Option) (*Bulk, error) {
+	for _, doc := range bulk.Docs {
+		id, _ := doc.IDRev()
+		if err := validateDocID(id); err != nil {
+			return bulk, err
+		}
+	}
+	o := newCallOptions(opts)
+	batches := bulk.split(o.batchSize)
 
-	// Update documents in bulk with ids and rev ids,
-	// compile bulk of failed documents
+	// Compile bulk of failed documents
 	failedDocs := new(Bulk)
+	for i, batch := range batches {
+		results, err := db.insertBulk(batch, allOrNothing, opts)
+		if err != nil {
+			if o.batchSize <= 0 {
+				return failedDocs, err
+			}
+			for _, unsent := range batches[i:] {
+				failedDocs.Docs = append(failedDocs.Docs, unsent.Docs...)
+			}
+			return failedDocs, &BatchError{Committed: i, Err: err}
+		}
+		for j, result := range results {
+			if !result.Ok {
+				failedDocs.Add(batch.Docs[j])
+			}
+		}
+	}
+	if len(failedDocs.Docs) > 0 {
+		return failedDocs, errors.New("bulk insert incomplete")
+	}
+	return failedDocs, nil
+}
+
+// Split a bulk into batches of at most size documents, a size of 0 or less means a single batch
+func (bulk *Bulk) split(size int) []*Bulk {
+	if size <= 0 || len(bulk.Docs) <= size {
+		return []*Bulk{bulk}
+	}
+	var batches []*Bulk
+	for start := 0; start < len(bulk.Docs); start += size {
+		end := start + size
+		if end > len(bulk.Docs) {
+			end = len(bulk.Docs)
+		}
+		batches = append(batches, &Bulk{Docs: bulk.Docs[start:end], AllOrNothing: bulk.AllOrNothing})
+	}
+	return batches
+}
+
+// BatchError is returned when a mass operation working in batches stops early because a request
+// failed, e.g. because the deadline of its context passed. Batches are written in order, the first
+// Committed batches are complete, later ones haven't been written. The outcome of the batch whose
+// request failed is unknown, CouchDB might have written it anyway.
+type BatchError struct {
+	Committed int
+	Err       error
+}
+
+// Error implements the error interface.
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("couch: stopped after %d batches: %v", e.Committed, e.Err)
+}
+
+// Unwrap returns the error the operation stopped with.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Send a bulk to CouchDB and update documents in bulk with ids and rev ids
+func (db *Database) insertBulk(bulk *Bulk, allOrNothing bool, opts []Option) ([]bulkResult, error) {
+	var results []bulkResult
+	if err := db.checkQuota(bulk.Docs, opts); err != nil {
+		return nil, err
+	}
+	bulk.AllOrNothing = allOrNothing
+	body := encodedBulk{AllOrNothing: allOrNothing}
+	for _, doc := range bulk.Docs {
+		enc, err := db.encodeDoc(doc)
+		if err != nil {
+			return nil, err
+		}
+		db.checkDocSize(doc, enc)
+		body.Docs = append(body.Docs, enc)
+	}
+	_, err := do(db.URL()+"/_bulk_docs", "POST", db.Cred(), body, &results, db.server.withDefaults(opts))
 	for i, result := range results {
 		if result.Ok {
 			bulk.Docs[i].SetIDRev(result.ID, result.Rev)
-		} else {
-			failedDocs.Add(bulk.Docs[i])
 		}
 	}
-	if len(failedDocs.Docs) > 0 {
-		err = errors.New("bulk insert incomplete")
+	return results, err
+}
+
+// Error reported by CouchDB for a single document of a bulk
+func (r bulkResult) err() error {
+	if r.Ok {
+		return nil
 	}
+	return couchError{Type: r.Error, Reason: r.Reason}
+}
 
-	return failedDocs, err
+// BulkResolver is called for every document of a bulk that couldn't be written because
+// of a conflict. It receives the document and the latest revision stored in the database,
+// which is nil if that revision has been deleted. It returns the document to write instead,
+// typically doc merged with current and carrying the current revision id. Return nil to give
+// up on the document.
+type BulkResolver func(doc Identifiable, current DynamicDoc) (Identifiable, error)
+
+// BulkOutcome reports the final state of a single document written with InsertBulkResolving().
+type BulkOutcome struct {
+	Doc      Identifiable // Document as last attempted
+	Attempts int
+	Err      error // nil if the document has been written
+}
+
+// InsertBulkResolving inserts a bulk of documents with per-document semantics. Documents that fail
+// because of a conflict are re-fetched and passed to resolve, the resolved documents are then
+// retried, up to maxRetries times. The outcomes are reported in the same order as the documents
+// of the bulk. If not all documents could be written, you will still get an error reporting the issue.
+func (db *Database) InsertBulkResolving(bulk *Bulk, resolve BulkResolver, maxRetries int, opts ...Option) ([]BulkOutcome, error) {
+	outcomes := make([]BulkOutcome, len(bulk.Docs))
+	pending := make([]int, len(bulk.Docs))
+	for i, doc := range bulk.Docs {
+		outcomes[i].Doc = doc
+		pending[i] = i
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		retry := new(Bulk)
+		for _, i := range pending {
+			retry.Add(outcomes[i].Doc)
+		}
+		results, err := db.insertBulk(retry, false, opts)
+		if err != nil {
+			for _, i := range pending {
+				outcomes[i].Err = err
+			}
+			return outcomes, err
+		}
+
+		var conflicts []int
+		for j, result := range results {
+			i := pending[j]
+			outcomes[i].Attempts++
+			outcomes[i].Err = result.err()
+			if result.Ok && attempt > 0 {
+				db.reportResolution(result.ID, ResolvedByMerge, result.Rev, nil)
+			}
+			if result.Error == "conflict" && attempt < maxRetries {
+				conflicts = append(conflicts, i)
+			}
+		}
+
+		// Resolve conflicts against the latest revisions
+		pending = nil
+		for _, i := range conflicts {
+			resolved, err := db.resolveConflict(outcomes[i].Doc, resolve, opts)
+			if err != nil {
+				outcomes[i].Err = err
+				continue
+			}
+			if resolved != nil {
+				outcomes[i].Doc = resolved
+				pending = append(pending, i)
+			}
+		}
+	}
+
+	for _, outcome := range outcomes {
+		if outcome.Err != nil {
+			return outcomes, errors.New("bulk insert incomplete")
+		}
+	}
+	return outcomes, nil
+}
+
+// Fetch the latest revision of a conflicting document and hand both to resolve
+func (db *Database) resolveConflict(doc Identifiable, resolve BulkResolver, opts []Option) (Identifiable, error) {
+	id, _ := doc.IDRev()
+	var current DynamicDoc
+	err := db.Retrieve(id, &current, opts...)
+	if ErrorType(err) == "not_found" {
+		current, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resolve(doc, current)
 }
 
 // Generic CouchDB request. If CouchDB returns an error description, it
 // will not be unmarshaled into response but returned as a regular Go error.
-func Do(url, method string, cred *Credentials, body, response interface{}) (*http.Response, error) {
+// Every response with an error status code is returned as an error, even if it
+// doesn't carry an error description. The request is sent with http.DefaultClient
+// unless WithHTTPClient() is passed, calls through a Server use the client set
+// with SetHTTPClient().
+func Do(url, method string, cred *Credentials, body, response interface{}, opts ...Option) (*http.Response, error) {
+	return do(url, method, cred, body, response, opts)
+}
 
-	// Prepare json request body
-	var bodyReader io.Reader
-	if body != nil {
-		json, err := json.Marshal(body)
-		if err != nil {
-			return nil, err
+// Implements Do() for all calls, applying the options of a single call
+func do(url, method string, cred *Credentials, body, response interface{}, opts []Option) (*http.Response, error) {
+	o := newCallOptions(opts)
+	start := time.Now()
+	resp, err := o.send(url, method, cred, body, response)
+	o.journal.record(method, url, body, resp, err, start)
+	// The server may reject a session cookie before it expires, e.g. one restored from a store,
+	// so the call is sent once more after logging in again. Streamed bodies can't be sent twice
+	if _, raw := body.(*rawBody); o.session != nil && o.cred == nil && !raw && StatusCode(err) == http.StatusUnauthorized {
+		if err = o.session.login([]Option{WithContext(o.context()), useClient(o.client)}); err != nil {
+			return resp, err
 		}
-		bodyReader = bytes.NewReader(json)
+		start = time.Now()
+		resp, err = o.send(url, method, cred, body, response)
+		o.journal.record(method, url, body, resp, err, start)
 	}
+	return resp, err
+}
 
-	// Prepare request
-	req, err := http.NewRequest(method, url, bodyReader)
+// Send a request and decode its response
+func (o *callOptions) send(url, method string, cred *Credentials, body, response interface{}) (*http.Response, error) {
+	// Prepare request with json body
+	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		return nil, err
 	}
+	// Streamed responses keep the request context alive until the body is closed
+	stream, streaming := response.(*io.ReadCloser)
+	var cancels []context.CancelFunc
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			for _, cancel := range cancels {
+				cancel()
+			}
+		}
+	}()
+	ctx := o.context()
+	if o.closing != nil {
+		select {
+		case <-o.closing:
+			return nil, ErrServerClosed
+		default:
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		go func(ctx context.Context) {
+			select {
+			case <-o.closing:
+				cancel()
+			case <-ctx.Done():
+			}
+		}(ctx)
+	}
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		cancels = append(cancels, cancel)
+	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
-	if cred != nil {
+	if streaming {
+		req.Header.Set("Accept", "*/*")
+	}
+	if raw, ok := body.(*rawBody); ok {
+		raw.attach(req)
+	} else if body != nil {
+		if err = setJSONBody(req, body); err != nil {
+			return nil, err
+		}
+	}
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	req.Header.Set("X-Request-ID", requestID)
+	o.identify(req)
+	if o.cred != nil {
+		cred = o.cred
+	}
+	if o.session != nil && o.cred == nil {
+		if err = o.session.renew([]Option{WithContext(ctx), useClient(o.client)}); err != nil {
+			return nil, err
+		}
+		o.session.authorize(req)
+	} else if cred != nil {
 		req.SetBasicAuth(cred.user, cred.password)
 	}
 
 	// Make request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := o.httpClient().Do(req)
 	if err != nil {
 		return resp, err
 	}
+	o.record(resp)
+	if o.session != nil {
+		o.session.update(resp)
+	}
+	if streaming && resp.StatusCode < 400 {
+		*stream = &streamBody{ReadCloser: resp.Body, cancels: cancels}
+		handedOff = true
+		return resp, nil
+	}
+	defer closeBody(resp.Body)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err = buf.ReadFrom(resp.Body); err != nil {
+		return resp, err
+	}
+	respBody := buf.Bytes()
 
-	// Catch error response in json body
-	respBody, _ := ioutil.ReadAll(resp.Body)
-	var cErr couchError
+	// Successful responses are decoded once
+	if resp.StatusCode < 400 {
+		if response != nil {
+			if o.codec != nil {
+				if err = checkDocument(respBody); err != nil {
+					return resp, err
+				}
+			}
+			err = o.decoder().Unmarshal(respBody, response)
+		}
+		return resp, err
+	}
+
+	// Catch error response in json body, responses that don't carry a CouchDB
+	// error description (e.g. from a proxy) are reported with an excerpt of their body
+	cErr := couchError{
+		StatusCode: resp.StatusCode,
+		RequestID:  responseRequestID(resp, requestID),
+		Header:     resp.Header,
+		Body:       append([]byte(nil), respBody...),
+	}
 	json.Unmarshal(respBody, &cErr)
-	if cErr.Type != "" {
-		return nil, cErr
+	if cErr.Type == "" {
+		cErr.Excerpt = excerpt(respBody)
 	}
-	if response != nil {
-		err = json.Unmarshal(respBody, response)
+	return nil, cErr
+}
+
+// Most bytes read from a response body that is closed before its end, longer
+// remainders are cheaper to drop along with the connection than to drain
+const maxDrainLength = 64 << 10
+
+// Close a response body after draining what is left of it, so that the
+// connection can be reused by the transport. Every response body has to go here.
+func closeBody(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrainLength))
+	body.Close()
+}
+
+// Longest excerpt of a response body kept in an error
+const maxExcerptLength = 256
+
+// Shorten a response body to be included in an error message
+func excerpt(body []byte) string {
+	s := strings.TrimSpace(string(body))
+	if len(s) > maxExcerptLength {
+		s = s[:maxExcerptLength] + "..."
 	}
-	return resp, err
+	return s
+}
+
+// Buffers reused for request and response bodies
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// Get an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
 }
 
-// CouchDB error description
+// Return a buffer to the pool, unless it grew too large to keep around
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= 1<<20 {
+		bufferPool.Put(buf)
+	}
+}
+
+// Encode body as json and attach it to req. Bodies that are already
+// encoded, like documents encoded by a codec, are sent as they are.
+func setJSONBody(req *http.Request, body interface{}) error {
+	if raw, ok := body.(json.RawMessage); ok {
+		req.Body = ioutil.NopCloser(bytes.NewReader(raw))
+		req.ContentLength = int64(len(raw))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(raw)), nil
+		}
+		return nil
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := json.NewEncoder(buf).Encode(body); err != nil {
+		return err
+	}
+	// The transport may read the body again after the call, to follow a redirect or to retry
+	// on another connection, so it gets a copy that outlives the pooled buffer
+	return setJSONBody(req, json.RawMessage(append([]byte(nil), buf.Bytes()...)))
+}
+
+// CouchDB error description. Responses with an error status but without a
+// description only have StatusCode, Excerpt, Header and Body set.
 type couchError struct {
-	Type   string `json:"error"`
-	Reason string `json:"reason"`
+	Type       string      `json:"error"`
+	Reason     string      `json:"reason"`
+	StatusCode int         `json:"-"`
+	Excerpt    string      `json:"-"`
+	RequestID  string      `json:"-"`
+	Header     http.Header `json:"-"`
+	Body       []byte      `json:"-"`
 }
 
 // Error implements the error interface.
 func (e couchError) Error() string {
-	return "couchdb: " + e.Type + " (" + e.Reason + ")"
+	var msg string
+	if e.Type == "" {
+		msg = fmt.Sprintf("couchdb: unexpected status %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Excerpt)
+	} else {
+		msg = "couchdb: " + e.Type + " (" + e.Reason + ")"
+	}
+	if e.RequestID != "" {
+		msg += " [request " + e.RequestID + "]"
+	}
+	return msg
 }
 
 // ErrorType returns the shortform of a CouchDB error, e.g. bad_request.
 // If the error didn't originate from CouchDB, the function will return an empty string.
 func ErrorType(err error) string {
-	cErr, _ := err.(couchError)
+	var cErr couchError
+	errors.As(err, &cErr)
 	return cErr.Type
 }
 
-// Check if HEAD response of a url succeeds
-func checkHead(url string) (bool, error) {
-	resp, err := http.Head(url)
-	if err != nil {
-		return false, err
-	}
-	if resp.StatusCode != 200 {
+// ErrorReason returns the reason CouchDB gives for an error, e.g. "Document update conflict.".
+// If the error didn't originate from CouchDB or has no reason, the function will return an empty string.
+func ErrorReason(err error) string {
+	var cErr couchError
+	errors.As(err, &cErr)
+	return cErr.Reason
+}
+
+// StatusCode returns the HTTP status code of the response an error originated from, e.g. to tell
+// a 404 from a 500. It returns 0 for errors that didn't originate from a CouchDB response.
+func StatusCode(err error) int {
+	var cErr couchError
+	errors.As(err, &cErr)
+	return cErr.StatusCode
+}
+
+// ErrorHeader returns the HTTP headers of the response an error originated from,
+// nil for errors that didn't originate from a CouchDB response.
+func ErrorHeader(err error) http.Header {
+	var cErr couchError
+	errors.As(err, &cErr)
+	return cErr.Header
+}
+
+// ErrorBody returns the body of the response an error originated from, e.g. to log error
+// pages of proxies in full. It returns nil for errors that didn't originate from a CouchDB response.
+func ErrorBody(err error) []byte {
+	var cErr couchError
+	errors.As(err, &cErr)
+	return cErr.Body
+}
+
+// Check if a HEAD request to a url succeeds, a 404 response means it doesn't exist
+func checkHead(url string, cred *Credentials, opts []Option) (bool, error) {
+	_, err := do(url, "HEAD", cred, nil, nil, opts)
+	if errors.Is(err, ErrNotFound) {
 		return false, nil
 	}
-	return true, nil
+	return err == nil, err
 }
 
 // Encode map entries to a string that can be used as parameters to a url.
@@ -363,9 +1027,9 @@ func urlEncode(options map[string]interface{}) string {
 		var s string
 		switch v.(type) {
 		case string:
-			s = fmt.Sprintf(`%s=%s&`, k, url.QueryEscape(v.(string)))
+			s = fmt.Sprintf(`%s=%s&`, url.QueryEscape(k), url.QueryEscape(v.(string)))
 		case uint8, uint16, uint32, uint64, int8, int16, int32, int64, float32, float64, complex64, complex128, uint, int, bool:
-			s = fmt.Sprintf(`%s=%v&`, k, v)
+			s = fmt.Sprintf(`%s=%v&`, url.QueryEscape(k), v)
 		}
 		buf.WriteString(s)
 	}
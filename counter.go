@@ -0,0 +1,54 @@
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Number of attempts Increment() makes before giving up on a contended counter
+const maxIncrementAttempts = 20
+
+// Increment adds delta to an integer field of a document and returns the new value.
+// A missing document or field counts as 0, the document will then be created. Concurrent
+// increments are serialized by CouchDB's conflict detection, on a conflict the document is read
+// again and the increment retried. Other fields of the document are left untouched.
+//
+// Use it for counters and sequence numbers, but keep in mind that a heavily contended
+// counter document will lead to many retries.
+func (db *Database) Increment(docID, field string, delta int64, opts ...Option) (int64, error) {
+	var err error
+	for attempt := 0; attempt < maxIncrementAttempts; attempt++ {
+		var value int64
+		value, err = db.tryIncrement(docID, field, delta, opts)
+		if ErrorType(err) != "conflict" {
+			return value, err
+		}
+	}
+	return 0, err
+}
+
+// Single read-modify-write cycle of Increment()
+func (db *Database) tryIncrement(docID, field string, delta int64, opts []Option) (int64, error) {
+	doc := make(rawDoc)
+	err := db.retrieve(docID, "", &doc, nil, opts)
+	if ErrorType(err) == "not_found" {
+		doc = make(rawDoc)
+		doc.SetIDRev(docID, "")
+	} else if err != nil {
+		return 0, err
+	}
+
+	var value int64
+	if raw, ok := doc[field]; ok {
+		var num json.Number
+		if err := json.Unmarshal(raw, &num); err != nil {
+			return 0, fmt.Errorf("couch: field %s of %s is not a number", field, docID)
+		}
+		if value, err = num.Int64(); err != nil {
+			return 0, fmt.Errorf("couch: field %s of %s is not an integer", field, docID)
+		}
+	}
+	value += delta
+	doc[field], _ = json.Marshal(value)
+	return value, db.Insert(doc, opts...)
+}
@@ -0,0 +1,36 @@
+package couch_test
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestIntegrationIncrement(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	value, err := db.Increment("visits", "count", 5)
+	if err != nil {
+		t.Fatal("Incrementing missing counter returned error:", err)
+	}
+	if value != 5 {
+		t.Error("Counter should be 5, is", value)
+	}
+
+	// Concurrent increments must not get lost
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := db.Increment("visits", "count", 1); err != nil {
+				t.Error("Incrementing counter returned error:", err)
+			}
+		}()
+	}
+	wg.Wait()
+	value, err = db.Increment("visits", "count", 0)
+	if err != nil || value != 10 {
+		t.Error("Counter should be 10 after concurrent increments, is", value, err)
+	}
+}
@@ -0,0 +1,87 @@
+package couch
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DesignDocCopy reports the outcome of copying a design document with CopyDesignDocs().
+type DesignDocCopy struct {
+	Name    string
+	Written bool // false if the target already had the same content
+	// Rebuild lists the views of the target that are rebuilt on their next query because the
+	// signature of their index changed. All views of a design document share one index, so
+	// changing any of them rebuilds all of them.
+	Rebuild []string
+}
+
+// Information about the index of a design document
+type designInfo struct {
+	ViewIndex struct {
+		Signature string `json:"signature"`
+	} `json:"view_index"`
+}
+
+// CopyDesignDocs copies design documents by name from src to dst, all of them if no names are
+// given, e.g. to promote index changes from staging to production. The databases may be located
+// on different servers. Design documents dst already has with the same content are left alone.
+// The result tells which views will be rebuilt, which can take long for large databases, so it's
+// a good idea to query them once before traffic depends on them.
+func CopyDesignDocs(src, dst *Database, names ...string) ([]DesignDocCopy, error) {
+	docs, err := src.DesignDocs()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*DesignDoc, len(docs))
+	for _, d := range docs {
+		byName[d.Name()] = d
+	}
+	if len(names) == 0 {
+		for name := range byName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	copies := make([]DesignDocCopy, 0, len(names))
+	for _, name := range names {
+		d, ok := byName[name]
+		if !ok {
+			return copies, fmt.Errorf("couch: design document %s of %s: %w", name, src.Name(), ErrNotFound)
+		}
+		before, err := dst.indexSignature(name)
+		if err != nil {
+			return copies, err
+		}
+		existing := &DesignDoc{}
+		if err = dst.Retrieve(d.ID, existing); err != nil && ErrorType(err) != "not_found" {
+			return copies, err
+		}
+		if err = dst.EnsureDesignDoc(d); err != nil {
+			return copies, err
+		}
+		after, err := dst.indexSignature(name)
+		if err != nil {
+			return copies, err
+		}
+		c := DesignDocCopy{Name: name, Written: d.Rev != existing.Rev}
+		if after != before {
+			for view := range d.Views {
+				c.Rebuild = append(c.Rebuild, view)
+			}
+			sort.Strings(c.Rebuild)
+		}
+		copies = append(copies, c)
+	}
+	return copies, nil
+}
+
+// Signature of the index of a design document, empty if it doesn't exist
+func (db *Database) indexSignature(designID string) (string, error) {
+	var info designInfo
+	_, err := do(db.URL()+"/_design/"+designID+"/_info", "GET", db.Cred(), nil, &info, db.server.withDefaults(nil))
+	if ErrorType(err) == "not_found" {
+		return "", nil
+	}
+	return info.ViewIndex.Signature, err
+}
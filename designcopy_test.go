@@ -0,0 +1,91 @@
+package couch_test
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Serves design documents of a database from memory, the index signature is derived from the views
+func designDocsServer(t *testing.T, docs map[string]map[string]interface{}) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path := strings.TrimPrefix(r.URL.Path, "/db/")
+		switch {
+		case path == "_all_docs":
+			var rows []map[string]interface{}
+			for _, doc := range docs {
+				rows = append(rows, map[string]interface{}{"doc": doc})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"rows": rows})
+		case strings.HasSuffix(path, "/_info"):
+			doc, ok := docs[strings.TrimSuffix(path, "/_info")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error": "not_found", "reason": "missing"}`))
+				return
+			}
+			views, _ := json.Marshal(doc["views"])
+			fmt.Fprintf(w, `{"view_index": {"signature": "%x"}}`, sha1.Sum(views))
+		case r.Method == "GET":
+			doc, ok := docs[path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error": "not_found", "reason": "missing"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(doc)
+		case r.Method == "PUT":
+			var doc map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&doc)
+			doc["_rev"] = fmt.Sprintf("%d-x", len(docs)+10)
+			docs[path] = doc
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"ok": true, "id": "%s", "rev": "%s"}`, path, doc["_rev"])
+		}
+	}))
+}
+
+func TestCopyDesignDocs(t *testing.T) {
+	t.Parallel()
+	view := func(m string) map[string]interface{} { return map[string]interface{}{"map": m} }
+	src := designDocsServer(t, map[string]map[string]interface{}{
+		"_design/people": {"_id": "_design/people", "_rev": "1-a", "views": map[string]interface{}{"by_name": view("function(doc) { emit(doc.name); }"), "by_age": view("function(doc) { emit(doc.age); }")}},
+		"_design/cars":   {"_id": "_design/cars", "_rev": "1-a", "views": map[string]interface{}{"by_brand": view("function(doc) { emit(doc.brand); }")}},
+		"_design/places": {"_id": "_design/places", "_rev": "1-a", "filters": map[string]interface{}{"open": "function(doc) { return true; }"}},
+	})
+	defer src.Close()
+	dst := designDocsServer(t, map[string]map[string]interface{}{
+		"_design/people": {"_id": "_design/people", "_rev": "3-b", "views": map[string]interface{}{"by_name": view("function(doc) { emit(doc.name); }")}},
+		"_design/cars":   {"_id": "_design/cars", "_rev": "2-b", "views": map[string]interface{}{"by_brand": view("function(doc) { emit(doc.brand); }")}},
+	})
+	defer dst.Close()
+
+	srcDB := couch.NewServer(src.URL, nil).Database("db")
+	dstDB := couch.NewServer(dst.URL, nil).Database("db")
+	copies, err := couch.CopyDesignDocs(srcDB, dstDB, "people", "cars", "places")
+	if err != nil {
+		t.Fatal("Copying design documents returned error:", err)
+	}
+	if people := copies[0]; !people.Written || strings.Join(people.Rebuild, ",") != "by_age,by_name" {
+		t.Error("Changed design document should rebuild all its views, got", people)
+	}
+	if cars := copies[1]; cars.Written || len(cars.Rebuild) != 0 {
+		t.Error("Unchanged design document shouldn't be written, got", cars)
+	}
+	if places := copies[2]; !places.Written || len(places.Rebuild) != 0 {
+		t.Error("New design document without views should be written, got", places)
+	}
+	if _, err = couch.CopyDesignDocs(srcDB, dstDB, "missing"); err == nil {
+		t.Error("Copying a missing design document should fail")
+	}
+}
@@ -0,0 +1,91 @@
+package couch
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// DesignDiff lists the differences between the design documents of two databases. Elements are
+// named by their path within the design documents, e.g. "people/views/by_name" for a view or
+// "people/validate_doc_update" for a validation function.
+type DesignDiff struct {
+	Added   []string // Only in the second database
+	Removed []string // Only in the first database
+	Changed []string // In both databases but different
+}
+
+// Empty returns true if the design documents of both databases are the same.
+func (d *DesignDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffDesignDocs compares the views and functions of the design documents of two databases,
+// e.g. to verify that staging and production are in sync before a release. The databases may
+// be located on different servers. Added and removed are meant from a to b.
+func DiffDesignDocs(a, b *Database, opts ...Option) (*DesignDiff, error) {
+	elemsA, err := designElements(a, opts)
+	if err != nil {
+		return nil, err
+	}
+	elemsB, err := designElements(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	diff := &DesignDiff{}
+	for path, enc := range elemsA {
+		other, ok := elemsB[path]
+		if !ok {
+			diff.Removed = append(diff.Removed, path)
+		} else if other != enc {
+			diff.Changed = append(diff.Changed, path)
+		}
+	}
+	for path := range elemsB {
+		if _, ok := elemsA[path]; !ok {
+			diff.Added = append(diff.Added, path)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff, nil
+}
+
+// Map the path of every element of the design documents of a database to its canonical encoding.
+// Objects like views or filters are split into their members, everything else is an element of its own.
+func designElements(db *Database, opts []Option) (map[string]string, error) {
+	docs, err := db.DesignDocs(opts...)
+	if err != nil {
+		return nil, err
+	}
+	elems := make(map[string]string)
+	for _, d := range docs {
+		enc, err := JSONCodec{}.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]interface{}
+		if err = json.Unmarshal(enc, &fields); err != nil {
+			return nil, err
+		}
+		delete(fields, "_id")
+		delete(fields, "_rev")
+		for key, value := range fields {
+			path := d.Name() + "/" + key
+			if members, ok := value.(map[string]interface{}); ok {
+				for member, v := range members {
+					elems[path+"/"+member] = canonicalJSON(v)
+				}
+				continue
+			}
+			elems[path] = canonicalJSON(value)
+		}
+	}
+	return elems, nil
+}
+
+// Encode a decoded JSON value so that equal values have equal encodings
+func canonicalJSON(v interface{}) string {
+	enc, _ := json.Marshal(v)
+	return string(enc)
+}
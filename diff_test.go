@@ -0,0 +1,49 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestDiffDesignDocs(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/staging/_all_docs":
+			w.Write([]byte(`{"rows": [
+				{"doc": {"_id": "_design/people", "_rev": "1-a", "views": {
+					"by_name": {"map": "function(doc) { emit(doc.name, null); }"},
+					"by_age": {"map": "function(doc) { emit(doc.age, null); }"}}}},
+				{"doc": {"_id": "_design/auth", "_rev": "1-b", "validate_doc_update": "function() {}"}}]}`))
+		case "/production/_all_docs":
+			w.Write([]byte(`{"rows": [
+				{"doc": {"_id": "_design/people", "_rev": "4-c", "views": {
+					"by_name": {"map": "function(doc) { emit(doc.name, 1); }"}},
+					"shows": {"person": "function(doc) {}"}}}]}`))
+		}
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	diff, err := couch.DiffDesignDocs(s.Database("staging"), s.Database("production"))
+	if err != nil {
+		t.Fatal("Diffing design documents returned error:", err)
+	}
+	expected := &couch.DesignDiff{
+		Added:   []string{"people/shows/person"},
+		Removed: []string{"auth/validate_doc_update", "people/views/by_age"},
+		Changed: []string{"people/views/by_name"},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %v, got %v", expected, diff)
+	}
+
+	diff, err = couch.DiffDesignDocs(s.Database("staging"), s.Database("staging"))
+	if err != nil || !diff.Empty() {
+		t.Error("Same design documents should not differ, got", diff, err)
+	}
+}
@@ -1,9 +1,10 @@
 // Package couch implements a client for a CouchDB database.
 //
 // Version 0.1 focuses on basic operations, proper conflict management, error handling and
-// replication. Not part of this version are attachment handling, general
-// statistics and optimizations, change detection and creating views. Most of
-// the features are accessible using the generic Do() function, though.
+// replication. Attachments are streamed with PutAttachment() and GetAttachment().
+// Not part of this version are general statistics and optimizations, change
+// detection and creating views. Most of the features are accessible using the
+// generic Do() function, though.
 //
 //
 // Getting started:
@@ -116,5 +117,6 @@
 // Errors returned by CouchDB will be converted into a Go error. Its regular Error() method will
 // then return a combination of the shortform (e.g. bad_request) as well as the longer and more
 // specific description. To be able to identify a specific error within your application, use ErrorType() to get
-// the shortform only.
+// the shortform only. Common errors can also be matched with errors.Is() and the sentinel errors
+// of the package, e.g. ErrConflict, and turned into messages for users with Message().
 package couch
@@ -0,0 +1,47 @@
+package couch
+
+import "encoding/json"
+
+// SizeOf returns the size of a document encoded as JSON with encoding/json, which is roughly
+// what it takes up in CouchDB and in every view row including it. Documents of a database
+// with another codec may differ, SetDocumentSizeWarning() measures them with their codec.
+func SizeOf(doc Identifiable) (int, error) {
+	enc, err := json.Marshal(doc)
+	if err != nil {
+		return 0, err
+	}
+	return len(enc), nil
+}
+
+// Threshold and receiver of document size warnings
+type sizeWarning struct {
+	threshold int
+	warn      func(docID string, size int)
+}
+
+// SetDocumentSizeWarning makes a database report documents written with Insert(), InsertBulk() and
+// the operations based on them that are larger than threshold bytes once encoded. Large documents
+// slow down views and replication, a warning points to the ones to split up. warn receives the id,
+// empty for new documents without one, and the size. It is called before the document is sent. If
+// warn is nil, warnings go to the logger of the server. Pass a threshold of 0 to stop warning.
+func (db *Database) SetDocumentSizeWarning(threshold int, warn func(docID string, size int)) {
+	if threshold <= 0 {
+		db.sizeWarn = nil
+		return
+	}
+	db.sizeWarn = &sizeWarning{threshold: threshold, warn: warn}
+}
+
+// Report an encoded document if it exceeds the size threshold of the database
+func (db *Database) checkDocSize(doc Identifiable, enc json.RawMessage) {
+	w := db.sizeWarn
+	if w == nil || len(enc) <= w.threshold {
+		return
+	}
+	id, _ := doc.IDRev()
+	if w.warn != nil {
+		w.warn(id, len(enc))
+		return
+	}
+	db.server.logf("couch: document %q in %s has %d bytes, more than %d", id, db.name, len(enc), w.threshold)
+}
@@ -0,0 +1,61 @@
+package couch_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestSizeOf(t *testing.T) {
+	t.Parallel()
+	size, err := couch.SizeOf(&Person{Doc: couch.Doc{ID: "anna"}, Name: "Anna"})
+	if err != nil || size != len(`{"_id":"anna","Name":"Anna","Height":0,"Alive":false}`) {
+		t.Error("Unexpected size", size, err)
+	}
+	if _, err = couch.SizeOf(couch.DynamicDoc{"f": func() {}}); err == nil {
+		t.Error("Size of a document that can't be encoded should fail")
+	}
+}
+
+func TestDocumentSizeWarning(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_bulk_docs") {
+			w.Write([]byte(`[{"ok": true, "id": "a", "rev": "1-a"}, {"ok": true, "id": "b", "rev": "1-b"}]`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok": true, "id": "big", "rev": "1-a"}`))
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+	var warnings []string
+	db.SetDocumentSizeWarning(100, func(id string, size int) {
+		warnings = append(warnings, fmt.Sprint(id, ":", size > 100))
+	})
+
+	big := &Person{Doc: couch.Doc{ID: "big"}, Name: strings.Repeat("x", 100)}
+	if err := db.Insert(big); err != nil {
+		t.Fatal("Insert returned error:", err)
+	}
+	bulk := new(couch.Bulk)
+	bulk.Add(&Person{Doc: couch.Doc{ID: "a"}, Name: "small"})
+	bulk.Add(&Person{Doc: couch.Doc{ID: "b"}, Name: strings.Repeat("x", 100)})
+	if _, err := db.InsertBulk(bulk, false); err != nil {
+		t.Fatal("Bulk insert returned error:", err)
+	}
+	if fmt.Sprint(warnings) != "[big:true b:true]" {
+		t.Error("Only large documents should be reported, got", warnings)
+	}
+
+	db.SetDocumentSizeWarning(0, nil)
+	big.Rev = ""
+	db.Insert(big)
+	if len(warnings) != 2 {
+		t.Error("Warnings should stop, got", warnings)
+	}
+}
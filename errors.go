@@ -0,0 +1,138 @@
+package couch
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// Sentinel errors CouchDB errors can be compared with using errors.Is(), independently of
+// the exact reason CouchDB gives:
+//
+//	if errors.Is(err, couch.ErrConflict) {
+//		// Retrieve the latest revision and try again
+//	}
+var (
+	ErrNotFound       = errors.New("couch: not found")
+	ErrConflict       = errors.New("couch: conflict")
+	ErrUnauthorized   = errors.New("couch: unauthorized")
+	ErrForbidden      = errors.New("couch: forbidden")
+	ErrBadRequest     = errors.New("couch: bad request")
+	ErrDatabaseExists = errors.New("couch: database exists")
+	ErrTooLarge       = errors.New("couch: too large")
+
+	// ErrUnsupported is returned for features a server doesn't announce, see Server.RequireFeature()
+	ErrUnsupported = errors.New("couch: unsupported by server")
+)
+
+// Sentinel errors by CouchDB error type
+var errorTypes = map[string]error{
+	"not_found":    ErrNotFound,
+	"conflict":     ErrConflict,
+	"unauthorized": ErrUnauthorized,
+	"forbidden":    ErrForbidden,
+	"bad_request":  ErrBadRequest,
+	"file_exists":  ErrDatabaseExists,
+
+	"document_too_large":   ErrTooLarge,
+	"attachment_too_large": ErrTooLarge,
+	"too_large":            ErrTooLarge,
+}
+
+// Sentinel errors by status code, for error responses without a CouchDB error type
+var errorStatusCodes = map[int]error{
+	http.StatusNotFound:     ErrNotFound,
+	http.StatusConflict:     ErrConflict,
+	http.StatusUnauthorized: ErrUnauthorized,
+	http.StatusForbidden:    ErrForbidden,
+	http.StatusBadRequest:   ErrBadRequest,
+
+	http.StatusRequestEntityTooLarge: ErrTooLarge,
+}
+
+// Sentinel error a CouchDB error corresponds to, nil if there is none
+func (e couchError) sentinel() error {
+	if e.Type != "" {
+		return errorTypes[e.Type]
+	}
+	return errorStatusCodes[e.StatusCode]
+}
+
+// Is makes CouchDB errors match the sentinel errors of the package.
+func (e couchError) Is(target error) bool {
+	s := e.sentinel()
+	return s != nil && s == target
+}
+
+// Default messages for users, by sentinel error
+var defaultMessages = map[error]string{
+	ErrNotFound:       "The requested item doesn't exist.",
+	ErrConflict:       "The item has been changed by someone else in the meantime.",
+	ErrUnauthorized:   "You need to log in to do this.",
+	ErrForbidden:      "You are not allowed to do this.",
+	ErrBadRequest:     "The request was invalid.",
+	ErrDatabaseExists: "The database already exists.",
+	ErrTooLarge:       "The item is too large.",
+	ErrUnsupported:    "The server doesn't support this.",
+}
+
+// Translator turns an error into a message for users, e.g. in their language. sentinel is the
+// sentinel error err matches, or nil if there is none. Return an empty string to fall back
+// to the default message.
+type Translator func(sentinel error, err error) string
+
+var (
+	translatorMu sync.RWMutex
+	translator   Translator
+)
+
+// SetTranslator sets the translator used by Message(), nil restores the default messages.
+func SetTranslator(t Translator) {
+	translatorMu.Lock()
+	defer translatorMu.Unlock()
+	translator = t
+}
+
+// Message returns a message describing an error to users. Errors matching a sentinel error of the
+// package get a friendly message, see SetTranslator() to customize them. For other errors it
+// returns err.Error().
+func Message(err error) string {
+	if err == nil {
+		return ""
+	}
+	var sentinel error
+	for s := range defaultMessages {
+		if errors.Is(err, s) {
+			sentinel = s
+			break
+		}
+	}
+	translatorMu.RLock()
+	t := translator
+	translatorMu.RUnlock()
+	if t != nil {
+		if msg := t(sentinel, err); msg != "" {
+			return msg
+		}
+	}
+	if msg, ok := defaultMessages[sentinel]; ok {
+		return msg
+	}
+	return err.Error()
+}
+
+// ErrorHandler receives errors of calls that can't return them, like Exists() or HasView().
+type ErrorHandler func(err error)
+
+// SetErrorHandler sets a function that is called with errors that methods of a server and its
+// databases can't return, e.g. because they only report a bool. nil (the default) drops them.
+func (s *Server) SetErrorHandler(h ErrorHandler) {
+	s.onError = h
+}
+
+// Pass an error to the error handler of a server, if there is an error and a handler
+func (s *Server) handleError(err error) {
+	if err != nil && s.onError != nil {
+		s.onError(err)
+	}
+}
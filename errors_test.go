@@ -0,0 +1,122 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/people/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "not_found", "reason": "missing"}`))
+		case "/people/locked":
+			w.Header().Set("X-Proxy", "edge")
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`<html>Conflict</html>`))
+		case "/people/huge":
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write([]byte(`{"error": "document_too_large", "reason": "huge"}`))
+		}
+	}))
+	defer ts.Close()
+	db := couch.NewServer(ts.URL, nil).Database("people")
+
+	err := db.Retrieve("missing", new(Person))
+	if !errors.Is(err, couch.ErrNotFound) || errors.Is(err, couch.ErrConflict) {
+		t.Error("Not found error should match ErrNotFound only, got", err)
+	}
+	if couch.ErrorReason(err) != "missing" {
+		t.Error("Reason should be kept, got", couch.ErrorReason(err))
+	}
+	err = db.Retrieve("locked", new(Person))
+	if !errors.Is(err, couch.ErrConflict) {
+		t.Error("Status code should be matched without error description, got", err)
+	}
+	if couch.ErrorReason(err) != "" {
+		t.Error("Error without description shouldn't have a reason, got", couch.ErrorReason(err))
+	}
+	if couch.StatusCode(err) != http.StatusConflict || string(couch.ErrorBody(err)) != "<html>Conflict</html>" || couch.ErrorHeader(err).Get("X-Proxy") != "edge" {
+		t.Error("Status code, body and headers of the response should be kept, got", couch.StatusCode(err), string(couch.ErrorBody(err)), couch.ErrorHeader(err))
+	}
+	if couch.StatusCode(errors.New("other")) != 0 || couch.ErrorHeader(errors.New("other")) != nil {
+		t.Error("Other errors shouldn't have a status code or headers")
+	}
+	err = db.Retrieve("huge", new(Person))
+	if !errors.Is(err, couch.ErrTooLarge) {
+		t.Error("Too large document should match ErrTooLarge, got", err)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	err := errors.New("couch: something else")
+	if couch.Message(err) != err.Error() {
+		t.Error("Unknown errors should keep their message")
+	}
+	if couch.Message(couch.ErrConflict) == couch.ErrConflict.Error() {
+		t.Error("Sentinel errors should get a friendly message")
+	}
+
+	couch.SetTranslator(func(sentinel, err error) string {
+		if sentinel == couch.ErrConflict {
+			return "Konflikt"
+		}
+		return ""
+	})
+	defer couch.SetTranslator(nil)
+	if couch.Message(couch.ErrConflict) != "Konflikt" {
+		t.Error("Translator should be used, got", couch.Message(couch.ErrConflict))
+	}
+	if couch.Message(couch.ErrNotFound) == "" {
+		t.Error("Empty translation should fall back to default message")
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	var handled []error
+	s.SetErrorHandler(func(err error) { handled = append(handled, err) })
+	if s.Database("unreachable").Exists() {
+		t.Error("Database on unreachable server shouldn't exist")
+	}
+	if s.Database("unreachable").HasView("design", "view") {
+		t.Error("View on unreachable server shouldn't exist")
+	}
+	if len(handled) != 2 {
+		t.Error("Error handler should receive 2 errors, got", handled)
+	}
+}
+
+func TestReplicateToDatabaseCredentials(t *testing.T) {
+	t.Parallel()
+	var target string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		target, _ = req["target"].(string)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, couch.NewCredentials("server", "a"))
+	targetDB := s.Database("target")
+	targetDB.SetCred(couch.NewCredentials("owner", "b"))
+	if _, err := s.Database("source").ReplicateTo(targetDB, false); err != nil {
+		t.Fatal("Replication returned error:", err)
+	}
+	if expected := strings.Replace(ts.URL, "http://", "http://owner:b@", 1) + "/target"; target != expected {
+		t.Errorf("Replication target should use credentials of the database, got %s expected %s", target, expected)
+	}
+}
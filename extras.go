@@ -0,0 +1,169 @@
+package couch
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Extras holds the fields of a document that its struct doesn't know about. Add a field
+// of this type to a struct, tagged to be ignored by encoding/json, to keep fields written
+// by other applications when a document is retrieved, edited and inserted again:
+//
+//	type Person struct {
+//		couch.Doc
+//		Name   string
+//		Extras couch.Extras `json:"-"`
+//	}
+//
+// JSONCodec and ConventionCodec fill it when decoding documents and write its fields
+// back when encoding them. Fields known to the struct always take precedence.
+type Extras map[string]json.RawMessage
+
+var extrasType = reflect.TypeOf(Extras{})
+
+// Find the Extras field of a struct, including fields of embedded structs
+func extrasField(v reflect.Value) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type == extrasType && f.PkgPath == "" {
+			return v.Field(i), true
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if extras, ok := extrasField(v.Field(i)); ok {
+				return extras, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// Whether values of a type, or the elements of a slice type, have an Extras field
+func hasExtras(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	_, ok := extrasField(reflect.New(t).Elem())
+	return ok
+}
+
+// Names of the JSON object keys encoding/json maps to fields of a struct type, lower-cased
+// because encoding/json matches keys case-insensitively
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && (!hasTag || name == "") && ft.Kind() == reflect.Struct {
+			for embedded := range jsonFieldNames(ft) {
+				names[embedded] = true
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	return names
+}
+
+// Names of the JSON object keys ConventionCodec maps to fields of a struct type
+func conventionFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for _, f := range conventionFields(t) {
+		names[strings.ToLower(f.name)] = true
+	}
+	return names
+}
+
+// Keep unknown fields of data in the Extras field of v, which is a struct, a pointer
+// to one or a slice of them. Values without an Extras field are left alone.
+func fillExtras(data []byte, v reflect.Value, known func(reflect.Type) map[string]bool) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		extras, ok := extrasField(v)
+		if !ok {
+			return nil
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil // not an object, nothing to keep
+		}
+		names := known(v.Type())
+		unknown := Extras{}
+		for key, value := range fields {
+			if !names[strings.ToLower(key)] {
+				unknown[key] = value
+			}
+		}
+		if len(unknown) == 0 {
+			unknown = nil
+		}
+		extras.Set(reflect.ValueOf(unknown))
+	case reflect.Slice:
+		if !hasExtras(v.Type()) {
+			return nil
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil || len(elems) != v.Len() {
+			return nil
+		}
+		for i, elem := range elems {
+			if err := fillExtras(elem, v.Index(i), known); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Add the fields kept in the Extras field of v to its encoding enc, unless they are known
+func mergeExtras(enc []byte, v reflect.Value) ([]byte, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return enc, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return enc, nil
+	}
+	extras, ok := extrasField(v)
+	if !ok || extras.Len() == 0 {
+		return enc, nil
+	}
+	var fields map[string]json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(enc))
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	for key, value := range extras.Interface().(Extras) {
+		if _, exists := fields[key]; !exists {
+			fields[key] = value
+		}
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,162 @@
+package couch
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Fetched is the result of RetrieveMany() for one requested id. NotFound is set for ids that
+// never existed, Deleted for documents that have been deleted, Doc is empty for both of them.
+type Fetched struct {
+	ID       string
+	Rev      string
+	Doc      json.RawMessage
+	NotFound bool
+	Deleted  bool
+	codec    Codec
+}
+
+// Decode writes the document into doc, with the codec of the database it has been fetched from.
+// A missing or deleted document is reported with a *NotFoundError.
+func (f *Fetched) Decode(doc interface{}) error {
+	if f.NotFound || f.Deleted {
+		reason := "missing"
+		if f.Deleted {
+			reason = "deleted"
+		}
+		return &NotFoundError{ID: f.ID, Deleted: f.Deleted, err: couchError{Type: "not_found", Reason: reason}}
+	}
+	return f.codec.Unmarshal(f.Doc, doc)
+}
+
+// RetrieveMany gets the latest revisions of a set of documents with a single request. The
+// results are in the same order as ids, one for every id including repeated ones, so that
+// missing and deleted documents can be told apart by their position, e.g. to fill a cache.
+func (db *Database) RetrieveMany(ids []string, opts ...Option) ([]Fetched, error) {
+	for _, id := range ids {
+		if err := validateDocID(id); err != nil {
+			return nil, err
+		}
+	}
+	if len(ids) == 0 {
+		return []Fetched{}, nil
+	}
+	rows, err := db.allDocsByKeys(ids, true, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Rows are matched by key, CouchDB answers keys in order but a proxy or cache might not
+	byKey := make(map[string]allDocsRow, len(rows))
+	for _, row := range rows {
+		byKey[row.Key] = row
+	}
+	codec := db.Codec()
+	fetched := make([]Fetched, len(ids))
+	for i, id := range ids {
+		f := Fetched{ID: id, codec: codec}
+		row, ok := byKey[id]
+		switch {
+		case !ok || row.Error != "":
+			f.NotFound = true
+		case row.Value.Deleted || len(row.Doc) == 0 || string(row.Doc) == "null":
+			f.Rev, f.Deleted = row.Value.Rev, true
+		default:
+			f.Rev, f.Doc = row.Value.Rev, row.Doc
+		}
+		fetched[i] = f
+	}
+	return fetched, nil
+}
+
+// RetrieveBulk gets the latest revisions of a set of documents with a single request and decodes
+// them into result, a pointer to a slice, in the order of ids. Missing and deleted documents are
+// skipped, use RetrieveMany() to tell them apart. It uses _bulk_get of CouchDB 2.x and later and
+// falls back to _all_docs on servers that don't have it:
+//
+//	var people []Person
+//	err := db.RetrieveBulk([]string{"anna", "bert"}, &people)
+func (db *Database) RetrieveBulk(ids []string, result interface{}, opts ...Option) error {
+	for _, id := range ids {
+		if err := validateDocID(id); err != nil {
+			return err
+		}
+	}
+	var docs []json.RawMessage
+	if len(ids) > 0 {
+		var err error
+		docs, err = db.bulkGet(ids, opts)
+		switch StatusCode(err) {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed:
+			// CouchDB 1.x takes _bulk_get for a document id
+			docs, err = db.allDocsDocs(ids, opts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	enc, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+	if docs == nil {
+		enc = []byte("[]")
+	}
+	return db.Codec().Unmarshal(enc, result)
+}
+
+// Get the latest revisions of documents with _bulk_get, in the order of ids, skipping missing and
+// deleted ones
+func (db *Database) bulkGet(ids []string, opts []Option) ([]json.RawMessage, error) {
+	type docRef struct {
+		ID string `json:"id"`
+	}
+	refs := make([]docRef, len(ids))
+	for i, id := range ids {
+		refs[i] = docRef{ID: id}
+	}
+	var resp bulkGetResult
+	body := map[string]interface{}{"docs": refs}
+	if _, err := do(db.URL()+"/_bulk_get", "POST", db.Cred(), body, &resp, db.server.withDefaults(opts)); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]json.RawMessage, len(resp.Results))
+	for _, r := range resp.Results {
+		for _, d := range r.Docs {
+			if d.Error == nil && len(d.OK) > 0 {
+				byID[r.ID] = d.OK
+			}
+		}
+	}
+	var docs []json.RawMessage
+	for _, id := range ids {
+		doc, ok := byID[id]
+		if !ok {
+			continue
+		}
+		var deleted struct {
+			Deleted bool `json:"_deleted"`
+		}
+		if err := json.Unmarshal(doc, &deleted); err != nil {
+			return nil, err
+		}
+		if !deleted.Deleted {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// Get the latest revisions of documents with _all_docs, for servers without _bulk_get
+func (db *Database) allDocsDocs(ids []string, opts []Option) ([]json.RawMessage, error) {
+	fetched, err := db.RetrieveMany(ids, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var docs []json.RawMessage
+	for _, f := range fetched {
+		if !f.NotFound && !f.Deleted {
+			docs = append(docs, f.Doc)
+		}
+	}
+	return docs, nil
+}
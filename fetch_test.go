@@ -0,0 +1,116 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestRetrieveMany(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/db/_all_docs" || r.URL.Query().Get("include_docs") != "true" {
+			t.Error("Unexpected request", r.Method, r.URL)
+		}
+		// Rows deliberately not in request order
+		w.Write([]byte(`{"rows": [
+			{"key": "gone", "id": "gone", "value": {"rev": "2-b", "deleted": true}, "doc": null},
+			{"key": "missing", "error": "not_found"},
+			{"key": "anna", "id": "anna", "value": {"rev": "1-a"}, "doc": {"_id": "anna", "_rev": "1-a", "Name": "Anna", "Height": 160}}
+		]}`))
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	fetched, err := db.RetrieveMany([]string{"anna", "missing", "gone", "anna"})
+	if err != nil {
+		t.Fatal("Retrieving many documents returned error:", err)
+	}
+	if len(fetched) != 4 {
+		t.Fatal("There should be a result for every id, got", len(fetched))
+	}
+	for _, i := range []int{0, 3} {
+		var p Person
+		if err = fetched[i].Decode(&p); err != nil || p.Name != "Anna" || p.Rev != "1-a" {
+			t.Error("Existing document should be decoded, got", p, err)
+		}
+	}
+	if f := fetched[1]; f.ID != "missing" || !f.NotFound || f.Deleted {
+		t.Error("Missing document should be marked as not found, got", f)
+	}
+	if f := fetched[2]; f.ID != "gone" || !f.Deleted || f.Rev != "2-b" {
+		t.Error("Deleted document should be marked as deleted, got", f)
+	}
+	var nf *couch.NotFoundError
+	if err = fetched[2].Decode(&Person{}); !errors.As(err, &nf) || !nf.Deleted || !errors.Is(err, couch.ErrNotFound) {
+		t.Error("Decoding a deleted document should return a *NotFoundError, got", err)
+	}
+	if fetched, err = db.RetrieveMany(nil); err != nil || len(fetched) != 0 {
+		t.Error("Retrieving no documents shouldn't fail, got", fetched, err)
+	}
+}
+
+func TestRetrieveBulk(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Docs []map[string]string `json:"docs"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.Method != "POST" || r.URL.Path != "/db/_bulk_get" || len(body.Docs) != 4 || body.Docs[1]["id"] != "bert" {
+			t.Error("Unexpected request", r.Method, r.URL, body)
+		}
+		w.Write([]byte(`{"results": [
+			{"id": "bert", "docs": [{"ok": {"_id": "bert", "_rev": "3-b", "Name": "Bert"}}]},
+			{"id": "anna", "docs": [{"ok": {"_id": "anna", "_rev": "1-a", "Name": "Anna"}}]},
+			{"id": "missing", "docs": [{"error": {"id": "missing", "rev": "undefined", "error": "not_found", "reason": "missing"}}]},
+			{"id": "gone", "docs": [{"ok": {"_id": "gone", "_rev": "2-g", "_deleted": true}}]}
+		]}`))
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	var people []*Person
+	if err := db.RetrieveBulk([]string{"anna", "bert", "missing", "gone"}, &people); err != nil {
+		t.Fatal(err)
+	}
+	if len(people) != 2 || people[0].Name != "Anna" || people[0].Rev != "1-a" || people[1].ID != "bert" {
+		t.Error("Existing documents should be decoded in order, got", people)
+	}
+	if err := db.RetrieveBulk(nil, &people); err != nil || len(people) != 0 {
+		t.Error("Retrieving no documents should empty the result, got", people, err)
+	}
+}
+
+func TestRetrieveBulkFallback(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_bulk_get":
+			// CouchDB 1.x takes it for a document id
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "illegal_docid", "reason": "Only reserved document ids may start with underscore."}`))
+		case "/db/_all_docs":
+			w.Write([]byte(`{"rows": [
+				{"key": "anna", "id": "anna", "value": {"rev": "1-a"}, "doc": {"_id": "anna", "_rev": "1-a", "Name": "Anna"}},
+				{"key": "missing", "error": "not_found"}
+			]}`))
+		default:
+			t.Error("Unexpected request", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	var people []Person
+	if err := db.RetrieveBulk([]string{"anna", "missing"}, &people); err != nil {
+		t.Fatal(err)
+	}
+	if len(people) != 1 || people[0].Name != "Anna" {
+		t.Error("Documents should be retrieved with _all_docs, got", people)
+	}
+}
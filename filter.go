@@ -0,0 +1,48 @@
+package couch
+
+import "fmt"
+
+// SetFilter makes sure a design document contains a filter function for changes feeds and
+// replications, e.g.
+//
+//	function(doc, req) { return doc.type === req.query.type; }
+//
+// Creates the design document if necessary, keeps everything else it has. Use the filter
+// as "designID/name" in ChangesOptions.Filter.
+func (db *Database) SetFilter(designID, name, fn string, opts ...Option) error {
+	return db.updateDesignDoc(designID, opts, func(d *DesignDoc) bool {
+		if d.Filters[name] == fn {
+			return false
+		}
+		if d.Filters == nil {
+			d.Filters = make(map[string]string)
+		}
+		d.Filters[name] = fn
+		return true
+	})
+}
+
+// Filter returns the source of a filter function. The error matches ErrNotFound
+// if the design document or the filter doesn't exist.
+func (db *Database) Filter(designID, name string, opts ...Option) (string, error) {
+	d := NewDesignDoc(designID)
+	if err := db.Retrieve(d.ID, d, opts...); err != nil {
+		return "", err
+	}
+	fn, ok := d.Filters[name]
+	if !ok {
+		return "", fmt.Errorf("couch: filter %s/%s: %w", designID, name, ErrNotFound)
+	}
+	return fn, nil
+}
+
+// DeleteFilter removes a filter function from a design document, if it exists.
+func (db *Database) DeleteFilter(designID, name string, opts ...Option) error {
+	return db.updateDesignDoc(designID, opts, func(d *DesignDoc) bool {
+		if _, ok := d.Filters[name]; !ok {
+			return false
+		}
+		delete(d.Filters, name)
+		return true
+	})
+}
@@ -0,0 +1,107 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Server keeping a single design document in memory
+func designDocServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	var stored map[string]interface{}
+	writes := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case "GET":
+			if stored == nil {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"not_found","reason":"missing"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(stored)
+		case "PUT":
+			stored = nil
+			json.NewDecoder(r.Body).Decode(&stored)
+			writes++
+			stored["_rev"] = strconv.Itoa(writes) + "-a"
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "id": stored["_id"], "rev": stored["_rev"]})
+		}
+	}))
+}
+
+func TestFilters(t *testing.T) {
+	t.Parallel()
+	ts := designDocServer(t)
+	defer ts.Close()
+	db := couch.NewServer(ts.URL, nil).Database("people")
+
+	if _, err := db.Filter("app", "by_type"); !errors.Is(err, couch.ErrNotFound) {
+		t.Error("Missing design document should return ErrNotFound, got", err)
+	}
+	fn := `function(doc, req) { return doc.type === req.query.type; }`
+	if err := db.SetFilter("app", "by_type", fn); err != nil {
+		t.Fatal("Setting filter returned error:", err)
+	}
+	if err := db.SetFilter("app", "by_type", fn); err != nil {
+		t.Fatal("Setting same filter again returned error:", err)
+	}
+	if got, err := db.Filter("app", "by_type"); got != fn || err != nil {
+		t.Error("Filter should be stored, got", got, err)
+	}
+	if _, err := db.Filter("app", "other"); !errors.Is(err, couch.ErrNotFound) {
+		t.Error("Missing filter should return ErrNotFound, got", err)
+	}
+	if err := db.DeleteFilter("app", "by_type"); err != nil {
+		t.Fatal("Deleting filter returned error:", err)
+	}
+	if _, err := db.Filter("app", "by_type"); !errors.Is(err, couch.ErrNotFound) {
+		t.Error("Deleted filter should return ErrNotFound, got", err)
+	}
+}
+
+func TestChangesQueryParams(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("filter") != "app/by_type" || q.Get("type") != "person" || q.Get("limit") != "5" {
+			t.Error("Filter and its parameters should be passed, got", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"results":[],"last_seq":"1-a"}`))
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	options := &couch.ChangesOptions{Limit: 5, Filter: "app/by_type", QueryParams: map[string]string{"type": "person", "limit": "100"}}
+	if _, err := db.Changes(options); err != nil {
+		t.Fatal("Reading changes returned error:", err)
+	}
+}
+
+func TestIntegrationFilteredChanges(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	err := db.SetFilter("app", "by_name", `function(doc, req) { return doc.Name === req.query.name; }`)
+	if err != nil {
+		t.Fatal("Setting filter returned error:", err)
+	}
+	insertTestDoc(&Person{Name: "Peter"}, db, t)
+	insertTestDoc(&Person{Name: "Anna"}, db, t)
+	result, err := db.Changes(&couch.ChangesOptions{Filter: "app/by_name", QueryParams: map[string]string{"name": "Anna"}})
+	if err != nil {
+		t.Fatal("Reading filtered changes returned error:", err)
+	}
+	if len(result.Results) != 1 {
+		t.Error("Filtered changes should only contain Anna, got", result.Results)
+	}
+}
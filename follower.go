@@ -0,0 +1,135 @@
+package couch
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Prefix of the ids of the local documents storing checkpoints of followers
+const checkpointIDPrefix = "_local/follower_"
+
+// How often a follower asks for changes once it has caught up, unless configured otherwise
+const defaultPollInterval = time.Second
+
+// Local document storing the checkpoint of a follower
+type checkpointDoc struct {
+	Doc
+	Seq Seq `json:"seq"`
+}
+
+// Follower processes the changes of a database and remembers how far it got in a checkpoint. The
+// checkpoint is stored in a local document of the database, which isn't replicated, so a follower
+// continues where it left off after a restart. Followers are identified by name.
+type Follower struct {
+	db       *Database
+	name     string
+	options  ChangesOptions
+	interval time.Duration
+	rev      string
+}
+
+// Follower returns a follower of the changes of a database.
+func (db *Database) Follower(name string) *Follower {
+	return &Follower{db: db, name: name, interval: defaultPollInterval}
+}
+
+// SetOptions selects the changes a follower processes, e.g. to include documents or to apply
+// a filter. Since, Limit and SeqInterval are managed by the follower and ignored.
+func (f *Follower) SetOptions(options ChangesOptions) {
+	f.options = options
+}
+
+// SetPollInterval sets how often a follower asks for changes once it has caught up, 1s by default.
+func (f *Follower) SetPollInterval(d time.Duration) {
+	f.interval = d
+}
+
+// Checkpoint returns the sequence up to which changes have been processed,
+// empty if the follower hasn't processed any changes yet.
+func (f *Follower) Checkpoint(opts ...Option) (Seq, error) {
+	doc := &checkpointDoc{}
+	err := f.db.Retrieve(checkpointIDPrefix+f.name, doc, opts...)
+	if ErrorType(err) == "not_found" {
+		f.rev = ""
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	f.rev = doc.Rev
+	return doc.Seq, nil
+}
+
+// SetCheckpoint stores the sequence up to which changes have been processed, e.g. SinceNow to
+// skip all changes so far.
+func (f *Follower) SetCheckpoint(seq Seq, opts ...Option) error {
+	if seq == SinceNow {
+		result, err := f.db.Changes(&ChangesOptions{Since: SinceNow, Limit: 1}, opts...)
+		if err != nil {
+			return err
+		}
+		seq = result.LastSeq
+	}
+	doc := &checkpointDoc{Seq: seq}
+	doc.SetIDRev(checkpointIDPrefix+f.name, f.rev)
+	err := f.db.Insert(doc, opts...)
+	if ErrorType(err) == "conflict" {
+		// Checkpoint written by someone else, e.g. a previous instance
+		if _, err = f.Checkpoint(opts...); err != nil {
+			return err
+		}
+		doc.SetIDRev(doc.ID, f.rev)
+		err = f.db.Insert(doc, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	f.rev = doc.Rev
+	return nil
+}
+
+// ProcessBatches passes the changes after the checkpoint to fn in batches of at most batchSize,
+// in the order they happened. The checkpoint is only advanced after fn returned successfully,
+// so every change is processed at least once: if fn or storing the checkpoint fails, the batch
+// is passed to fn again the next time. It keeps waiting for new changes until ctx is done and
+// returns the error of fn, of a request or of ctx.
+func (f *Follower) ProcessBatches(ctx context.Context, batchSize int, fn func([]ChangeEvent) error) error {
+	if batchSize <= 0 {
+		return errors.New("couch: batch size must be positive")
+	}
+	since, err := f.Checkpoint(WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	options := f.options
+	options.Limit = batchSize
+	options.SeqInterval = batchSize
+	for {
+		options.Since = since
+		result, err := f.db.Changes(&options, WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		if len(result.Results) > 0 {
+			if err = fn(result.Results); err != nil {
+				return err
+			}
+			// Record processed changes even if ctx is done by now
+			if err = f.SetCheckpoint(result.LastSeq); err != nil {
+				return err
+			}
+		}
+		since = result.LastSeq
+		if len(result.Results) == batchSize {
+			continue // Not caught up yet
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-f.db.server.done():
+			return ErrServerClosed
+		case <-f.db.server.clock().After(f.interval):
+		}
+	}
+}
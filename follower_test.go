@@ -0,0 +1,102 @@
+package couch_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Serves a changes feed of five changes with integer sequences and stores local documents in memory
+func followerServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	local := make(map[string]map[string]interface{})
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/people/_changes":
+			since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			var results []string
+			last := since
+			for seq := since + 1; seq <= 5 && len(results) < limit; seq++ {
+				results = append(results, fmt.Sprintf(`{"id": "doc%d", "seq": %d, "changes": [{"rev": "1-a"}]}`, seq, seq))
+				last = seq
+			}
+			fmt.Fprintf(w, `{"results": [%s], "last_seq": %d}`, strings.Join(results, ","), last)
+		case r.Method == "GET":
+			doc, ok := local[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error": "not_found", "reason": "missing"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(doc)
+		case r.Method == "PUT":
+			var doc map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&doc)
+			doc["_rev"] = "0-1"
+			local[r.URL.Path] = doc
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok": true, "id": "x", "rev": "0-1"}`))
+		}
+	}))
+}
+
+func TestFollowerProcessBatches(t *testing.T) {
+	t.Parallel()
+	ts := followerServer(t)
+	defer ts.Close()
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	f := db.Follower("etl")
+	f.SetPollInterval(time.Millisecond)
+
+	// Fail on the second batch, the checkpoint must stay after the first one
+	errFailed := errors.New("failed")
+	batches := 0
+	err := f.ProcessBatches(context.Background(), 2, func(changes []couch.ChangeEvent) error {
+		batches++
+		if batches == 2 {
+			return errFailed
+		}
+		return nil
+	})
+	if err != errFailed {
+		t.Fatal("Error of fn should be returned, got", err)
+	}
+	if seq, _ := f.Checkpoint(); seq != "2" {
+		t.Error("Checkpoint should be advanced to the first batch only, got", seq)
+	}
+
+	// Continue from the checkpoint until all changes are processed
+	var processed []string
+	ctx, cancel := context.WithCancel(context.Background())
+	err = db.Follower("etl").ProcessBatches(ctx, 2, func(changes []couch.ChangeEvent) error {
+		for _, c := range changes {
+			processed = append(processed, c.ID)
+		}
+		if len(processed) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Error("Cancelled context should end processing, got", err)
+	}
+	if len(processed) != 3 || processed[0] != "doc3" {
+		t.Error("Processing should continue after the checkpoint, got", processed)
+	}
+	if seq, _ := f.Checkpoint(); seq != "5" {
+		t.Error("Checkpoint should be advanced to the end, got", seq)
+	}
+}
@@ -0,0 +1,98 @@
+package couch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Health is the result of Server.HealthCheck(). Live means the server answers requests, use it
+// for liveness probes. Ready means all checks passed and the server can be used, use it for
+// readiness probes.
+type Health struct {
+	Live   bool
+	Ready  bool
+	Checks []HealthCheckResult
+}
+
+// HealthCheckResult is the result of a single check, Err is nil if it passed.
+type HealthCheckResult struct {
+	Name     string // up, auth or canary
+	Duration time.Duration
+	Err      error
+}
+
+// SetHealthCanary sets a database HealthCheck() reads from to make sure data can be accessed,
+// an empty name (the default) skips this check.
+func (s *Server) SetHealthCanary(db string) {
+	s.canary = db
+}
+
+// HealthCheck checks whether a server is up, accepts its credentials and, if there is a
+// canary database, whether data can be read. Checks after a failed one are skipped.
+func (s *Server) HealthCheck(ctx context.Context, opts ...Option) *Health {
+	opts = withOptions(opts, WithContext(ctx))
+	health := &Health{}
+	checks := []struct {
+		name string
+		fn   func([]Option) error
+	}{
+		{"up", s.checkUp},
+		{"auth", s.checkAuth},
+		{"canary", s.checkCanary},
+	}
+	for _, check := range checks {
+		start := time.Now()
+		err := check.fn(opts)
+		health.Checks = append(health.Checks, HealthCheckResult{Name: check.name, Duration: time.Since(start), Err: err})
+		if err != nil {
+			return health
+		}
+		health.Live = true // The server answers as soon as it is up
+	}
+	health.Ready = true
+	return health
+}
+
+// Check the _up endpoint, servers without it are checked with a request to their root
+func (s *Server) checkUp(opts []Option) error {
+	var result struct {
+		Status string `json:"status"`
+	}
+	_, err := do(s.URL()+"/_up", "GET", s.Cred(), nil, &result, s.withDefaults(opts))
+	if errors.Is(err, ErrNotFound) {
+		return s.ping(opts...)
+	}
+	if err == nil && result.Status != "ok" {
+		err = fmt.Errorf("couch: server status is %s", result.Status)
+	}
+	return err
+}
+
+// Check that the session of the server belongs to the user of its credentials
+func (s *Server) checkAuth(opts []Option) error {
+	if s.Cred() == nil {
+		return nil
+	}
+	var result struct {
+		UserCtx struct {
+			Name string `json:"name"`
+		} `json:"userCtx"`
+	}
+	_, err := do(s.URL()+"/_session", "GET", s.Cred(), nil, &result, s.withDefaults(opts))
+	if err == nil && result.UserCtx.Name != s.Cred().user {
+		err = ErrUnauthorized
+	}
+	return err
+}
+
+// Read a single row from the canary database, if there is one
+func (s *Server) checkCanary(opts []Option) error {
+	if s.canary == "" {
+		return nil
+	}
+	db := s.Database(s.canary)
+	_, err := do(db.URL()+"/_all_docs?limit=1", "GET", db.Cred(), nil, nil, s.withDefaults(opts))
+	return err
+}
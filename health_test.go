@@ -0,0 +1,49 @@
+package couch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestHealthCheck(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		switch r.URL.Path {
+		case "/_up":
+			w.Write([]byte(`{"status":"ok"}`))
+		case "/_session":
+			w.Write([]byte(`{"ok":true,"userCtx":{"name":"` + user + `","roles":[]}}`))
+		case "/canary/_all_docs":
+			w.Write([]byte(`{"total_rows":0,"offset":0,"rows":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not_found","reason":"Database does not exist."}`))
+		}
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, couch.NewCredentials("anna", "secret"))
+	s.SetHealthCanary("canary")
+	health := s.HealthCheck(context.Background())
+	if !health.Live || !health.Ready || len(health.Checks) != 3 {
+		t.Error("Server should be live and ready, got", health)
+	}
+
+	s.SetHealthCanary("missing")
+	health = s.HealthCheck(context.Background())
+	if !health.Live || health.Ready || !errors.Is(health.Checks[2].Err, couch.ErrNotFound) {
+		t.Error("Server with missing canary should be live but not ready, got", health)
+	}
+
+	ts.Close()
+	health = s.HealthCheck(context.Background())
+	if health.Live || health.Ready || len(health.Checks) != 1 || health.Checks[0].Err == nil {
+		t.Error("Unreachable server shouldn't be live, got", health)
+	}
+}
@@ -0,0 +1,198 @@
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Name of the view backing an index within its design document
+const indexViewID = "by_value"
+
+// Index is a secondary index over one or more document fields. It removes the need to
+// write a view for the most common kinds of queries, looking up documents by the values
+// of some of their fields:
+//
+//	idx, _ := db.IndexField("Name")
+//	var people []Person
+//	idx.Lookup("Anna", &people)
+//
+// An index is backed by a view in the design document _design/index_[type_]<fields>.
+type Index struct {
+	db         *Database
+	designID   string
+	docType    string
+	fields     []string
+	descending bool
+}
+
+// IndexField declares an index on a top-level field of the documents in a database. The field
+// is named as in the JSON of a document. The design document backing the index is deployed
+// if it doesn't exist yet, see Conflicts() for possible issues around creating a view.
+func (db *Database) IndexField(field string) (*Index, error) {
+	return db.IndexFields("", field)
+}
+
+// IndexFields declares a compound index on documents of a type, following the convention
+// that documents carry their type in a field named "type". Pass an empty docType to index
+// documents of all types. Keys of a compound index are slices of the values of the fields
+// in the given order, e.g. for IndexFields("person", "Name", "Height"):
+//
+//	idx.Lookup([]interface{}{"Anna", 170}, &people)
+//	idx.Prefix([]interface{}{"Anna"}, &people)
+//	idx.Between([]interface{}{"Anna", 160}, []interface{}{"Anna", 180}, &people)
+//
+// The type is added to the keys automatically.
+func (db *Database) IndexFields(docType string, fields ...string) (*Index, error) {
+	return db.indexFields(docType, fields, nil)
+}
+
+// Implements IndexFields(), deploying the design document with the options of a call
+func (db *Database) indexFields(docType string, fields []string, opts []Option) (*Index, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("couch: index needs at least one field")
+	}
+	name := strings.Join(fields, "_")
+	if docType != "" {
+		name = docType + "_" + name
+	}
+	idx := &Index{db: db, designID: "index_" + name, docType: docType, fields: fields}
+	if err := db.ensureView(idx.designID, indexViewID, idx.view(), opts); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// Descending returns the same index iterating in descending key order.
+// Range boundaries are still passed in ascending order.
+func (idx *Index) Descending() *Index {
+	desc := *idx
+	desc.descending = true
+	return &desc
+}
+
+// Whether keys are slices
+func (idx *Index) compound() bool {
+	return idx.docType != "" || len(idx.fields) > 1
+}
+
+// Map function emitting the values of the indexed fields, documents missing one of them are skipped
+func (idx *Index) view() View {
+	var conds, values []string
+	if idx.docType != "" {
+		docType, _ := json.Marshal(idx.docType)
+		conds = append(conds, fmt.Sprintf("doc.type === %s", docType))
+		values = append(values, string(docType))
+	}
+	for _, field := range idx.fields {
+		f, _ := json.Marshal(field)
+		conds = append(conds, fmt.Sprintf("doc[%s] !== undefined", f))
+		values = append(values, fmt.Sprintf("doc[%s]", f))
+	}
+	key := values[0]
+	if idx.compound() {
+		key = "[" + strings.Join(values, ", ") + "]"
+	}
+	return View{Map: fmt.Sprintf(`function(doc) { if (%s) { emit(%s, null); } }`, strings.Join(conds, " && "), key)}
+}
+
+// Turn a value passed by the user into a key of the view
+func (idx *Index) key(value interface{}) ([]interface{}, error) {
+	if !idx.compound() {
+		return []interface{}{value}, nil
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, errors.New("couch: key of a compound index has to be a []interface{}")
+	}
+	if idx.docType != "" {
+		values = append([]interface{}{idx.docType}, values...)
+	}
+	return values, nil
+}
+
+// Encode a key as a JSON query parameter
+func (idx *Index) param(key []interface{}) (string, error) {
+	var enc []byte
+	var err error
+	if idx.compound() {
+		enc, err = json.Marshal(key)
+	} else {
+		enc, err = json.Marshal(key[0])
+	}
+	return string(enc), err
+}
+
+// Lookup finds all documents whose indexed fields equal value. The documents are written
+// into results which has to be a pointer to a slice, e.g. *[]Person.
+func (idx *Index) Lookup(value interface{}, results interface{}, opts ...Option) error {
+	key, err := idx.key(value)
+	if err != nil {
+		return err
+	}
+	param, err := idx.param(key)
+	if err != nil {
+		return err
+	}
+	return idx.query(map[string]interface{}{"key": param}, results, opts)
+}
+
+// Between finds all documents whose keys lie between start and end, both inclusive.
+func (idx *Index) Between(start, end interface{}, results interface{}, opts ...Option) error {
+	startKey, err := idx.key(start)
+	if err != nil {
+		return err
+	}
+	endKey, err := idx.key(end)
+	if err != nil {
+		return err
+	}
+	return idx.queryRange(startKey, endKey, results, opts)
+}
+
+// Prefix finds all documents whose keys start with prefix. For an index on a single field
+// prefix is a string, for a compound index it is a slice of the values of the leading fields.
+func (idx *Index) Prefix(prefix interface{}, results interface{}, opts ...Option) error {
+	startKey, err := idx.key(prefix)
+	if err != nil {
+		return err
+	}
+	if !idx.compound() {
+		s, ok := prefix.(string)
+		if !ok {
+			return errors.New("couch: prefix of a single field index has to be a string")
+		}
+		_, end := StringPrefixRange(s)
+		return idx.queryRange(startKey, []interface{}{end}, results, opts)
+	}
+	startKey, endKey := ArrayPrefixRange(startKey...)
+	return idx.queryRange(startKey, endKey, results, opts)
+}
+
+// Query a key range in the direction of the index
+func (idx *Index) queryRange(startKey, endKey []interface{}, results interface{}, opts []Option) error {
+	if idx.descending {
+		startKey, endKey = endKey, startKey
+	}
+	start, err := idx.param(startKey)
+	if err != nil {
+		return err
+	}
+	end, err := idx.param(endKey)
+	if err != nil {
+		return err
+	}
+	return idx.query(map[string]interface{}{"startkey": start, "endkey": end}, results, opts)
+}
+
+// Query the view backing the index including documents
+func (idx *Index) query(options map[string]interface{}, results interface{}, opts []Option) error {
+	options["include_docs"] = true
+	options["descending"] = idx.descending
+	result, err := idx.db.Query(idx.designID, indexViewID, options, opts...)
+	if err != nil {
+		return err
+	}
+	return result.decodeDocs(results, idx.db.Codec())
+}
@@ -0,0 +1,76 @@
+package couch_test
+
+import "testing"
+
+func TestIntegrationIndexField(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	insertTestDoc(&Person{Name: "Peter", Height: 185}, db, t)
+	insertTestDoc(&Person{Name: "Anna", Height: 170}, db, t)
+	insertTestDoc(&Person{Name: "Anna", Height: 160}, db, t)
+
+	idx, err := db.IndexField("Name")
+	if err != nil {
+		t.Fatal("Declaring index returned error:", err)
+	}
+	var people []Person
+	err = idx.Lookup("Anna", &people)
+	if err != nil {
+		t.Fatal("Looking up documents by index returned error:", err)
+	}
+	if len(people) != 2 || people[0].Name != "Anna" || people[0].ID == "" {
+		t.Error("Lookup should return both documents named Anna, got", people)
+	}
+
+	// Declaring the same index again must not fail
+	if _, err = db.IndexField("Name"); err != nil {
+		t.Error("Declaring existing index returned error:", err)
+	}
+}
+
+type TypedPerson struct {
+	Person
+	Type string `json:"type"`
+}
+
+func TestIntegrationIndexFields(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	for _, p := range []Person{{Name: "Anna", Height: 160}, {Name: "Anna", Height: 170}, {Name: "Andreas", Height: 180}, {Name: "Peter", Height: 185}} {
+		insertTestDoc(&TypedPerson{Person: p, Type: "person"}, db, t)
+	}
+	insertTestDoc(&Person{Name: "Anna", Height: 150}, db, t) // untyped
+
+	idx, err := db.IndexFields("person", "Name", "Height")
+	if err != nil {
+		t.Fatal("Declaring compound index returned error:", err)
+	}
+
+	var people []Person
+	if err = idx.Lookup([]interface{}{"Anna", 170}, &people); err != nil || len(people) != 1 {
+		t.Error("Lookup by compound key should return 1 document, got", people, err)
+	}
+	people = nil
+	if err = idx.Prefix([]interface{}{"Anna"}, &people); err != nil || len(people) != 2 {
+		t.Error("Prefix query should return 2 typed documents named Anna, got", people, err)
+	}
+	people = nil
+	if err = idx.Between([]interface{}{"Anna", 165}, []interface{}{"Peter"}, &people); err != nil || len(people) != 1 {
+		t.Error("Range query should return 1 document, got", people, err)
+	}
+	people = nil
+	if err = idx.Descending().Prefix([]interface{}{"Anna"}, &people); err != nil || len(people) != 2 || people[0].Height != 170 {
+		t.Error("Descending prefix query should start with the tallest Anna, got", people, err)
+	}
+
+	single, err := db.IndexField("Name")
+	if err != nil {
+		t.Fatal("Declaring index returned error:", err)
+	}
+	people = nil
+	if err = single.Prefix("An", &people); err != nil || len(people) != 4 {
+		t.Error("String prefix query should return 4 documents, got", people, err)
+	}
+}
@@ -0,0 +1,112 @@
+package couch
+
+import "sort"
+
+// Options restricting a view query to a part of the view
+var viewRangeOptions = []string{"key", "keys", "startkey", "endkey", "start_key", "end_key"}
+
+// IndexUsageAnalyzer checks which indexes the queries of an application use. Register the
+// queries an application runs, then call Analyze() to find unused Mango indexes and queries
+// scanning everything, to guide index cleanup:
+//
+//	report, _ := db.IndexUsageAnalyzer().
+//		AddFind("active users", &couch.FindQuery{Selector: map[string]interface{}{"active": true}}).
+//		AddQuery("people by name", "people", "by_name", map[string]interface{}{"key": `"Anna"`}).
+//		Analyze()
+//	fmt.Println(report.FullScans, report.UnusedIndexes)
+type IndexUsageAnalyzer struct {
+	db    *Database
+	finds []namedFind
+	views []namedViewQuery
+}
+
+// Mango query registered with an analyzer
+type namedFind struct {
+	name  string
+	query *FindQuery
+}
+
+// View query registered with an analyzer
+type namedViewQuery struct {
+	name     string
+	designID string
+	viewID   string
+	options  map[string]interface{}
+}
+
+// IndexUsageReport is the result of analyzing the queries of an application.
+type IndexUsageReport struct {
+	QueryIndexes  map[string]string // Name of every query mapped to the index it uses, "<ddoc>/<name>" or "<design>/<view>"
+	FullScans     []string          // Names of queries reading a whole index or all documents
+	MissingViews  []string          // Names of view queries whose view doesn't exist
+	UnusedIndexes []MangoIndex      // Mango indexes no registered query uses
+}
+
+// IndexUsageAnalyzer returns an analyzer without any queries.
+func (db *Database) IndexUsageAnalyzer() *IndexUsageAnalyzer {
+	return &IndexUsageAnalyzer{db: db}
+}
+
+// AddFind registers a Mango query under a name used in the report.
+func (a *IndexUsageAnalyzer) AddFind(name string, q *FindQuery) *IndexUsageAnalyzer {
+	a.finds = append(a.finds, namedFind{name, q})
+	return a
+}
+
+// AddQuery registers a view query under a name used in the report, options are the ones passed to Query().
+func (a *IndexUsageAnalyzer) AddQuery(name, designID, viewID string, options map[string]interface{}) *IndexUsageAnalyzer {
+	a.views = append(a.views, namedViewQuery{name, designID, viewID, options})
+	return a
+}
+
+// Analyze explains all registered Mango queries and checks all registered view queries.
+// A view query counts as a full scan if it doesn't restrict the keys it reads.
+func (a *IndexUsageAnalyzer) Analyze(opts ...Option) (*IndexUsageReport, error) {
+	report := &IndexUsageReport{QueryIndexes: make(map[string]string)}
+	used := make(map[string]bool)
+	for _, f := range a.finds {
+		explanation, err := a.db.Explain(f.query, opts...)
+		if err != nil {
+			return nil, err
+		}
+		id := explanation.Index.DesignDoc + "/" + explanation.Index.Name
+		report.QueryIndexes[f.name] = id
+		used[id] = true
+		if explanation.Index.FullScan() {
+			report.FullScans = append(report.FullScans, f.name)
+		}
+	}
+	for _, v := range a.views {
+		if !a.db.HasView(v.designID, v.viewID) {
+			report.MissingViews = append(report.MissingViews, v.name)
+			continue
+		}
+		report.QueryIndexes[v.name] = v.designID + "/" + v.viewID
+		if !restrictsKeys(v.options) {
+			report.FullScans = append(report.FullScans, v.name)
+		}
+	}
+
+	indexes, err := a.db.MangoIndexes(opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, idx := range indexes {
+		if !idx.FullScan() && !used[idx.DesignDoc+"/"+idx.Name] {
+			report.UnusedIndexes = append(report.UnusedIndexes, idx)
+		}
+	}
+	sort.Strings(report.FullScans)
+	sort.Strings(report.MissingViews)
+	return report, nil
+}
+
+// Whether view query options restrict the keys that are read
+func restrictsKeys(options map[string]interface{}) bool {
+	for _, opt := range viewRangeOptions {
+		if _, ok := options[opt]; ok {
+			return true
+		}
+	}
+	return false
+}
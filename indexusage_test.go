@@ -0,0 +1,60 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestIndexUsageAnalyzer(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/people/_explain":
+			var q couch.FindQuery
+			json.NewDecoder(r.Body).Decode(&q)
+			if _, ok := q.Selector["name"]; ok {
+				w.Write([]byte(`{"index": {"ddoc": "_design/idx", "name": "by-name", "type": "json"}}`))
+			} else {
+				w.Write([]byte(`{"index": {"ddoc": null, "name": "_all_docs", "type": "special"}}`))
+			}
+		case "/people/_index":
+			w.Write([]byte(`{"indexes": [
+				{"ddoc": null, "name": "_all_docs", "type": "special"},
+				{"ddoc": "_design/idx", "name": "by-name", "type": "json"},
+				{"ddoc": "_design/idx", "name": "by-age", "type": "json"}]}`))
+		case "/people/_design/people/_view/by_name":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	report, err := couch.NewServer(ts.URL, nil).Database("people").IndexUsageAnalyzer().
+		AddFind("by name", &couch.FindQuery{Selector: map[string]interface{}{"name": "Anna"}}).
+		AddFind("active", &couch.FindQuery{Selector: map[string]interface{}{"active": true}}).
+		AddQuery("view by name", "people", "by_name", map[string]interface{}{"key": `"Anna"`}).
+		AddQuery("all names", "people", "by_name", nil).
+		AddQuery("by age", "people", "by_age", nil).
+		Analyze()
+	if err != nil {
+		t.Fatal("Analyzing index usage returned error:", err)
+	}
+	if report.QueryIndexes["by name"] != "_design/idx/by-name" {
+		t.Error("Query should use index by-name, got", report.QueryIndexes)
+	}
+	if !reflect.DeepEqual(report.FullScans, []string{"active", "all names"}) {
+		t.Error("Unexpected full scans", report.FullScans)
+	}
+	if !reflect.DeepEqual(report.MissingViews, []string{"by age"}) {
+		t.Error("Unexpected missing views", report.MissingViews)
+	}
+	if len(report.UnusedIndexes) != 1 || report.UnusedIndexes[0].Name != "by-age" {
+		t.Error("Index by-age should be unused, got", report.UnusedIndexes)
+	}
+}
@@ -0,0 +1,184 @@
+package couch
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Seq is an update sequence of a database. CouchDB 1.x uses integers, 2.x and later opaque
+// strings. Both are kept as a string and encoded in their original form again.
+type Seq string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Seq) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*s = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		str, err := strconv.Unquote(string(data))
+		if err != nil {
+			return err
+		}
+		*s = Seq(str)
+		return nil
+	}
+	*s = Seq(data)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Seq) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return []byte("null"), nil
+	}
+	if _, err := strconv.ParseInt(string(s), 10, 64); err == nil {
+		return []byte(s), nil
+	}
+	return []byte(strconv.Quote(string(s))), nil
+}
+
+// Number returns the number of updates a sequence stands for. For sequences of CouchDB 2.x and
+// later this is their numeric prefix, which is only an approximation in clustered setups.
+func (s Seq) Number() int64 {
+	n, _ := strconv.ParseInt(strings.SplitN(string(s), "-", 2)[0], 10, 64)
+	return n
+}
+
+// Exact returns true if a sequence is a plain number, as in CouchDB 1.x, so that comparing it with
+// another one is exact. Sequences of CouchDB 2.x and later combine the sequences of all shards,
+// which can't be ordered reliably, they must only be passed back to CouchDB as they are.
+func (s Seq) Exact() bool {
+	_, err := strconv.ParseInt(string(s), 10, 64)
+	return err == nil
+}
+
+// Compare returns -1 if s stands for fewer updates than other, 1 if it stands for more and 0 if
+// both stand for the same number. The empty sequence stands for the beginning of a database. Use it
+// to reason about progress, e.g. whether a checkpoint moved on, not to decide where to continue a
+// feed: unless both sequences are Exact(), the order is only approximate, see Number().
+func (s Seq) Compare(other Seq) int {
+	a, b := s.Number(), other.Number()
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Behind returns how many updates s is behind other, e.g. the pending changes of a replication
+// with s as its checkpoint and other as the update sequence of its source. It is never negative
+// and as approximate as Compare().
+func (s Seq) Behind(other Seq) int64 {
+	if d := other.Number() - s.Number(); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// DatabaseInfo describes the state of a database, see
+// http://docs.couchdb.org/en/latest/api/database/common.html#get--db
+type DatabaseInfo struct {
+	Name           string `json:"db_name"`
+	DocCount       int64  `json:"doc_count"`
+	DocDelCount    int64  `json:"doc_del_count"`
+	UpdateSeq      Seq    `json:"update_seq"`
+	CompactRunning bool   `json:"compact_running"`
+	DiskSize       int64  `json:"disk_size"` // CouchDB 1.x
+	DataSize       int64  `json:"data_size"` // CouchDB 1.x
+	Sizes          struct {
+		File     int64 `json:"file"`
+		External int64 `json:"external"`
+		Active   int64 `json:"active"`
+	} `json:"sizes"` // CouchDB 2.x and later
+}
+
+// FileSize returns the size of the database file on disk in bytes.
+func (info *DatabaseInfo) FileSize() int64 {
+	if info.Sizes.File > 0 {
+		return info.Sizes.File
+	}
+	return info.DiskSize
+}
+
+// ActiveSize returns the size of the live data inside the database file in bytes.
+func (info *DatabaseInfo) ActiveSize() int64 {
+	if info.Sizes.Active > 0 {
+		return info.Sizes.Active
+	}
+	return info.DataSize
+}
+
+// Fragmentation returns the share of the database file that compaction would free, from 0 to 1.
+func (info *DatabaseInfo) Fragmentation() float64 {
+	file := info.FileSize()
+	if file <= 0 {
+		return 0
+	}
+	frag := 1 - float64(info.ActiveSize())/float64(file)
+	if frag < 0 {
+		return 0
+	}
+	return frag
+}
+
+// Info returns information about a database.
+func (db *Database) Info(opts ...Option) (*DatabaseInfo, error) {
+	info := &DatabaseInfo{}
+	_, err := do(db.URL(), "GET", db.Cred(), nil, info, db.server.withDefaults(opts))
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Most databases CouchDB describes in a single _dbs_info request by default
+const dbsInfoBatchSize = 100
+
+// Entry of a _dbs_info response, Info is nil for missing databases
+type dbsInfoRow struct {
+	Key   string        `json:"key"`
+	Info  *DatabaseInfo `json:"info"`
+	Error string        `json:"error"`
+}
+
+// DatabasesInfo returns information about many databases by name, e.g. for a dashboard over
+// thousands of per-user databases, with one request per 100 databases instead of one per database.
+// Databases that don't exist are missing from the result. It needs CouchDB 2.2 or later.
+func (s *Server) DatabasesInfo(names []string, opts ...Option) (map[string]*DatabaseInfo, error) {
+	infos := make(map[string]*DatabaseInfo, len(names))
+	for start := 0; start < len(names); start += dbsInfoBatchSize {
+		end := start + dbsInfoBatchSize
+		if end > len(names) {
+			end = len(names)
+		}
+		byQualified := make(map[string]string, end-start)
+		keys := make([]string, 0, end-start)
+		for _, name := range names[start:end] {
+			qualified := s.qualifiedName(name)
+			byQualified[qualified] = name
+			keys = append(keys, qualified)
+		}
+		var rows []dbsInfoRow
+		body := map[string][]string{"keys": keys}
+		if _, err := do(s.URL()+"/_dbs_info", "POST", s.Cred(), body, &rows, s.withDefaults(opts)); err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if row.Info != nil && row.Error == "" {
+				infos[byQualified[row.Key]] = row.Info
+			}
+		}
+	}
+	return infos, nil
+}
+
+// Compact starts compacting a database. CouchDB compacts in the background,
+// use Info() to find out whether compaction is still running.
+func (db *Database) Compact(opts ...Option) error {
+	_, err := do(db.URL()+"/_compact", "POST", db.Cred(), nil, nil, db.server.withDefaults(opts))
+	return err
+}
@@ -0,0 +1,141 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestSeq(t *testing.T) {
+	t.Parallel()
+	for _, enc := range []string{`42`, `"42-g1AAAABXeJzLYWBgYMpgTmHgz8"`, `null`} {
+		var s couch.Seq
+		if err := json.Unmarshal([]byte(enc), &s); err != nil {
+			t.Fatal("Decoding sequence returned error:", err)
+		}
+		out, _ := json.Marshal(s)
+		if string(out) != enc {
+			t.Errorf("Sequence %s should be encoded in its original form, got %s", enc, out)
+		}
+		if enc != `null` && s.Number() != 42 {
+			t.Errorf("Sequence %s should stand for 42 updates, got %d", enc, s.Number())
+		}
+	}
+}
+
+func TestSeqCompare(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		a, b    couch.Seq
+		compare int
+		behind  int64
+		exact   bool
+	}{
+		{"3", "12", -1, 9, true},
+		{"12-g1AAAABXeJzLYWBgYMpgTmHgz8", "9-g1AAAABXeJzLYWBgYMpgTmHgz4", 1, 0, false},
+		{"", "5-abc", -1, 5, false},
+		{"7", "7-abc", 0, 0, true},
+	}
+	for _, test := range tests {
+		if c := test.a.Compare(test.b); c != test.compare {
+			t.Errorf("Comparing %s with %s should return %d, got %d", test.a, test.b, test.compare, c)
+		}
+		if c := test.b.Compare(test.a); c != -test.compare {
+			t.Errorf("Comparing %s with %s should return %d, got %d", test.b, test.a, -test.compare, c)
+		}
+		if d := test.a.Behind(test.b); d != test.behind {
+			t.Errorf("%s should be %d behind %s, got %d", test.a, test.behind, test.b, d)
+		}
+		if test.a.Exact() != test.exact {
+			t.Errorf("%s should be exact: %v", test.a, test.exact)
+		}
+	}
+}
+
+func TestInfo(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1":
+			w.Write([]byte(`{"db_name":"v1","doc_count":3,"update_seq":12,"disk_size":1000,"data_size":250}`))
+		case "/v2":
+			w.Write([]byte(`{"db_name":"v2","doc_count":3,"update_seq":"12-abc","sizes":{"file":1000,"external":300,"active":250}}`))
+		}
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	for _, name := range []string{"v1", "v2"} {
+		info, err := s.Database(name).Info()
+		if err != nil {
+			t.Fatal("Retrieving info returned error:", err)
+		}
+		if info.Name != name || info.DocCount != 3 || info.UpdateSeq.Number() != 12 {
+			t.Error("Info should be decoded, got", info)
+		}
+		if info.FileSize() != 1000 || info.Fragmentation() != 0.75 {
+			t.Errorf("%s: expected file size 1000 and fragmentation 0.75, got %d and %f", name, info.FileSize(), info.Fragmentation())
+		}
+	}
+}
+
+func TestIntegrationInfo(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+	insertTestDoc(&Person{Name: "Peter"}, db, t)
+
+	info, err := db.Info()
+	if err != nil {
+		t.Fatal("Retrieving info returned error:", err)
+	}
+	if info.DocCount != 1 || info.UpdateSeq.Number() != 1 {
+		t.Error("Info should count one document and one update, got", info)
+	}
+	if err = db.Compact(); err != nil {
+		t.Error("Compacting database returned error:", err)
+	}
+}
+
+func TestDatabasesInfo(t *testing.T) {
+	t.Parallel()
+	var requests [][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/_dbs_info" {
+			t.Error("Infos should be requested in bulk, got", r.Method, r.URL.Path)
+		}
+		var body struct{ Keys []string }
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body.Keys)
+		var rows []map[string]interface{}
+		for _, key := range body.Keys {
+			if key == "test_missing" {
+				rows = append(rows, map[string]interface{}{"key": key, "error": "not_found"})
+			} else {
+				rows = append(rows, map[string]interface{}{"key": key, "info": map[string]interface{}{"db_name": key, "doc_count": 7}})
+			}
+		}
+		json.NewEncoder(w).Encode(rows)
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	s.SetDatabasePrefix("test_")
+	names := []string{"missing"}
+	for i := 0; i < 150; i++ {
+		names = append(names, fmt.Sprintf("user%d", i))
+	}
+	infos, err := s.DatabasesInfo(names)
+	if err != nil {
+		t.Fatal("Getting infos returned error:", err)
+	}
+	if len(requests) != 2 || len(requests[0]) != 100 || requests[0][1] != "test_user0" {
+		t.Error("Databases should be requested in batches of 100 with their prefix, got", len(requests))
+	}
+	if len(infos) != 150 || infos["missing"] != nil || infos["user149"].DocCount != 7 {
+		t.Error("Existing databases should be returned by name, got", len(infos), infos["user149"])
+	}
+}
@@ -0,0 +1,136 @@
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournalEntry is a call recorded in the journal of a server, see SetJournal().
+type JournalEntry struct {
+	Time     time.Time
+	Method   string
+	Endpoint string // Path relative to the server, without parameters
+	// ParamsHash tells apart calls to the same endpoint with different parameters or bodies,
+	// without keeping their content, which might be confidential
+	ParamsHash string
+	Duration   time.Duration
+	StatusCode int // 0 if there was no response
+	Err        error
+	RequestID  string
+}
+
+// Ring buffer of calls
+type journal struct {
+	mu      sync.Mutex
+	baseURL string
+	entries []JournalEntry
+	size    int
+	next    int
+}
+
+// SetJournal makes a server record its last size calls in memory, to be attached to bug
+// reports about flows like replication followed by conflict resolution, see Journal().
+// Pass 0 to stop recording, this also discards the calls recorded so far.
+func (s *Server) SetJournal(size int) {
+	if size <= 0 {
+		s.journal = nil
+		return
+	}
+	s.journal = &journal{baseURL: s.url, size: size}
+}
+
+// Journal returns the calls recorded by a server, the oldest first.
+func (s *Server) Journal() []JournalEntry {
+	return s.journal.list(func(JournalEntry) bool { return true })
+}
+
+// Journal returns the calls to a database recorded by its server, the oldest first.
+// Calls to server endpoints like starting a replication aren't included, see Server.Journal().
+func (db *Database) Journal() []JournalEntry {
+	endpoint := "/" + db.server.qualifiedName(db.name)
+	return db.server.journal.list(func(e JournalEntry) bool {
+		return e.Endpoint == endpoint || strings.HasPrefix(e.Endpoint, endpoint+"/")
+	})
+}
+
+// Record the calls of a request in a journal
+func journalTo(j *journal) Option {
+	return func(o *callOptions) {
+		o.journal = j
+	}
+}
+
+// Entries of a journal passing keep, the oldest first
+func (j *journal) list(keep func(JournalEntry) bool) []JournalEntry {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var entries []JournalEntry
+	for _, e := range append(append([]JournalEntry(nil), j.entries[j.next:]...), j.entries[:j.next]...) {
+		if keep(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Record a call started at start
+func (j *journal) record(method, rawURL string, body interface{}, resp *http.Response, err error, start time.Time) {
+	if j == nil {
+		return
+	}
+	e := JournalEntry{Time: start, Method: method, Duration: time.Since(start), Err: err}
+	endpoint, query := rawURL, ""
+	if i := strings.IndexByte(endpoint, '?'); i >= 0 {
+		endpoint, query = endpoint[:i], endpoint[i+1:]
+	}
+	if strings.HasPrefix(endpoint, j.baseURL) {
+		e.Endpoint = strings.TrimPrefix(endpoint, j.baseURL)
+	} else if u, parseErr := url.Parse(endpoint); parseErr == nil {
+		e.Endpoint = u.Path
+	}
+	if e.Endpoint == "/_session" {
+		// Logins send a password, even its hash could be brute-forced
+		body = nil
+	}
+	e.ParamsHash = paramsHash(query, body)
+	var cErr couchError
+	switch {
+	case resp != nil:
+		e.StatusCode, e.RequestID = resp.StatusCode, responseRequestID(resp, "")
+	case errors.As(err, &cErr):
+		e.StatusCode, e.RequestID = cErr.StatusCode, cErr.RequestID
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.entries) < j.size {
+		j.entries = append(j.entries, e)
+		return
+	}
+	j.entries[j.next] = e
+	j.next = (j.next + 1) % j.size
+}
+
+// Hash of the parameters and body of a call
+func paramsHash(query string, body interface{}) string {
+	h := fnv.New64a()
+	h.Write([]byte(query))
+	if body != nil {
+		raw, ok := body.(json.RawMessage)
+		if !ok {
+			raw, _ = json.Marshal(body)
+		}
+		h.Write(raw)
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,78 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestJournal(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Couch-Request-ID", "req-"+r.Method)
+		switch r.URL.Path {
+		case "/people/anna":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "not_found", "reason": "missing"}`))
+		case "/_replicate":
+			w.Write([]byte(`{"ok": true}`))
+		default:
+			w.Write([]byte(`{"rows": []}`))
+		}
+	}))
+	defer ts.Close()
+
+	server := couch.NewServer(ts.URL, nil)
+	db := server.Database("people")
+	db.Query("people", "by_name", map[string]interface{}{"key": "Anna"})
+	if len(server.Journal()) != 0 {
+		t.Error("Calls shouldn't be recorded unless asked for")
+	}
+	server.SetJournal(3)
+	db.Retrieve("anna", &Person{})
+	db.Query("people", "by_name", map[string]interface{}{"key": "Anna"})
+	db.Query("people", "by_name", map[string]interface{}{"key": "Bert"})
+	db.Retrieve("anna", &Person{})
+	db.ReplicateTo(server.Database("archive"), false)
+
+	all := server.Journal()
+	if len(all) != 3 || all[2].Endpoint != "/_replicate" {
+		t.Fatal("Server should keep the last three calls, got", all)
+	}
+	entries := db.Journal()
+	if len(entries) != 2 {
+		t.Fatal("Database should only report its own calls, got", entries)
+	}
+	if view := entries[0]; view.Method != "GET" || view.Endpoint != "/people/_design/people/_view/by_name" || view.StatusCode != 200 || view.Err != nil {
+		t.Error("Query should be recorded without its parameters, got", view)
+	}
+	if doc := entries[1]; doc.StatusCode != 404 || doc.Err == nil || doc.RequestID != "req-GET" || doc.ParamsHash == "" {
+		t.Error("Failed retrieval should be recorded with its outcome, got", doc)
+	}
+	server.SetJournal(2)
+	db.Query("people", "by_name", map[string]interface{}{"key": "Anna"})
+	db.Query("people", "by_name", map[string]interface{}{"key": "Bert"})
+	if entries = db.Journal(); entries[0].ParamsHash == entries[1].ParamsHash {
+		t.Error("Calls with different parameters should have different hashes, got", entries)
+	}
+}
+
+func TestJournalLogin(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: "cookie"})
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer ts.Close()
+
+	server := couch.NewServer(ts.URL, nil)
+	server.SetJournal(2)
+	server.Login("anna", "secret")
+	server.Login("anna", "other")
+	entries := server.Journal()
+	if len(entries) != 2 || entries[0].Endpoint != "/_session" || entries[0].ParamsHash != entries[1].ParamsHash {
+		t.Error("Logins should be recorded without hashing their passwords, got", entries)
+	}
+}
@@ -0,0 +1,64 @@
+package couch
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// MaxDocumentDepth limits how deeply objects and arrays may be nested in documents and view results
+// received from CouchDB. Documents often originate from users, a limit keeps a malicious document
+// from making decoding expensive. Deeper documents are rejected with a *DocumentError.
+var MaxDocumentDepth = 512
+
+// DocumentError is returned when a document or view result received from CouchDB is rejected
+// before decoding, because it is nested deeper than MaxDocumentDepth or isn't valid UTF-8.
+// encoding/json would otherwise silently replace invalid bytes, so that an id or field decoded
+// from such a document differs from the one stored. Offset is the position in the response body.
+//
+// Numbers that don't fit the type they are decoded into are reported by the codec, e.g. as a
+// *json.UnmarshalTypeError. Use JSONCodec with UseNumber to keep integers beyond 2^53 intact
+// in interface{} values, DynamicDoc always does.
+type DocumentError struct {
+	Offset int
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *DocumentError) Error() string {
+	return fmt.Sprintf("couch: rejected document (%s at offset %d)", e.Reason, e.Offset)
+}
+
+// Check a JSON response before a codec decodes it. Invalid JSON is left for the codec to report.
+func checkDocument(data []byte) error {
+	depth := 0
+	inString, escaped := false, false
+	for i := 0; i < len(data); {
+		c := data[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size == 1 {
+				return &DocumentError{Offset: i, Reason: "invalid UTF-8"}
+			}
+			i += size
+			escaped = false
+			continue
+		}
+		switch {
+		case inString && escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			if depth++; depth > MaxDocumentDepth {
+				return &DocumentError{Offset: i, Reason: fmt.Sprintf("nested deeper than %d levels", MaxDocumentDepth)}
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+		i++
+	}
+	return nil
+}
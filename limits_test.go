@@ -0,0 +1,85 @@
+package couch_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Transport answering every request with the same body, without a network
+type staticBody []byte
+
+func (b staticBody) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(bytes.NewReader(b)),
+		Request:    req,
+	}, nil
+}
+
+// Database whose responses are all body
+func staticDatabase(body []byte) *couch.Database {
+	server := couch.NewServer("http://static.invalid", nil)
+	server.SetHTTPClient(&http.Client{Transport: staticBody(body)})
+	return server.Database("people")
+}
+
+func TestDocumentLimits(t *testing.T) {
+	t.Parallel()
+	deep := `{"_id": "anna", "a": ` + strings.Repeat("[", couch.MaxDocumentDepth) + strings.Repeat("]", couch.MaxDocumentDepth) + `}`
+	var docErr *couch.DocumentError
+	if err := staticDatabase([]byte(deep)).Retrieve("anna", &couch.DynamicDoc{}); !errors.As(err, &docErr) {
+		t.Error("Documents nested too deeply should be rejected, got", err)
+	}
+	invalid := []byte("{\"_id\": \"anna\", \"Name\": \"An\xffna\"}")
+	if err := staticDatabase(invalid).Retrieve("anna", &Person{}); !errors.As(err, &docErr) || docErr.Offset != 27 {
+		t.Error("Documents with invalid UTF-8 should be rejected, got", err)
+	}
+	escaped := `{"_id": "anna", "Name": "\"[[{\\"}`
+	if err := staticDatabase([]byte(escaped)).Retrieve("anna", &Person{}); err != nil {
+		t.Error("Brackets in strings shouldn't count as nesting, got", err)
+	}
+	var idErr *couch.InvalidIDError
+	if err := staticDatabase(nil).Insert(&Person{Doc: couch.Doc{ID: "an\xffna"}}); !errors.As(err, &idErr) {
+		t.Error("Ids with invalid UTF-8 should be rejected, got", err)
+	}
+}
+
+func FuzzRetrieve(f *testing.F) {
+	f.Add([]byte(`{"_id": "anna", "_rev": "1-a", "Name": "Anna", "Height": 170}`))
+	f.Add([]byte(`{"_id": "anna", "Height": 1e400, "n": 123456789012345678901234567890}`))
+	f.Add([]byte(`{"_id": "anna", "a": [[[[[[[[[[[[{"b": {}}]]]]]]]]]]]]}`))
+	f.Add([]byte("{\"_id\": \"an\xffna\", \"\xc3\x28\": 1}"))
+	f.Add([]byte(`{"_id": "\ud800", "Name": "\"]]]"}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		db := staticDatabase(body)
+		doc := couch.DynamicDoc{}
+		if err := db.Retrieve("anna", &doc); err == nil {
+			if id, _ := doc.IDRev(); !utf8.ValidString(id) {
+				t.Error("Decoded id should be valid UTF-8, got", id)
+			}
+		}
+		db.Retrieve("anna", &Person{})
+		db.Retrieve("anna", &PersonWithExtras{})
+	})
+}
+
+func FuzzInsertID(f *testing.F) {
+	f.Add("anna")
+	f.Add("_design/people")
+	f.Add("an\xffna")
+	f.Fuzz(func(t *testing.T, id string) {
+		err := staticDatabase([]byte(`{"ok": true, "id": "anna", "rev": "1-a"}`)).Insert(&Person{Doc: couch.Doc{ID: id}})
+		var idErr *couch.InvalidIDError
+		if !utf8.ValidString(id) && !errors.As(err, &idErr) {
+			t.Error("Ids with invalid UTF-8 should be rejected, got", err)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package couch
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Prefix of the ids of lock documents
+const lockIDPrefix = "lock:"
+
+// ErrLocked is returned by Lock() if another owner holds a lock that hasn't expired.
+var ErrLocked = errors.New("couch: resource is locked by another owner")
+
+// ErrLockLost is returned when a lock has been taken over by another owner,
+// usually because it expired before it could be renewed.
+var ErrLockLost = errors.New("couch: lock has been taken over by another owner")
+
+// Content of a lock document
+type lockDoc struct {
+	Doc
+	Resource string    `json:"resource"`
+	Owner    string    `json:"owner"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Lock is a lock on a resource, held by a single owner. It is implemented as a document
+// with the id "lock:<resourceID>", mutual exclusion is guaranteed by CouchDB rejecting
+// conflicting revisions. Note that this only holds within a single database, don't rely
+// on locks across replicated databases.
+type Lock struct {
+	db       *Database
+	resource string
+	owner    string
+	ttl      time.Duration
+
+	mu       sync.Mutex
+	doc      *lockDoc
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Lock acquires a lock on a resource for an owner. A lock expires after ttl unless it is renewed,
+// this is done automatically in the background until Unlock() is called. Expired locks of other
+// owners are taken over. If the resource is locked by another owner, ErrLocked is returned.
+// Acquiring a lock again with the same owner succeeds. Closing the server stops renewing the lock,
+// it is released once its ttl has passed.
+func (db *Database) Lock(resourceID, owner string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		return nil, errors.New("couch: lock ttl must be positive")
+	}
+	l := &Lock{db: db, resource: resourceID, owner: owner, ttl: ttl}
+	if err := l.acquire(); err != nil {
+		return nil, err
+	}
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	err := db.server.register(l, func() error {
+		l.stopHeartbeat()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	go l.heartbeat()
+	return l, nil
+}
+
+// Create the lock document or take over an expired or own one
+func (l *Lock) acquire() error {
+	clock := l.db.server.clock()
+	doc := &lockDoc{Resource: l.resource, Owner: l.owner, Expires: clock.Now().Add(l.ttl)}
+	doc.ID = lockIDPrefix + l.resource
+	err := l.db.Insert(doc)
+	if ErrorType(err) == "conflict" {
+		current := new(lockDoc)
+		if err = l.db.Retrieve(doc.ID, current); err != nil {
+			return err
+		}
+		if current.Owner != l.owner && clock.Now().Before(current.Expires) {
+			return ErrLocked
+		}
+		// Stale or own lock, whoever writes first wins
+		doc.Rev = current.Rev
+		err = l.db.Insert(doc)
+		if ErrorType(err) == "conflict" {
+			return ErrLocked
+		}
+	}
+	if err != nil {
+		return err
+	}
+	l.doc = doc
+	return nil
+}
+
+// Renew extends the lock by its ttl. It returns ErrLockLost if another owner took over the lock.
+func (l *Lock) Renew() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.doc == nil {
+		return ErrLockLost
+	}
+	doc := *l.doc
+	doc.Expires = l.db.server.clock().Now().Add(l.ttl)
+	err := l.db.Insert(&doc)
+	if ErrorType(err) == "conflict" {
+		l.doc = nil
+		return ErrLockLost
+	}
+	if err != nil {
+		return err
+	}
+	l.doc = &doc
+	return nil
+}
+
+// Unlock stops renewing the lock and releases it by deleting the lock document.
+func (l *Lock) Unlock() error {
+	l.stopHeartbeat()
+	l.db.server.unregister(l)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.doc == nil {
+		return ErrLockLost
+	}
+	err := l.db.Delete(l.doc.ID, l.doc.Rev)
+	l.doc = nil
+	if ErrorType(err) == "conflict" {
+		return ErrLockLost
+	}
+	return err
+}
+
+// Held returns whether the lock is still held as far as this client knows.
+func (l *Lock) Held() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.doc != nil && l.db.server.clock().Now().Before(l.doc.Expires)
+}
+
+// Stop renewing the lock and wait for the heartbeat to end
+func (l *Lock) stopHeartbeat() {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+}
+
+// Renew the lock every third of its ttl until it is released, lost or the server is closed
+func (l *Lock) heartbeat() {
+	defer close(l.done)
+	clock := l.db.server.clock()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-clock.After(l.ttl / 3):
+			if err := l.Renew(); err == ErrLockLost || errors.Is(err, ErrServerClosed) {
+				return
+			}
+		}
+	}
+}
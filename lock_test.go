@@ -0,0 +1,93 @@
+package couch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestIntegrationLock(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	lock, err := db.Lock("invoices", "worker1", time.Minute)
+	if err != nil {
+		t.Fatal("Acquiring lock returned error:", err)
+	}
+	if !lock.Held() {
+		t.Error("Acquired lock should be reported as held")
+	}
+
+	// Another owner must not get the lock
+	_, err = db.Lock("invoices", "worker2", time.Minute)
+	if err != couch.ErrLocked {
+		t.Fatal("Acquiring held lock should return ErrLocked, got", err)
+	}
+
+	err = lock.Unlock()
+	if err != nil {
+		t.Fatal("Releasing lock returned error:", err)
+	}
+	lock, err = db.Lock("invoices", "worker2", time.Minute)
+	if err != nil {
+		t.Fatal("Acquiring released lock returned error:", err)
+	}
+	lock.Unlock()
+}
+
+func TestIntegrationLockTakeover(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	// Lock left behind by a crashed worker
+	stale := couch.DynamicDoc{"owner": "worker1", "expires": time.Now().Add(-time.Minute)}
+	stale.SetIDRev("lock:invoices", "")
+	insertTestDoc(stale, db, t)
+
+	lock, err := db.Lock("invoices", "worker2", time.Minute)
+	if err != nil {
+		t.Fatal("Taking over expired lock returned error:", err)
+	}
+	defer lock.Unlock()
+}
+
+func TestLockServerClose(t *testing.T) {
+	t.Parallel()
+	var renewals int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Error("Unexpected request", r.Method, r.URL)
+		}
+		n := atomic.AddInt32(&renewals, 1)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"ok": true, "id": "lock:invoices", "rev": "%d-a"}`, n)
+	}))
+	defer ts.Close()
+	s := couch.NewServer(ts.URL, nil)
+
+	lock, err := s.Database("db").Lock("invoices", "worker1", 30*time.Millisecond)
+	if err != nil {
+		t.Fatal("Acquiring lock returned error:", err)
+	}
+	time.Sleep(50 * time.Millisecond) // Renewed a few times
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatal("Closing server returned error:", err)
+	}
+	closed := atomic.LoadInt32(&renewals)
+	time.Sleep(50 * time.Millisecond)
+	if closed < 2 || atomic.LoadInt32(&renewals) != closed {
+		t.Error("Lock should be renewed until the server is closed, got renewals:", closed, atomic.LoadInt32(&renewals))
+	}
+	if err := lock.Unlock(); !errors.Is(err, couch.ErrServerClosed) {
+		t.Error("Releasing lock of closed server should return ErrServerClosed, got", err)
+	}
+}
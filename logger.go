@@ -0,0 +1,18 @@
+package couch
+
+// Logger receives messages about noteworthy events, like slow queries. *log.Logger implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// SetLogger sets the logger of a server and its databases, nil (the default) disables logging.
+func (s *Server) SetLogger(l Logger) {
+	s.logger = l
+}
+
+// Log a message if the server has a logger
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,152 @@
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// FindQuery is a Mango query, see http://docs.couchdb.org/en/latest/api/database/find.html
+type FindQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Fields   []string               `json:"fields,omitempty"`
+	Sort     []interface{}          `json:"sort,omitempty"`
+	Limit    int                    `json:"limit,omitempty"`
+	Skip     int                    `json:"skip,omitempty"`
+	UseIndex interface{}            `json:"use_index,omitempty"`
+	Bookmark string                 `json:"bookmark,omitempty"`
+}
+
+// FindResult holds what CouchDB reports about a Mango query besides the documents.
+// Pass Bookmark to the next query to get the next page of results.
+type FindResult struct {
+	Bookmark string
+	Warning  string
+}
+
+// Find runs a Mango query and writes the matching documents into docs, a pointer to a slice.
+// They are decoded with the codec of the database.
+func (db *Database) Find(q *FindQuery, docs interface{}, opts ...Option) (*FindResult, error) {
+	key := cacheKey("find", "_find", q)
+	seq, cached := db.cache.lookup(db, key, opts)
+	if cached != nil {
+		if err := db.Codec().Unmarshal(cached.docs, docs); err != nil {
+			return nil, err
+		}
+		find := cached.find
+		return &find, nil
+	}
+	start := time.Now()
+	var result struct {
+		Docs     json.RawMessage `json:"docs"`
+		Bookmark string          `json:"bookmark"`
+		Warning  string          `json:"warning"`
+	}
+	resp, err := do(db.URL()+"/_find", "POST", db.Cred(), q, &result, db.server.withDefaults(opts))
+	if err == nil {
+		err = db.Codec().Unmarshal(result.Docs, docs)
+	}
+	db.recordQuery("find", "_find", q, sliceLen(docs), resp, err, start)
+	if err != nil {
+		return nil, err
+	}
+	find := FindResult{Bookmark: result.Bookmark, Warning: result.Warning}
+	db.cache.store(seq, &cacheEntry{key: key, docs: result.Docs, find: find})
+	return &find, nil
+}
+
+// MangoIndex describes an index used by Mango queries.
+type MangoIndex struct {
+	DesignDoc string `json:"ddoc"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Def       struct {
+		Fields                []map[string]string    `json:"fields"`
+		PartialFilterSelector map[string]interface{} `json:"partial_filter_selector,omitempty"`
+	} `json:"def"`
+}
+
+// FullScan returns true for the special index CouchDB falls back to when no other index
+// matches a query, which means scanning all documents.
+func (idx *MangoIndex) FullScan() bool {
+	return idx.Type == "special"
+}
+
+// Explanation describes how CouchDB would run a Mango query.
+type Explanation struct {
+	Index    MangoIndex             `json:"index"`
+	Selector map[string]interface{} `json:"selector"`
+	Opts     map[string]interface{} `json:"opts"`
+	Limit    int                    `json:"limit"`
+	Skip     int                    `json:"skip"`
+	Fields   interface{}            `json:"fields"`
+	Range    map[string]interface{} `json:"range"`
+}
+
+// Explain returns which index CouchDB would use for a Mango query, without running it.
+func (db *Database) Explain(q *FindQuery, opts ...Option) (*Explanation, error) {
+	explanation := &Explanation{}
+	_, err := do(db.URL()+"/_explain", "POST", db.Cred(), q, explanation, db.server.withDefaults(opts))
+	if err != nil {
+		return nil, err
+	}
+	return explanation, nil
+}
+
+// MangoIndexes returns all indexes of a database that can be used by Mango queries,
+// including the special _all_docs index.
+func (db *Database) MangoIndexes(opts ...Option) ([]MangoIndex, error) {
+	var result struct {
+		Indexes []MangoIndex `json:"indexes"`
+	}
+	_, err := do(db.URL()+"/_index", "GET", db.Cred(), nil, &result, db.server.withDefaults(opts))
+	return result.Indexes, err
+}
+
+// CreatedMangoIndex reports the outcome of CreateMangoIndex(). Created is false if an identical
+// index already existed, DesignDoc and Name are the ones CouchDB generated if def left them empty.
+type CreatedMangoIndex struct {
+	DesignDoc string `json:"id"`
+	Name      string `json:"name"`
+	Created   bool   `json:"-"`
+}
+
+// CreateMangoIndex creates an index for Mango queries unless an identical one exists, which
+// CouchDB checks on its own, so it is safe to call on every start of an application.
+func (db *Database) CreateMangoIndex(def MangoIndexDef, opts ...Option) (*CreatedMangoIndex, error) {
+	if len(def.Fields) == 0 {
+		return nil, errors.New("couch: mango index needs at least one field")
+	}
+	index := map[string]interface{}{"fields": def.Fields}
+	if def.PartialFilterSelector != nil {
+		index["partial_filter_selector"] = def.PartialFilterSelector
+	}
+	body := map[string]interface{}{"index": index, "type": "json"}
+	if def.Name != "" {
+		body["name"] = def.Name
+	}
+	if def.DesignDoc != "" {
+		body["ddoc"] = def.DesignDoc
+	}
+	var result struct {
+		CreatedMangoIndex
+		Result string `json:"result"`
+	}
+	if _, err := do(db.URL()+"/_index", "POST", db.Cred(), body, &result, db.server.withDefaults(opts)); err != nil {
+		return nil, err
+	}
+	created := result.CreatedMangoIndex
+	created.Created = result.Result == "created"
+	return &created, nil
+}
+
+// DeleteMangoIndex deletes an index for Mango queries, designDoc may be given with or
+// without the _design/ prefix.
+func (db *Database) DeleteMangoIndex(designDoc, name string, opts ...Option) error {
+	designDoc = strings.TrimPrefix(designDoc, "_design/")
+	url := db.URL() + "/_index/" + url.PathEscape(designDoc) + "/json/" + url.PathEscape(name)
+	_, err := do(url, "DELETE", db.Cred(), nil, nil, db.server.withDefaults(opts))
+	return err
+}
@@ -0,0 +1,98 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestIntegrationFind(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+	insertTestDoc(&Person{Name: "Peter", Height: 185}, db, t)
+	insertTestDoc(&Person{Name: "Anna", Height: 170}, db, t)
+
+	q := &couch.FindQuery{Selector: map[string]interface{}{"Height": map[string]interface{}{"$gt": 180}}}
+	var people []Person
+	if _, err := db.Find(q, &people); err != nil {
+		t.Fatal("Finding documents returned error:", err)
+	}
+	if len(people) != 1 || people[0].Name != "Peter" || people[0].ID == "" {
+		t.Error("Find should return Peter, got", people)
+	}
+
+	explanation, err := db.Explain(q)
+	if err != nil {
+		t.Fatal("Explaining query returned error:", err)
+	}
+	if !explanation.Index.FullScan() {
+		t.Error("Query without index should be a full scan, got", explanation.Index)
+	}
+	_, err = server().EnsureDatabase(testDB, &couch.DatabaseSetup{
+		MangoIndexes: []couch.MangoIndexDef{{Name: "by-height", Fields: []string{"Height"}}},
+	})
+	if err != nil {
+		t.Fatal("Creating Mango index returned error:", err)
+	}
+	if explanation, err = db.Explain(q); err != nil || explanation.Index.Name != "by-height" {
+		t.Error("Query should use index, got", explanation, err)
+	}
+}
+
+func TestMangoIndexManagement(t *testing.T) {
+	t.Parallel()
+	var created, deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/db/_index":
+			var body struct {
+				Index struct {
+					Fields                []string               `json:"fields"`
+					PartialFilterSelector map[string]interface{} `json:"partial_filter_selector"`
+				} `json:"index"`
+				Name string `json:"name"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Index.PartialFilterSelector["type"] != "person" {
+				t.Error("Partial filter selector should be sent, got", body.Index)
+			}
+			result := "created"
+			for _, name := range created {
+				if name == body.Name {
+					result = "exists"
+				}
+			}
+			created = append(created, body.Name)
+			fmt.Fprintf(w, `{"result": "%s", "id": "_design/a5f4", "name": "%s"}`, result, body.Name)
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+			w.Write([]byte(`{"ok": true}`))
+		default:
+			t.Error("Unexpected request", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	def := couch.MangoIndexDef{Name: "people-by-name", Fields: []string{"name"}, PartialFilterSelector: map[string]interface{}{"type": "person"}}
+	idx, err := db.CreateMangoIndex(def)
+	if err != nil || !idx.Created || idx.DesignDoc != "_design/a5f4" || idx.Name != "people-by-name" {
+		t.Fatal("Creating Mango index should report the new index, got", idx, err)
+	}
+	if idx, err = db.CreateMangoIndex(def); err != nil || idx.Created {
+		t.Error("Creating an existing Mango index shouldn't report it as created, got", idx, err)
+	}
+	if _, err = db.CreateMangoIndex(couch.MangoIndexDef{Name: "empty"}); err == nil {
+		t.Error("Mango index without fields should be rejected")
+	}
+	if err = db.DeleteMangoIndex(idx.DesignDoc, idx.Name); err != nil {
+		t.Fatal("Deleting Mango index returned error:", err)
+	}
+	if len(deleted) != 1 || deleted[0] != "/db/_index/a5f4/json/people-by-name" {
+		t.Error("Unexpected delete request", deleted)
+	}
+}
@@ -0,0 +1,130 @@
+package couch
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Database replications are configured in unless a manifest says otherwise
+const replicatorDB = "_replicator"
+
+// Manifest declares the databases of a CouchDB instance and the replications between them.
+// Apply it with Server.Apply() to provision an instance from a file kept under version control:
+//
+//	{
+//		"databases": [{
+//			"name": "people",
+//			"security": {"members": {"roles": ["staff"]}},
+//			"mango_indexes": [{"name": "by-name", "fields": ["name"]}]
+//		}],
+//		"replications": [{
+//			"id": "people-backup",
+//			"source": "http://localhost:5984/people",
+//			"target": "http://backup:5984/people",
+//			"continuous": true
+//		}]
+//	}
+//
+// Manifests are read from JSON by LoadManifest(). For YAML, convert the document to JSON first,
+// e.g. with github.com/ghodss/yaml, and pass the result to LoadManifest().
+type Manifest struct {
+	Databases    []ManifestDatabase    `json:"databases,omitempty"`
+	Replications []ManifestReplication `json:"replications,omitempty"`
+}
+
+// ManifestDatabase declares a database of a manifest, see DatabaseSetup for its elements.
+type ManifestDatabase struct {
+	Name string `json:"name"`
+	DatabaseSetup
+}
+
+// ManifestReplication declares a replication that is managed by a document with the given id
+// in the _replicator database. Source and target are database URLs.
+type ManifestReplication struct {
+	ID           string `json:"id"`
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	Continuous   bool   `json:"continuous,omitempty"`
+	CreateTarget bool   `json:"create_target,omitempty"`
+
+	// Credentials passed as auth objects instead of URL userinfo, see ReplicationAuthBasic
+	sourceCred *Credentials
+	targetCred *Credentials
+}
+
+// LoadManifest reads a manifest from JSON. Unknown keys are an error, they are most likely typos.
+// This includes elements of design documents that DesignDoc has no field for.
+func LoadManifest(r io.Reader) (*Manifest, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	m := &Manifest{}
+	if err := dec.Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Apply brings a CouchDB instance in line with a manifest. Missing databases are created and set
+// up with EnsureDatabase(), replication documents are created or updated if they differ. Nothing
+// declared elsewhere is removed. Applying the same manifest again doesn't change anything.
+func (s *Server) Apply(m *Manifest, opts ...Option) error {
+	for i := range m.Databases {
+		def := &m.Databases[i]
+		if _, err := s.EnsureDatabase(def.Name, &def.DatabaseSetup, opts...); err != nil {
+			return err
+		}
+	}
+	for _, repl := range m.Replications {
+		if err := s.ensureReplication(repl, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Document in the _replicator database, State is maintained by CouchDB
+type replicatorDoc struct {
+	Doc
+	Source       replEndpoint     `json:"source"`
+	Target       replEndpoint     `json:"target"`
+	Continuous   bool             `json:"continuous,omitempty"`
+	CreateTarget bool             `json:"create_target,omitempty"`
+	State        ReplicationState `json:"_replication_state,omitempty"`
+}
+
+// Whether a replication document describes a declared replication
+func (doc *replicatorDoc) matches(repl ManifestReplication) bool {
+	return doc.Source.equal(repl.source()) && doc.Target.equal(repl.target()) &&
+		doc.Continuous == repl.Continuous && doc.CreateTarget == repl.CreateTarget
+}
+
+// Source of a declared replication
+func (repl ManifestReplication) source() replEndpoint {
+	return replEndpoint{url: repl.Source, cred: repl.sourceCred}
+}
+
+// Target of a declared replication
+func (repl ManifestReplication) target() replEndpoint {
+	return replEndpoint{url: repl.Target, cred: repl.targetCred}
+}
+
+// Create or update the replication document of a declared replication
+func (s *Server) ensureReplication(repl ManifestReplication, opts []Option) error {
+	db := s.Database(replicatorDB)
+	existing := &replicatorDoc{}
+	err := db.Retrieve(repl.ID, existing, opts...)
+	if err != nil && ErrorType(err) != "not_found" {
+		return err
+	}
+	if err == nil && existing.matches(repl) {
+		return nil
+	}
+	doc := &replicatorDoc{
+		Source:       repl.source(),
+		Target:       repl.target(),
+		Continuous:   repl.Continuous,
+		CreateTarget: repl.CreateTarget,
+	}
+	doc.SetIDRev(repl.ID, existing.Rev)
+	return db.Insert(doc, opts...)
+}
@@ -0,0 +1,87 @@
+package couch_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+const testManifest = `{
+	"databases": [{
+		"name": "couch_test_go",
+		"security": {"members": {"names": [], "roles": ["staff"]}},
+		"design_docs": [{"_id": "_design/people", "views": {"by_name": {"map": "function(doc) { emit(doc.Name, null); }"}}}],
+		"indexes": [{"fields": ["Height"]}],
+		"mango_indexes": [{"name": "by-name", "fields": ["Name"]}]
+	}],
+	"replications": [{
+		"id": "couch_test_manifest",
+		"source": "http://localhost:5984/couch_test_go",
+		"target": "http://localhost:5984/couch_test_repl",
+		"create_target": true
+	}]
+}`
+
+func TestLoadManifest(t *testing.T) {
+	t.Parallel()
+	m, err := couch.LoadManifest(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatal("Loading manifest returned error:", err)
+	}
+	if len(m.Databases) != 1 || m.Databases[0].Name != "couch_test_go" {
+		t.Fatal("Manifest should declare one database, got", m.Databases)
+	}
+	db := m.Databases[0]
+	if db.Security == nil || db.Security.Members.Roles[0] != "staff" {
+		t.Error("Security should be loaded, got", db.Security)
+	}
+	if len(db.DesignDocs) != 1 || db.DesignDocs[0].Name() != "people" || db.DesignDocs[0].Views["by_name"].Map == "" {
+		t.Error("Design document should be loaded, got", db.DesignDocs)
+	}
+	if len(db.MangoIndexes) != 1 || db.MangoIndexes[0].Fields[0] != "Name" {
+		t.Error("Mango index should be loaded, got", db.MangoIndexes)
+	}
+	if len(m.Replications) != 1 || !m.Replications[0].CreateTarget {
+		t.Error("Replication should be loaded, got", m.Replications)
+	}
+
+	if _, err = couch.LoadManifest(strings.NewReader(`{"databse": []}`)); err == nil {
+		t.Error("Unknown keys should be an error")
+	}
+}
+
+func TestIntegrationApplyManifest(t *testing.T) {
+	db := database()
+	if db.Exists() {
+		db.DropDatabase()
+	}
+	m, err := couch.LoadManifest(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatal("Loading manifest returned error:", err)
+	}
+	if err = server().Apply(m); err != nil {
+		t.Fatal("Applying manifest returned error:", err)
+	}
+	defer tearDownDatabase(db, t)
+	replicator := server().Database("_replicator")
+	defer func() {
+		doc := couch.DynamicDoc{}
+		if replicator.Retrieve("couch_test_manifest", &doc) == nil {
+			replicator.Delete(doc.IDRev())
+		}
+		server().Database(testReplDB).DropDatabase()
+	}()
+	rev := m.Databases[0].DesignDocs[0].Rev
+
+	// Applying the same manifest again must not change anything
+	if err = server().Apply(m); err != nil {
+		t.Fatal("Applying manifest again returned error:", err)
+	}
+	if m.Databases[0].DesignDocs[0].Rev != rev {
+		t.Error("Unchanged design document should not be written again")
+	}
+	if !db.HasView("people", "by_name") {
+		t.Error("Design document should be deployed")
+	}
+}
@@ -0,0 +1,160 @@
+package couch
+
+// Number of documents mass operations read and write per request
+const matchBatchSize = 200
+
+// Number of times UpdateMatching() tries to write a document that is edited concurrently
+const maxUpdateAttempts = 5
+
+// MatchResult counts the documents a mass operation matched, wrote successfully
+// and failed to write, e.g. because of a conflict with a concurrent edit.
+type MatchResult struct {
+	Matched int
+	Written int
+	Failed  int
+}
+
+// Page through all documents matching a Mango selector, restricted to fields unless
+// it is empty, and pass every page to fn. Failures are reported as a *BatchError.
+func (db *Database) eachMatchPage(selector map[string]interface{}, fields []string, fn func([]DynamicDoc) error, opts []Option) error {
+	limit := newCallOptions(opts).batchSize
+	if limit <= 0 {
+		limit = matchBatchSize
+	}
+	q := &FindQuery{Selector: selector, Fields: fields, Limit: limit}
+	for committed := 0; ; committed++ {
+		var docs []DynamicDoc
+		result, err := db.Find(q, &docs, opts...)
+		if err != nil {
+			return &BatchError{Committed: committed, Err: err}
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+		if err = fn(docs); err != nil {
+			return &BatchError{Committed: committed, Err: err}
+		}
+		q.Bookmark = result.Bookmark
+	}
+}
+
+// Write a batch of documents and count the outcome
+func (db *Database) writeBatch(bulk *Bulk, result *MatchResult, opts []Option) error {
+	results, err := db.insertBulk(bulk, false, opts)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Ok {
+			result.Written++
+		} else {
+			result.Failed++
+		}
+	}
+	return nil
+}
+
+// DeleteMatching deletes all documents matching a Mango selector, see FindQuery. Documents
+// are found and deleted in batches, deleting a document fails if it is edited at the same time.
+// Written counts the deleted documents. An error is only returned if a request fails, the
+// documents deleted up to that point stay deleted, see BatchError. Pass WithProgress() to
+// follow the progress.
+func (db *Database) DeleteMatching(selector map[string]interface{}, opts ...Option) (*MatchResult, error) {
+	o := newCallOptions(opts)
+	result := &MatchResult{}
+	err := db.eachMatchPage(selector, []string{"_id", "_rev"}, func(docs []DynamicDoc) error {
+		result.Matched += len(docs)
+		bulk := new(Bulk)
+		for _, doc := range docs {
+			doc.MarkDeleted()
+			bulk.Add(doc)
+		}
+		if err := db.writeBatch(bulk, result, opts); err != nil {
+			return err
+		}
+		o.reportProgress(*result)
+		return nil
+	}, opts)
+	return result, err
+}
+
+// UpdateMatching applies transform to all documents matching a Mango selector and writes back
+// the ones it reports as changed, e.g. to migrate data:
+//
+//	db.UpdateMatching(map[string]interface{}{"type": "person"}, func(doc couch.DynamicDoc) bool {
+//		doc["name"] = strings.TrimSpace(doc["name"].(string))
+//		return true
+//	}, couch.WithProgress(func(r couch.MatchResult) { log.Println(r.Matched, "processed") }))
+//
+// Documents are processed in batches. If a document is edited at the same time, transform is
+// applied to its latest revision again, a few times at most. Documents deleted in the meantime
+// are skipped. An error is only returned if a request fails, documents written up to that
+// point stay written. The error is a *BatchError telling how many batches have been processed,
+// e.g. when the deadline of the context passed to WithContext() is exceeded. Calling
+// UpdateMatching() again resumes the migration if transform reports documents it has already
+// migrated as unchanged.
+func (db *Database) UpdateMatching(selector map[string]interface{}, transform func(doc DynamicDoc) (changed bool), opts ...Option) (*MatchResult, error) {
+	o := newCallOptions(opts)
+	result := &MatchResult{}
+	err := db.eachMatchPage(selector, nil, func(docs []DynamicDoc) error {
+		result.Matched += len(docs)
+		var changed []DynamicDoc
+		for _, doc := range docs {
+			if transform(doc) {
+				changed = append(changed, doc)
+			}
+		}
+		if err := db.updateBatch(changed, transform, result, opts); err != nil {
+			return err
+		}
+		o.reportProgress(*result)
+		return nil
+	}, opts)
+	return result, err
+}
+
+// Write a batch of transformed documents, transforming the latest revisions of conflicting ones again
+func (db *Database) updateBatch(docs []DynamicDoc, transform func(DynamicDoc) bool, result *MatchResult, opts []Option) error {
+	for attempt := 1; len(docs) > 0; attempt++ {
+		bulk := new(Bulk)
+		for _, doc := range docs {
+			bulk.Add(doc)
+		}
+		results, err := db.insertBulk(bulk, false, opts)
+		if err != nil {
+			return err
+		}
+		var conflicting []string
+		for _, r := range results {
+			switch {
+			case r.Ok:
+				result.Written++
+			case r.Error == "conflict" && attempt < maxUpdateAttempts:
+				conflicting = append(conflicting, r.ID)
+			default:
+				result.Failed++
+			}
+		}
+		if len(conflicting) == 0 {
+			return nil
+		}
+		rows, err := db.allDocsByKeys(conflicting, true, opts)
+		if err != nil {
+			return err
+		}
+		docs = nil
+		for _, row := range rows {
+			if row.Error != "" || row.Value.Deleted {
+				continue
+			}
+			var doc DynamicDoc
+			if err = db.Codec().Unmarshal(row.Doc, &doc); err != nil {
+				return err
+			}
+			if transform(doc) {
+				docs = append(docs, doc)
+			}
+		}
+	}
+	return nil
+}
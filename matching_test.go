@@ -0,0 +1,162 @@
+package couch_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Serves _find in pages of two documents and accepts all bulk writes but the ones for the
+// first revision of doc3, which has been edited concurrently
+func matchingServer(t *testing.T, written *[]map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/people/_find":
+			var q couch.FindQuery
+			json.NewDecoder(r.Body).Decode(&q)
+			pages := map[string]string{
+				"":   `{"docs": [{"_id": "doc1", "_rev": "1-a", "n": 1}, {"_id": "doc2", "_rev": "1-a", "n": 2}], "bookmark": "b1"}`,
+				"b1": `{"docs": [{"_id": "doc3", "_rev": "1-a", "n": 3}], "bookmark": "b2"}`,
+				"b2": `{"docs": [], "bookmark": "b2"}`,
+			}
+			w.Write([]byte(pages[q.Bookmark]))
+		case "/people/_bulk_docs":
+			var body struct {
+				Docs []map[string]interface{}
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			var results []string
+			for _, doc := range body.Docs {
+				*written = append(*written, doc)
+				if doc["_id"] == "doc3" && doc["_rev"] == "1-a" {
+					results = append(results, `{"id": "doc3", "error": "conflict", "reason": "Document update conflict."}`)
+				} else {
+					results = append(results, fmt.Sprintf(`{"id": "%s", "rev": "2-b", "ok": true}`, doc["_id"]))
+				}
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, "[%s]", strings.Join(results, ","))
+		case "/people/_all_docs":
+			w.Write([]byte(`{"rows": [{"id": "doc3", "key": "doc3", "value": {"rev": "2-c"}, "doc": {"_id": "doc3", "_rev": "2-c", "n": 30}}]}`))
+		default:
+			t.Error("Unexpected request", r.URL.Path)
+		}
+	}))
+}
+
+func TestDeleteMatching(t *testing.T) {
+	t.Parallel()
+	var written []map[string]interface{}
+	ts := matchingServer(t, &written)
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	result, err := db.DeleteMatching(map[string]interface{}{"n": map[string]interface{}{"$gt": 0}})
+	if err != nil {
+		t.Fatal("Deleting documents returned error:", err)
+	}
+	if *result != (couch.MatchResult{Matched: 3, Written: 2, Failed: 1}) {
+		t.Error("Unexpected counts", result)
+	}
+	for _, doc := range written {
+		if doc["_deleted"] != true {
+			t.Error("Documents should be marked deleted, got", doc)
+		}
+	}
+}
+
+func TestIntegrationDeleteMatching(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+	insertTestDoc(&Person{Name: "Peter", Height: 185}, db, t)
+	insertTestDoc(&Person{Name: "Anna", Height: 170}, db, t)
+	insertTestDoc(&Person{Name: "Paul", Height: 190}, db, t)
+
+	result, err := db.DeleteMatching(map[string]interface{}{"Height": map[string]interface{}{"$gt": 180}})
+	if err != nil {
+		t.Fatal("Deleting documents returned error:", err)
+	}
+	if result.Matched != 2 || result.Written != 2 {
+		t.Error("Two documents should be deleted, got", result)
+	}
+	info, _ := db.Info()
+	if info.DocCount != 1 {
+		t.Error("One document should remain, got", info.DocCount)
+	}
+}
+
+func TestUpdateMatching(t *testing.T) {
+	t.Parallel()
+	var written []map[string]interface{}
+	ts := matchingServer(t, &written)
+	defer ts.Close()
+
+	var progress []couch.MatchResult
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	result, err := db.UpdateMatching(map[string]interface{}{}, func(doc couch.DynamicDoc) bool {
+		if doc["_id"] == "doc2" {
+			return false
+		}
+		doc["migrated"] = true
+		return true
+	}, couch.WithProgress(func(r couch.MatchResult) { progress = append(progress, r) }))
+	if err != nil {
+		t.Fatal("Updating documents returned error:", err)
+	}
+	if *result != (couch.MatchResult{Matched: 3, Written: 2}) {
+		t.Error("Unexpected counts", result)
+	}
+	if len(progress) != 2 || progress[0].Matched != 2 {
+		t.Error("Progress should be reported after every batch, got", progress)
+	}
+	last := written[len(written)-1]
+	if last["_rev"] != "2-c" || last["n"] != float64(30) || last["migrated"] != true {
+		t.Error("Conflicting document should be transformed again in its latest revision, got", last)
+	}
+}
+
+func TestUpdateMatchingInterrupted(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/people/_find":
+			var q couch.FindQuery
+			json.NewDecoder(r.Body).Decode(&q)
+			if q.Limit != 1 {
+				t.Error("Batch size should limit the page size, got", q.Limit)
+			}
+			if q.Bookmark != "" {
+				<-r.Context().Done() // Second page takes too long
+				return
+			}
+			w.Write([]byte(`{"docs": [{"_id": "doc1", "_rev": "1-a", "n": 1}], "bookmark": "b1"}`))
+		case "/people/_bulk_docs":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`[{"id": "doc1", "rev": "2-b", "ok": true}]`))
+		}
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := db.UpdateMatching(map[string]interface{}{}, func(doc couch.DynamicDoc) bool {
+		doc["n"] = 10
+		return true
+	}, couch.WithContext(ctx), couch.WithBatchSize(1))
+	var batchErr *couch.BatchError
+	if !errors.As(err, &batchErr) || batchErr.Committed != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("Deadline should stop the operation after the first batch, got", err)
+	}
+	if result.Written != 1 {
+		t.Error("Documents written before the deadline should be counted, got", result)
+	}
+}
@@ -0,0 +1,228 @@
+package couch
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Option changes the behaviour of a single call. Most methods that talk
+// to CouchDB accept any number of options as their last arguments.
+type Option func(*callOptions)
+
+// Settings collected from the options of a single call
+type callOptions struct {
+	response *Response
+	codec    Codec
+	timeout  time.Duration
+	ctx      context.Context
+	progress func(MatchResult)
+	strict   bool
+	client   *http.Client
+	cred     *Credentials
+	repl     []func(*replRequest)
+	closing  <-chan struct{}
+
+	userAgent  string
+	clientName string
+	journal    *journal
+	session    *session
+
+	merge        BulkResolver
+	mergeRetries int
+	batchSize    int
+}
+
+// Apply all options in order, later options win
+func newCallOptions(opts []Option) *callOptions {
+	o := &callOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Combine options passed by the caller with internal ones, without
+// modifying the caller's slice
+func withOptions(opts []Option, extra ...Option) []Option {
+	combined := make([]Option, 0, len(opts)+len(extra))
+	return append(append(combined, opts...), extra...)
+}
+
+// Prepend the defaults of a server to the options of a call, so that the call can override them
+func (s *Server) withDefaults(opts []Option) []Option {
+	if s.timeout <= 0 {
+		return s.withClient(opts)
+	}
+	return s.withClient(append([]Option{WithTimeout(s.timeout)}, opts...))
+}
+
+// Prepend the HTTP client of a server to the options of a call, if it has one,
+// identify the client and make the call end early when the server is closed
+func (s *Server) withClient(opts []Option) []Option {
+	defaults := []Option{closeWith(s.done()), identifyAs(s.userAgent, s.clientName), journalTo(s.journal), useSession(s.session)}
+	if s.client != nil {
+		defaults = append(defaults, useClient(s.client))
+	}
+	return append(defaults, opts...)
+}
+
+// WithHTTPClient makes a call use c instead of the HTTP client of its server, e.g. to send a
+// single call through a different proxy or to use a configured client with Do().
+func WithHTTPClient(c *http.Client) Option {
+	return useClient(c)
+}
+
+// Send the request of a call with an HTTP client
+func useClient(c *http.Client) Option {
+	return func(o *callOptions) {
+		o.client = c
+	}
+}
+
+// HTTP client of a call, http.DefaultClient unless the server has its own
+func (o *callOptions) httpClient() *http.Client {
+	if o.client == nil {
+		return http.DefaultClient
+	}
+	return o.client
+}
+
+// Decode successful responses with a codec
+func decodeWith(c Codec) Option {
+	return func(o *callOptions) {
+		o.codec = c
+	}
+}
+
+// Codec for successful responses, encoding/json by default. StrictDecode() only
+// applies to documents, which are decoded with the codec of their database.
+func (o *callOptions) decoder() Codec {
+	if o.codec == nil {
+		return JSONCodec{}
+	}
+	codec := o.codec
+	if o.strict {
+		switch c := codec.(type) {
+		case JSONCodec:
+			c.DisallowUnknownFields = true
+			return c
+		case ConventionCodec:
+			c.DisallowUnknownFields = true
+			return c
+		}
+	}
+	return codec
+}
+
+// StrictDecode makes a call fail if documents or view rows contain fields the value they are
+// decoded into has no place for, instead of silently dropping them. Type mismatches are
+// always reported. Structs with an Extras field accept any fields. Only JSONCodec and
+// ConventionCodec support this, other codecs decode as they always do.
+func StrictDecode() Option {
+	return func(o *callOptions) {
+		o.strict = true
+	}
+}
+
+// WithResponse makes a call store details of CouchDB's HTTP response in r,
+// this includes error responses.
+func WithResponse(r *Response) Option {
+	return func(o *callOptions) {
+		o.response = r
+	}
+}
+
+// WithContext makes a call end early when ctx is done. A timeout set with
+// WithTimeout() or SetTimeout() applies on top of it.
+func WithContext(ctx context.Context) Option {
+	return func(o *callOptions) {
+		o.ctx = ctx
+	}
+}
+
+// Context of a call, the background context unless the caller passed one
+func (o *callOptions) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+// WithCredentials makes a call authenticate with cred instead of the credentials of its database
+// or server, e.g. to write a design document as an admin through a database handle of a regular user.
+func WithCredentials(cred *Credentials) Option {
+	return func(o *callOptions) {
+		o.cred = cred
+	}
+}
+
+// WithTimeout limits the time a call may take, including reading the response.
+// It overrides the default timeout of the server, pass 0 to wait indefinitely.
+func WithTimeout(d time.Duration) Option {
+	return func(o *callOptions) {
+		o.timeout = d
+	}
+}
+
+// WithMerge makes Insert() resolve a conflict instead of failing: it fetches the latest revision,
+// passes it to merge along with the document and writes what merge returns, up to maxRetries times.
+// Return doc itself from merge, carrying the current revision id, for it to receive the new revision
+// id, a different document receives it instead. Return nil to give up with the conflict error.
+// See InsertBulkResolving() to do the same for a bulk of documents. Other calls ignore it.
+func WithMerge(merge BulkResolver, maxRetries int) Option {
+	return func(o *callOptions) {
+		o.merge = merge
+		o.mergeRetries = maxRetries
+	}
+}
+
+// WithBatchSize makes InsertBulk() send documents in batches of at most n per request, so that
+// a large bulk makes progress even if a deadline stops it, see BatchError. Mass operations like
+// UpdateMatching() process n documents per batch instead of 200. Other calls ignore it.
+func WithBatchSize(n int) Option {
+	return func(o *callOptions) {
+		o.batchSize = n
+	}
+}
+
+// WithProgress makes a mass operation like UpdateMatching() report its progress after every
+// batch of documents, fn receives the counts so far. Other calls ignore it.
+func WithProgress(fn func(MatchResult)) Option {
+	return func(o *callOptions) {
+		o.progress = fn
+	}
+}
+
+// Report the progress of a mass operation if the caller asked for it
+func (o *callOptions) reportProgress(result MatchResult) {
+	if o.progress != nil {
+		o.progress(result)
+	}
+}
+
+// Response describes the HTTP response to a call. Use it to correlate calls with
+// CouchDB's logs or to implement caching based on ETags.
+type Response struct {
+	StatusCode int
+	ETag       string
+	RequestID  string        // X-Couch-Request-ID
+	BodyTime   time.Duration // X-CouchDB-Body-Time
+	Header     http.Header
+}
+
+// Copy details of an HTTP response into the Response requested by the caller
+func (o *callOptions) record(resp *http.Response) {
+	if o.response == nil || resp == nil {
+		return
+	}
+	ms, _ := strconv.Atoi(resp.Header.Get("X-CouchDB-Body-Time"))
+	*o.response = Response{
+		StatusCode: resp.StatusCode,
+		ETag:       resp.Header.Get("ETag"),
+		RequestID:  resp.Header.Get("X-Couch-Request-ID"),
+		BodyTime:   time.Duration(ms) * time.Millisecond,
+		Header:     resp.Header,
+	}
+}
@@ -0,0 +1,44 @@
+package couch
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// OwnershipValidation returns a validate_doc_update function that only lets users change their
+// own documents. The name of the owner is kept in ownerField, which has to be set to the name of
+// the user when a document is created and can't be changed afterwards. Admins and users with
+// one of roles may change every document. Deploy it with SetValidation().
+func OwnershipValidation(ownerField string, roles ...string) string {
+	field, _ := json.Marshal(ownerField)
+	privileged, _ := json.Marshal(append([]string{"_admin"}, roles...))
+	return strings.NewReplacer("FIELD", string(field), "ROLES", string(privileged)).Replace(ownershipTemplate)
+}
+
+// Source of the ownership validation, FIELD and ROLES are replaced with JSON values
+const ownershipTemplate = `function(newDoc, oldDoc, userCtx, secObj) {
+  var privileged = ROLES;
+  for (var i = 0; i < privileged.length; i++) {
+    if (userCtx.roles.indexOf(privileged[i]) !== -1) { return; }
+  }
+  if (oldDoc && oldDoc[FIELD] !== userCtx.name) {
+    throw({forbidden: "Only the owner may change this document"});
+  }
+  if (!newDoc._deleted && newDoc[FIELD] !== userCtx.name) {
+    throw({forbidden: "Field " + FIELD + " must be the name of the user"});
+  }
+}`
+
+// SetValidation makes sure a design document contains a validate_doc_update function, e.g.
+// one returned by OwnershipValidation(). Creates the design document if necessary, keeps
+// everything else it has. Each design document can hold one validation, CouchDB applies all
+// of them on every write.
+func (db *Database) SetValidation(designID, fn string, opts ...Option) error {
+	return db.updateDesignDoc(designID, opts, func(d *DesignDoc) bool {
+		if d.ValidateDocUpdate == fn {
+			return false
+		}
+		d.ValidateDocUpdate = fn
+		return true
+	})
+}
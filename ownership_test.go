@@ -0,0 +1,27 @@
+package couch_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestOwnershipValidation(t *testing.T) {
+	t.Parallel()
+	fn := couch.OwnershipValidation(`owner"name`, "editor")
+	if !strings.Contains(fn, `oldDoc["owner\"name"] !== userCtx.name`) || !strings.Contains(fn, `["_admin","editor"]`) {
+		t.Error("Owner field and roles should be embedded as JSON, got", fn)
+	}
+
+	ts := designDocServer(t)
+	defer ts.Close()
+	db := couch.NewServer(ts.URL, nil).Database("notes")
+	if err := db.SetValidation("access", fn); err != nil {
+		t.Fatal("Setting validation returned error:", err)
+	}
+	d := couch.NewDesignDoc("access")
+	if err := db.Retrieve(d.ID, d); err != nil || d.ValidateDocUpdate != fn {
+		t.Error("Validation should be deployed, got", d.ValidateDocUpdate, err)
+	}
+}
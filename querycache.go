@@ -0,0 +1,160 @@
+package couch
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Cache of view and Mango query results, valid as long as the update sequence of the database
+// is the one they have been queried at
+type queryCache struct {
+	mu       sync.Mutex
+	size     int
+	interval time.Duration
+	seq      Seq       // Update sequence last fetched
+	checked  time.Time // When seq was fetched
+	fetching *seqFetch // Fetch of the update sequence in progress, shared by concurrent lookups
+	entries  map[string]*list.Element
+	lru      *list.List // Most recently used first
+}
+
+// Fetch of the update sequence of a database, seq is set before done is closed
+type seqFetch struct {
+	done chan struct{}
+	seq  Seq
+}
+
+// Cached result of a query
+type cacheEntry struct {
+	key  string
+	seq  Seq
+	view *ViewResult
+	docs json.RawMessage
+	find FindResult
+}
+
+// SetQueryCache makes a database cache the results of up to size queries with Query(), QueryDocs()
+// and Find(), for read-mostly applications like dashboards. Results are keyed by their parameters
+// and reused until the update sequence of the database moves on, which is checked with Info()
+// before a query, at most once per interval. With an interval of 0, results are never stale,
+// longer intervals save requests but may serve results that are up to interval old. Keys and
+// values of cached view rows are shared between calls and must not be modified. Calls with
+// WithCredentials() and calls of servers logged in with Login() bypass the cache, so that users
+// never get results fetched for someone else. Pass a size of 0 to stop caching.
+func (db *Database) SetQueryCache(size int, interval time.Duration) {
+	if size <= 0 {
+		db.cache = nil
+		return
+	}
+	db.cache = &queryCache{size: size, interval: interval, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// Key of a query in the cache, empty if it can't be cached
+func cacheKey(kind, path string, params interface{}) string {
+	enc, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	return kind + " " + path + " " + string(enc)
+}
+
+// Look up a query in the cache. Returns the current update sequence to store a new result with,
+// it is empty if the result can't be cached.
+func (c *queryCache) lookup(db *Database, key string, opts []Option) (Seq, *cacheEntry) {
+	if c == nil || key == "" {
+		return "", nil
+	}
+	// Results depend on who asks, only those seen with the credentials of the database are shared
+	o := newCallOptions(db.server.withDefaults(opts))
+	if o.cred != nil || o.session != nil {
+		return "", nil
+	}
+	seq := c.currentSeq(db, o, opts)
+	if seq == "" {
+		return "", nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return seq, nil
+	}
+	entry := el.Value.(*cacheEntry)
+	if entry.seq != seq {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return seq, nil
+	}
+	c.lru.MoveToFront(el)
+	return seq, entry
+}
+
+// Update sequence of the database, fetched with Info() if the last one is older than the interval.
+// The lock isn't held while fetching, concurrent lookups wait for the same fetch or until their
+// call is cancelled or times out. Returns an empty sequence if it isn't known.
+func (c *queryCache) currentSeq(db *Database, o *callOptions, opts []Option) Seq {
+	c.mu.Lock()
+	now := db.server.clock().Now()
+	if c.seq != "" && now.Sub(c.checked) < c.interval {
+		defer c.mu.Unlock()
+		return c.seq
+	}
+	if f := c.fetching; f != nil {
+		c.mu.Unlock()
+		ctx := o.context()
+		if o.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, o.timeout)
+			defer cancel()
+		}
+		select {
+		case <-f.done:
+			return f.seq
+		case <-ctx.Done():
+			return ""
+		}
+	}
+	f := &seqFetch{done: make(chan struct{})}
+	c.fetching = f
+	c.mu.Unlock()
+
+	info, err := db.Info(opts...)
+	c.mu.Lock()
+	if err == nil {
+		f.seq = info.UpdateSeq
+		c.seq, c.checked = f.seq, now
+	}
+	c.fetching = nil
+	c.mu.Unlock()
+	close(f.done)
+	return f.seq
+}
+
+// Keep the result of a query made at seq
+func (c *queryCache) store(seq Seq, entry *cacheEntry) {
+	if c == nil || seq == "" {
+		return
+	}
+	entry.seq = seq
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[entry.key]; ok {
+		c.lru.Remove(el)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Copy of a cached view result, so that callers can't change the cached rows
+func (r *ViewResult) copy() *ViewResult {
+	c := *r
+	c.Rows = append([]ViewResultRow(nil), r.Rows...)
+	return &c
+}
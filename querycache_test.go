@@ -0,0 +1,168 @@
+package couch_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestQueryCache(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	seq, views, finds := 1, 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/people":
+			fmt.Fprintf(w, `{"db_name": "people", "update_seq": "%d-abc"}`, seq)
+		case "/people/_design/people/_view/by_name":
+			views++
+			fmt.Fprintf(w, `{"total_rows": 1, "rows": [{"id": "anna", "key": "%s", "value": %d}]}`, r.URL.Query().Get("key"), views)
+		case "/people/_find":
+			finds++
+			w.Write([]byte(`{"docs": [{"_id": "anna", "Name": "Anna"}], "bookmark": "b1"}`))
+		}
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	db.SetQueryCache(1, 0)
+	query := func(key string) *couch.ViewResult {
+		result, err := db.Query("people", "by_name", map[string]interface{}{"key": key})
+		if err != nil {
+			t.Fatal("Query returned error:", err)
+		}
+		return result
+	}
+	first := query("Anna")
+	first.Rows[0].Value = "changed by caller"
+	if second := query("Anna"); views != 1 || second.Rows[0].ValueInt() != 1 {
+		t.Error("Unchanged database should answer from the cache, got", views, second.Rows)
+	}
+	if query("Bert"); views != 2 {
+		t.Error("Other parameters should be queried, got", views)
+	}
+	if query("Anna"); views != 3 {
+		t.Error("Oldest result should have been evicted, got", views)
+	}
+	mu.Lock()
+	seq = 2
+	mu.Unlock()
+	if result := query("Anna"); views != 4 || result.Rows[0].ValueInt() != 4 {
+		t.Error("Changed database should be queried again, got", views, result.Rows)
+	}
+
+	q := &couch.FindQuery{Selector: map[string]interface{}{"Name": "Anna"}}
+	for i := 0; i < 2; i++ {
+		var people []Person
+		result, err := db.Find(q, &people)
+		if err != nil || len(people) != 1 || people[0].Name != "Anna" || result.Bookmark != "b1" {
+			t.Fatal("Find should decode cached documents, got", people, result, err)
+		}
+	}
+	if finds != 1 {
+		t.Error("Repeated Mango query should answer from the cache, got", finds)
+	}
+}
+
+func TestQueryCacheSlowInfo(t *testing.T) {
+	t.Parallel()
+	fetching, release := make(chan struct{}), make(chan struct{})
+	var infos int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/people" {
+			if atomic.AddInt32(&infos, 1) == 1 {
+				close(fetching)
+			}
+			<-release
+			w.Write([]byte(`{"db_name": "people", "update_seq": "1-abc"}`))
+			return
+		}
+		w.Write([]byte(`{"total_rows": 0, "rows": []}`))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	db.SetQueryCache(1, 0)
+	go db.Query("people", "by_name", nil)
+	<-fetching
+
+	// Another query gives up waiting for the sequence with its context instead of the lock
+	done := make(chan struct{})
+	go func() {
+		db.Query("people", "by_name", nil, couch.WithTimeout(10*time.Millisecond))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("Query should not wait for the update sequence fetched by another one")
+	}
+	if n := atomic.LoadInt32(&infos); n != 1 {
+		t.Error("Concurrent queries should share fetching the update sequence, got", n)
+	}
+}
+
+func TestQueryCacheCredentials(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var users []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/_session":
+			http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: "anna"})
+			w.Write([]byte(`{"ok": true}`))
+		case "/people":
+			w.Write([]byte(`{"db_name": "people", "update_seq": "1-abc"}`))
+		default:
+			user, _, _ := r.BasicAuth()
+			if c, err := r.Cookie("AuthSession"); err == nil {
+				user = c.Value
+			}
+			users = append(users, user)
+			if user != "admin" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error": "forbidden", "reason": "Not allowed"}`))
+				return
+			}
+			w.Write([]byte(`{"total_rows": 1, "rows": [{"id": "anna", "key": "Anna", "value": 1}]}`))
+		}
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	db := s.Database("people")
+	db.SetQueryCache(10, 0)
+	admin := couch.WithCredentials(couch.NewCredentials("admin", "secret"))
+	if _, err := db.Query("people", "by_name", nil, admin); err != nil {
+		t.Fatal("Query returned error:", err)
+	}
+	if _, err := db.Query("people", "by_name", nil); !errors.Is(err, couch.ErrForbidden) {
+		t.Error("Result queried with other credentials shouldn't be served from the cache, got", err)
+	}
+	if _, err := db.Query("people", "by_name", nil, couch.WithCredentials(couch.NewCredentials("bert", "pw"))); !errors.Is(err, couch.ErrForbidden) {
+		t.Error("Calls with their own credentials should bypass the cache, got", err)
+	}
+	if err := s.Login("anna", "secret"); err != nil {
+		t.Fatal("Login returned error:", err)
+	}
+	if _, err := db.Query("people", "by_name", nil); !errors.Is(err, couch.ErrForbidden) {
+		t.Error("Calls with a session should bypass the cache, got", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(users) != "[admin  bert anna]" {
+		t.Error("Every query should reach the server, got", users)
+	}
+}
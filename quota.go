@@ -0,0 +1,92 @@
+package couch
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How long the size of a database is reused by a quota, unless configured otherwise
+const defaultQuotaCheckInterval = 10 * time.Second
+
+// Quota limits the size of a database, e.g. in hosted environments with per-database limits.
+// Sizes are in bytes and compared with the size of the database file, see DatabaseInfo.FileSize().
+// Zero values disable a limit.
+type Quota struct {
+	MaxSize  int64                    // Writes are rejected with a *QuotaError once the file reaches it
+	WarnSize int64                    // Warn is called once the file reaches it
+	Warn     func(info *DatabaseInfo) // Called with the information the warning is based on
+	// CheckInterval is how long the size of a database is reused before it is fetched again,
+	// 10s by default. A database can therefore grow beyond MaxSize by what is written meanwhile.
+	CheckInterval time.Duration
+}
+
+// QuotaError is returned when a write is rejected because a database reached its quota.
+type QuotaError struct {
+	Database string
+	Size     int64
+	MaxSize  int64
+}
+
+// Error implements the error interface.
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("couch: database %s reached its quota (%d of %d bytes)", e.Database, e.Size, e.MaxSize)
+}
+
+// Quota of a database along with the last size fetched
+type quotaGuard struct {
+	quota   Quota
+	mu      sync.Mutex
+	info    *DatabaseInfo
+	fetched time.Time
+}
+
+// SetQuota makes a database check its size before documents are written with Insert(), InsertBulk()
+// and the operations based on them. Deletions are always allowed, so that space can be freed. Pass
+// nil to remove the quota.
+func (db *Database) SetQuota(q *Quota) {
+	if q == nil {
+		db.quota = nil
+		return
+	}
+	db.quota = &quotaGuard{quota: *q}
+}
+
+// Check the quota of a database before writing docs
+func (db *Database) checkQuota(docs []Identifiable, opts []Option) error {
+	g := db.quota
+	if g == nil || onlyDeletions(docs) {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	interval := g.quota.CheckInterval
+	if interval <= 0 {
+		interval = defaultQuotaCheckInterval
+	}
+	now := db.server.clock().Now()
+	if g.info == nil || now.Sub(g.fetched) >= interval {
+		info, err := db.Info(opts...)
+		if err != nil {
+			return err
+		}
+		g.info, g.fetched = info, now
+		if g.quota.WarnSize > 0 && info.FileSize() >= g.quota.WarnSize && g.quota.Warn != nil {
+			g.quota.Warn(info)
+		}
+	}
+	if size := g.info.FileSize(); g.quota.MaxSize > 0 && size >= g.quota.MaxSize {
+		return &QuotaError{Database: db.Name(), Size: size, MaxSize: g.quota.MaxSize}
+	}
+	return nil
+}
+
+// Checks if documents only delete, writing them frees space
+func onlyDeletions(docs []Identifiable) bool {
+	for _, doc := range docs {
+		if d, ok := doc.(Deletable); !ok || !d.IsDeleted() {
+			return false
+		}
+	}
+	return len(docs) > 0
+}
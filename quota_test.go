@@ -0,0 +1,69 @@
+package couch_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestQuota(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	infos, writes := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/people":
+			infos++
+			w.Write([]byte(`{"db_name": "people", "sizes": {"file": 2000, "active": 1500}}`))
+		case r.URL.Path == "/people/_bulk_docs":
+			writes++
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`[{"id": "anna", "rev": "2-b", "ok": true}]`))
+		default:
+			writes++
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok": true, "id": "anna", "rev": "1-a"}`))
+		}
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	var warned int64
+	db.SetQuota(&couch.Quota{WarnSize: 1000, Warn: func(info *couch.DatabaseInfo) { warned = info.FileSize() }})
+	if err := db.Insert(&Person{Doc: couch.Doc{ID: "anna"}}); err != nil {
+		t.Fatal("Insert below quota returned error:", err)
+	}
+	if err := db.Insert(&Person{Doc: couch.Doc{ID: "bert"}}); err != nil {
+		t.Fatal("Insert below quota returned error:", err)
+	}
+	if warned != 2000 || infos != 1 || writes != 2 {
+		t.Error("Size should be fetched once and warned about, got", warned, infos, writes)
+	}
+
+	db.SetQuota(&couch.Quota{MaxSize: 2000})
+	var quotaErr *couch.QuotaError
+	if err := db.Insert(&Person{Doc: couch.Doc{ID: "carl"}}); !errors.As(err, &quotaErr) || quotaErr.Size != 2000 {
+		t.Error("Insert beyond quota should be rejected, got", err)
+	}
+	bulk := new(couch.Bulk)
+	bulk.Add(&Person{Doc: couch.Doc{ID: "anna"}})
+	if _, err := db.InsertBulk(bulk, false); !errors.As(err, &quotaErr) {
+		t.Error("Bulk beyond quota should be rejected, got", err)
+	}
+	deletion := couch.DynamicDoc{"_deleted": true}
+	deletion.SetIDRev("anna", "1-a")
+	bulk = new(couch.Bulk)
+	bulk.Add(deletion)
+	if _, err := db.InsertBulk(bulk, false); err != nil {
+		t.Error("Deletions should be allowed beyond quota, got", err)
+	}
+	if writes != 3 {
+		t.Error("Only the deletion should have been written, got", writes)
+	}
+}
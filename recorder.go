@@ -0,0 +1,204 @@
+package couch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// RecorderMode selects whether a Recorder talks to CouchDB or replays earlier responses.
+type RecorderMode int
+
+// Modes of a Recorder
+const (
+	Replay RecorderMode = iota // Serve responses from the golden file, fail on requests it doesn't contain
+	Record                     // Send requests to CouchDB and keep the interactions for Save()
+)
+
+// Interaction is a request and its response as stored in the golden file of a Recorder.
+// URLs are stored without scheme, host and credentials, so that recordings made against one
+// server can be replayed in place of another.
+type Interaction struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"request_body,omitempty"`
+	StatusCode  int         `json:"status_code"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body"`
+}
+
+// Recorder is an HTTP transport that records the interactions with CouchDB in a golden file and
+// replays them later, so that code using this package can be tested realistically without a
+// running CouchDB, e.g. in CI:
+//
+//	mode := couch.Replay
+//	if os.Getenv("RECORD") != "" {
+//		mode = couch.Record
+//	}
+//	rec, err := couch.NewRecorder("testdata/people.json", mode)
+//	...
+//	server.SetHTTPClient(rec.Client())
+//	... // Run the test
+//	err = rec.Save()
+//
+// Requests are matched by method, URL and body, identical requests are answered in the order
+// they were recorded. Generated ids and other values that differ between runs must therefore
+// be fixed by the test, e.g. with SetIDGenerator(). Credentials and request headers are never stored,
+// passwords sent to log in and session cookies are replaced by placeholders.
+type Recorder struct {
+	path         string
+	mode         RecorderMode
+	transport    http.RoundTripper
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// NewRecorder returns a recorder for the golden file at path, which must exist to replay it.
+func NewRecorder(path string, mode RecorderMode) (*Recorder, error) {
+	r := &Recorder{path: path, mode: mode, transport: http.DefaultTransport}
+	if mode == Record {
+		return r, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, fmt.Errorf("couch: invalid recording %s: %w", path, err)
+	}
+	r.replayed = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// Client returns an HTTP client using the recorder, see Server.SetHTTPClient().
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Save writes the recorded interactions to the golden file. Recorders replaying a file ignore it.
+func (r *Recorder) Save() error {
+	if r.mode != Record {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if r.mode == Record {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+// Send a request to CouchDB and keep the interaction
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Method:      req.Method,
+		URL:         req.URL.RequestURI(),
+		RequestBody: redactLogin(req, body),
+		StatusCode:  resp.StatusCode,
+		Header:      redactSessionCookies(resp.Header),
+		Body:        string(respBody),
+	})
+	r.mu.Unlock()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+// Answer a request with the first matching interaction that hasn't been replayed yet
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.interactions {
+		if r.replayed[i] || in.Method != req.Method || in.URL != req.URL.RequestURI() || in.RequestBody != redactLogin(req, body) {
+			continue
+		}
+		r.replayed[i] = true
+		header := in.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.StatusCode, http.StatusText(in.StatusCode)),
+			StatusCode:    in.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte(in.Body))),
+			ContentLength: int64(len(in.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("couch: no recorded response for %s %s in %s", req.Method, req.URL.RequestURI(), r.path)
+}
+
+// Placeholder for passwords and session cookies in golden files
+const redacted = "redacted"
+
+// Body of a request as stored in a golden file, with the password of a login replaced
+func redactLogin(req *http.Request, body []byte) string {
+	if req.Method != "POST" || !strings.HasSuffix(req.URL.Path, "/_session") {
+		return string(body)
+	}
+	var login map[string]interface{}
+	if err := json.Unmarshal(body, &login); err != nil || login["password"] == nil {
+		return string(body)
+	}
+	login["password"] = redacted
+	enc, err := json.Marshal(login)
+	if err != nil {
+		return string(body)
+	}
+	return string(enc)
+}
+
+// Headers of a response as stored in a golden file, with the values of session cookies replaced.
+// The cookies are kept otherwise, so that replayed logins still get a session.
+func redactSessionCookies(header http.Header) http.Header {
+	cookies := header.Values("Set-Cookie")
+	if len(cookies) == 0 {
+		return header
+	}
+	header = header.Clone()
+	header.Del("Set-Cookie")
+	resp := http.Response{Header: http.Header{"Set-Cookie": cookies}}
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookieName && c.Value != "" {
+			c.Value = redacted
+		}
+		header.Add("Set-Cookie", c.String())
+	}
+	return header
+}
@@ -0,0 +1,90 @@
+package couch_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok": true, "id": "anna", "rev": "1-a"}`))
+			return
+		}
+		w.Header().Set("ETag", `"1-a"`)
+		w.Write([]byte(`{"_id": "anna", "_rev": "1-a", "Name": "Anna"}`))
+	}))
+	golden := filepath.Join(t.TempDir(), "people.json")
+
+	rec, err := couch.NewRecorder(golden, couch.Record)
+	if err != nil {
+		t.Fatal("Creating recorder returned error:", err)
+	}
+	server := couch.NewServer(ts.URL, couch.NewCredentials("admin", "secret"))
+	server.SetHTTPClient(rec.Client())
+	if err = server.Database("people").Insert(&Person{Doc: couch.Doc{ID: "anna"}, Name: "Anna"}); err != nil {
+		t.Fatal("Recording insert returned error:", err)
+	}
+	if err = rec.Save(); err != nil {
+		t.Fatal("Saving recording returned error:", err)
+	}
+	ts.Close()
+
+	rec, err = couch.NewRecorder(golden, couch.Replay)
+	if err != nil {
+		t.Fatal("Loading recording returned error:", err)
+	}
+	server = couch.NewServer("http://replayed.invalid", nil)
+	server.SetHTTPClient(rec.Client())
+	db := server.Database("people")
+	anna := &Person{Doc: couch.Doc{ID: "anna"}, Name: "Anna"}
+	if err = db.Insert(anna); err != nil || anna.Rev != "1-a" {
+		t.Error("Insert should be replayed, got", anna.Rev, err)
+	}
+	if err = db.Insert(anna); err == nil {
+		t.Error("Requests that haven't been recorded should fail")
+	}
+}
+
+func TestRecorderSession(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_session" {
+			http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: "c2VjcmV0", MaxAge: 600})
+			w.Write([]byte(`{"ok": true}`))
+			return
+		}
+		w.Write([]byte(`{"db_name": "people"}`))
+	}))
+	golden := filepath.Join(t.TempDir(), "session.json")
+
+	rec, _ := couch.NewRecorder(golden, couch.Record)
+	server := couch.NewServer(ts.URL, nil)
+	server.SetHTTPClient(rec.Client())
+	if err := server.Login("anna", "secret"); err != nil {
+		t.Fatal("Recording login returned error:", err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal("Saving recording returned error:", err)
+	}
+	ts.Close()
+	data, _ := ioutil.ReadFile(golden)
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "c2VjcmV0") {
+		t.Error("Recording shouldn't contain the password or the session cookie", string(data))
+	}
+
+	rec, _ = couch.NewRecorder(golden, couch.Replay)
+	server = couch.NewServer("http://replayed.invalid", nil)
+	server.SetHTTPClient(rec.Client())
+	if err := server.Login("anna", "secret"); err != nil {
+		t.Error("Login should be replayed, got", err)
+	}
+}
@@ -0,0 +1,87 @@
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Design document holding the views for relationships
+const relationsDesignID = "relations"
+
+// Field referencing the parent document unless configured otherwise
+const defaultParentField = "parent"
+
+// SetParentField sets the name of the field in which child documents store
+// the id of their parent document, the default is "parent".
+func (db *Database) SetParentField(field string) {
+	db.parentField = field
+}
+
+// ParentField returns the name of the field referencing the parent of a document.
+func (db *Database) ParentField() string {
+	if db.parentField == "" {
+		return defaultParentField
+	}
+	return db.parentField
+}
+
+// Map function emitting [type, parent id] of all documents referencing a parent
+func (db *Database) relationView() View {
+	field, _ := json.Marshal(db.ParentField())
+	return View{Map: fmt.Sprintf(`function(doc) { if (doc.type !== undefined && doc[%s] !== undefined) { emit([doc.type, doc[%s]], null); } }`, field, field)}
+}
+
+// RelatedTo finds all documents of type childType referencing the parent with the given id
+// (one-to-many relationship). It follows the convention that documents carry their type in
+// a field named "type" and the id of their parent in the field returned by ParentField().
+// The documents are written into children, a pointer to a slice. The view backing the
+// relationship is deployed if it doesn't exist yet.
+func (db *Database) RelatedTo(parentID, childType string, children interface{}, opts ...Option) error {
+	viewID := "by_" + db.ParentField()
+	if err := db.ensureView(relationsDesignID, viewID, db.relationView(), opts); err != nil {
+		return err
+	}
+	key, _ := json.Marshal([]string{childType, parentID})
+	options := map[string]interface{}{"key": string(key), "include_docs": true}
+	result, err := db.Query(relationsDesignID, viewID, options, opts...)
+	if err != nil {
+		return err
+	}
+	return result.decodeDocs(children, db.Codec())
+}
+
+// ParentsOf fetches the parents of a slice of child documents in a single request and
+// writes them into parents, a pointer to a slice. Every parent is included once, parents that
+// don't exist are skipped. Use it after RelatedTo() or any other query returning children.
+func (db *Database) ParentsOf(children interface{}, parents interface{}, opts ...Option) error {
+	enc, err := db.Codec().Marshal(children)
+	if err != nil {
+		return err
+	}
+	var docs []map[string]interface{}
+	if err = json.Unmarshal(enc, &docs); err != nil {
+		return err
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, doc := range docs {
+		id, ok := doc[db.ParentField()].(string)
+		if ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return json.Unmarshal([]byte("[]"), parents)
+	}
+
+	rows, err := db.allDocsByKeys(ids, true, opts)
+	if err != nil {
+		return err
+	}
+	result := &ViewResult{}
+	for _, row := range rows {
+		result.Rows = append(result.Rows, ViewResultRow{ID: row.ID, Doc: row.Doc})
+	}
+	return result.decodeDocs(parents, db.Codec())
+}
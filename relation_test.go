@@ -0,0 +1,45 @@
+package couch_test
+
+import (
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+type Comment struct {
+	couch.Doc
+	Type   string `json:"type"`
+	Parent string `json:"parent"`
+	Text   string
+}
+
+func TestIntegrationRelatedTo(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+
+	post := &Person{Name: "Peter"}
+	other := &Person{Name: "Anna"}
+	insertTestDoc(post, db, t)
+	insertTestDoc(other, db, t)
+	insertTestDoc(&Comment{Type: "comment", Parent: post.ID, Text: "First"}, db, t)
+	insertTestDoc(&Comment{Type: "comment", Parent: post.ID, Text: "Second"}, db, t)
+	insertTestDoc(&Comment{Type: "comment", Parent: other.ID, Text: "Elsewhere"}, db, t)
+
+	var comments []Comment
+	err := db.RelatedTo(post.ID, "comment", &comments)
+	if err != nil {
+		t.Fatal("Getting related documents returned error:", err)
+	}
+	if len(comments) != 2 {
+		t.Fatal("Should find 2 comments related to document, got", comments)
+	}
+
+	var parents []Person
+	err = db.ParentsOf(comments, &parents)
+	if err != nil {
+		t.Fatal("Getting parents returned error:", err)
+	}
+	if len(parents) != 1 || parents[0].Name != "Peter" {
+		t.Error("Comments should have exactly one parent named Peter, got", parents)
+	}
+}
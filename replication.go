@@ -1,6 +1,7 @@
 package couch
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/url"
@@ -9,10 +10,14 @@ import (
 
 // A replication from a source to a target
 type Replication struct {
+	runner     *Database
 	source     *Database
 	target     *Database
 	continuous bool
 	sessionID  string
+	localID    string
+	cancelled  bool
+	req        replRequest
 }
 
 // A bidirectional replication
@@ -23,11 +28,150 @@ type Sync struct {
 
 // CouchDB request for replication
 type replRequest struct {
-	CreateTarget bool   `json:"create_target"`
-	Source       string `json:"source"`
-	Target       string `json:"target"`
-	Continuous   bool   `json:"continuous"`
-	Cancel       bool   `json:"cancel,omitempty"`
+	CreateTarget       bool              `json:"create_target"`
+	CreateTargetParams *TargetParams     `json:"create_target_params,omitempty"`
+	Source             replEndpoint      `json:"source"`
+	Target             replEndpoint      `json:"target"`
+	Continuous         bool              `json:"continuous"`
+	WinningRevsOnly    bool              `json:"winning_revs_only,omitempty"`
+	UseCheckpoints     *bool             `json:"use_checkpoints,omitempty"`
+	Filter             string            `json:"filter,omitempty"`
+	QueryParams        map[string]string `json:"query_params,omitempty"`
+	Cancel             bool              `json:"cancel,omitempty"`
+}
+
+// TargetParams describes how a replication creates its target database, zero values
+// leave the choice to CouchDB. See http://docs.couchdb.org/en/latest/cluster/sharding.html
+type TargetParams struct {
+	Q           int  `json:"q,omitempty"`
+	N           int  `json:"n,omitempty"`
+	Partitioned bool `json:"partitioned,omitempty"`
+}
+
+// WithCreateTarget sets whether a replication creates its target database if it doesn't
+// exist, which it does by default. Calls other than replications ignore it.
+func WithCreateTarget(create bool) Option {
+	return withReplication(func(req *replRequest) {
+		req.CreateTarget = create
+	})
+}
+
+// WithTargetParams makes a replication create a missing target database with the given
+// shards and replicas, e.g. as a partitioned database. Calls other than replications ignore it.
+func WithTargetParams(p TargetParams) Option {
+	return withReplication(func(req *replRequest) {
+		req.CreateTargetParams = &p
+	})
+}
+
+// WithWinningRevsOnly makes a replication copy only the winning revision of each document,
+// conflicting revisions are dropped. This needs CouchDB 3.3 or later. The target can't be kept
+// in sync with regular replications afterwards, use it for one-off copies. Calls other than
+// replications ignore it.
+func WithWinningRevsOnly() Option {
+	return withReplication(func(req *replRequest) {
+		req.WinningRevsOnly = true
+	})
+}
+
+// WithCheckpoints sets whether a replication records checkpoints to resume from, which
+// it does by default. Without, every replication starts from scratch. Calls other than
+// replications ignore it.
+func WithCheckpoints(use bool) Option {
+	return withReplication(func(req *replRequest) {
+		req.UseCheckpoints = &use
+	})
+}
+
+// WithFilter makes a replication only copy documents passed by a filter function of the source
+// database, given as "design/filter", see SetFilter(). params are passed to it in req.query.
+// Calls other than replications ignore it.
+func WithFilter(filter string, params map[string]string) Option {
+	return withReplication(func(req *replRequest) {
+		req.Filter, req.QueryParams = filter, params
+	})
+}
+
+// Change the request of a replication
+func withReplication(fn func(*replRequest)) Option {
+	return func(o *callOptions) {
+		o.repl = append(o.repl, fn)
+	}
+}
+
+// ReplicationAuth defines how a server passes credentials of databases to its replicator.
+type ReplicationAuth int
+
+const (
+	// ReplicationAuthURL puts credentials into the URLs of source and target, the default
+	ReplicationAuthURL ReplicationAuth = iota
+	// ReplicationAuthBasic passes credentials as auth objects, supported since CouchDB 3.x.
+	// CouchDB uses them for session authentication as well if its replicator is configured to.
+	ReplicationAuthBasic
+)
+
+// SetReplicationAuth sets how replications run by a server authenticate with source and
+// target. With ReplicationAuthBasic, credentials don't show up in URLs, e.g. in logs.
+func (s *Server) SetReplicationAuth(a ReplicationAuth) {
+	s.replAuth = a
+}
+
+// Source or target of a replication, encoded as a URL or, if it has
+// credentials, as an object with the URL and an auth object
+type replEndpoint struct {
+	url  string
+	cred *Credentials
+}
+
+// CouchDB representation of an endpoint with an auth object
+type replEndpointObject struct {
+	URL  string    `json:"url"`
+	Auth *replAuth `json:"auth,omitempty"`
+}
+
+// Auth object of an endpoint
+type replAuth struct {
+	Basic *replBasicAuth `json:"basic,omitempty"`
+}
+
+// Credentials for basic or session authentication of an endpoint
+type replBasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e replEndpoint) MarshalJSON() ([]byte, error) {
+	if e.cred == nil {
+		return json.Marshal(e.url)
+	}
+	basic := &replBasicAuth{Username: e.cred.user, Password: e.cred.password}
+	return json.Marshal(replEndpointObject{URL: e.url, Auth: &replAuth{Basic: basic}})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (e *replEndpoint) UnmarshalJSON(data []byte) error {
+	*e = replEndpoint{}
+	if json.Unmarshal(data, &e.url) == nil {
+		return nil
+	}
+	var obj replEndpointObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	e.url = obj.URL
+	if obj.Auth != nil && obj.Auth.Basic != nil {
+		e.cred = NewCredentials(obj.Auth.Basic.Username, obj.Auth.Basic.Password)
+	}
+	return nil
+}
+
+// Whether two endpoints are the same, including their credentials
+func (e replEndpoint) equal(other replEndpoint) bool {
+	if e.url != other.url || (e.cred == nil) != (other.cred == nil) {
+		return false
+	}
+	return e.cred == nil || *e.cred == *other.cred
 }
 
 // CouchDB response to replication request
@@ -35,31 +179,97 @@ type replResponse struct {
 	Ok            bool   `json:"ok"`
 	ReplIDVersion int    `json:"replication_id_version"`
 	SessionID     string `json:"session_id"`
-	SourceLastSeq int    `json:"source_last_seq"`
+	SourceLastSeq Seq    `json:"source_last_seq"`
+	LocalID       string `json:"_local_id"`
 }
 
 // Replicates given database to a target database. If the target database
-// does not exist it will be created. The target database may be on a different host.
-func (db *Database) ReplicateTo(target *Database, continuously bool) (*Replication, error) {
-	var resp replResponse
-	req := replRequest{CreateTarget: true, Source: db.URL(), Target: target.urlWithCredentials(), Continuous: continuously}
-	_, err := Do(db.replicationURL(), "POST", db.Cred(), req, &resp)
+// does not exist it will be created, see WithCreateTarget() and WithTargetParams() to change that.
+// The target database may be on a different host.
+// The default timeout of the server doesn't apply, pass WithTimeout() to limit the call.
+func (db *Database) ReplicateTo(target *Database, continuously bool, opts ...Option) (*Replication, error) {
+	source, err := db.replicationEndpoint(db.server, db.server.replAuth == ReplicationAuthBasic)
+	if err != nil {
+		return nil, err
+	}
+	targetEndpoint, err := target.replicationEndpoint(db.server, true)
+	if err != nil {
+		return nil, err
+	}
+	repl := &Replication{runner: db, source: db, target: target, continuous: continuously}
+	if err = db.startReplication(repl, source, targetEndpoint, opts); err != nil {
+		return nil, err
+	}
+	return repl, nil
+}
+
+// ReplicateToURL replicates a database to a database at any URL, e.g. on a server this process
+// doesn't talk to otherwise. cred are the credentials for the target, nil if it needs none or
+// targetURL contains them already. Target() of the replication returns nil.
+// The default timeout of the server doesn't apply, pass WithTimeout() to limit the call.
+func (db *Database) ReplicateToURL(targetURL string, cred *Credentials, continuously bool, opts ...Option) (*Replication, error) {
+	source, err := db.replicationEndpoint(db.server, db.server.replAuth == ReplicationAuthBasic)
+	if err != nil {
+		return nil, err
+	}
+	target, err := db.server.replicationEndpoint(targetURL, cred)
 	if err != nil {
 		return nil, err
 	}
-	repl := &Replication{source: db, target: target, continuous: continuously, sessionID: resp.SessionID}
-	return repl, err
+	repl := &Replication{runner: db, source: db, continuous: continuously}
+	if err = db.startReplication(repl, source, target, opts); err != nil {
+		return nil, err
+	}
+	return repl, nil
+}
+
+// ReplicateFromURL replicates a database at any URL into a database, the replication is run
+// by the server of db. cred are the credentials for the source, nil if it needs none or sourceURL
+// contains them already. Source() of the replication returns nil.
+// The default timeout of the server doesn't apply, pass WithTimeout() to limit the call.
+func (db *Database) ReplicateFromURL(sourceURL string, cred *Credentials, continuously bool, opts ...Option) (*Replication, error) {
+	source, err := db.server.replicationEndpoint(sourceURL, cred)
+	if err != nil {
+		return nil, err
+	}
+	target, err := db.replicationEndpoint(db.server, db.server.replAuth == ReplicationAuthBasic)
+	if err != nil {
+		return nil, err
+	}
+	repl := &Replication{runner: db, target: db, continuous: continuously}
+	if err = db.startReplication(repl, source, target, opts); err != nil {
+		return nil, err
+	}
+	return repl, nil
+}
+
+// Ask the server of a database to start a replication, keeps the request to be able to cancel it
+func (db *Database) startReplication(repl *Replication, source, target replEndpoint, opts []Option) error {
+	var resp replResponse
+	req := replRequest{CreateTarget: true, Source: source, Target: target, Continuous: repl.continuous}
+	for _, fn := range newCallOptions(opts).repl {
+		fn(&req)
+	}
+	_, err := do(db.replicationURL(), "POST", db.Cred(), req, &resp, db.server.withClient(opts))
+	repl.req, repl.sessionID, repl.localID = req, resp.SessionID, resp.LocalID
+	return err
 }
 
 // IsReplication returns true if a task represents a replication.
 func (t Task) IsReplication() bool {
-	return t["type"] == "replication"
+	return t.Type() == TaskReplication
 }
 
-// HasReplicationID returns true if a task has a given replication id.
+// HasReplicationID returns true if a task has a given replication id. Ids are compared without
+// their suffixes, e.g. 1234 matches a task with the id 1234+continuous+create_target but 123 doesn't.
 func (t Task) HasReplicationID(id string) bool {
 	s, _ := t["replication_id"].(string)
-	return strings.HasPrefix(s, id)
+	return s != "" && replicationIDBase(s) == replicationIDBase(id)
+}
+
+// Base of a replication id, without suffixes like +continuous or +create_target
+func replicationIDBase(id string) string {
+	return strings.SplitN(id, "+", 2)[0]
 }
 
 // func (t Task) Replication(relativeTo *Server) *Replication {
@@ -79,18 +289,61 @@ func (t Task) HasReplicationID(id string) bool {
 
 // IsRunning returns whether a replication is currently active or not.
 func (repl *Replication) IsActive() (bool, error) {
-	tasks, err := repl.Source().Server().ActiveTasks()
+	tasks, err := repl.runner.Server().ActiveTasks()
 	if err != nil {
 		return false, err
 	}
 	for _, task := range tasks {
-		if task.HasReplicationID(repl.SessionID()) {
+		if task.HasReplicationID(repl.id()) {
 			return true, nil
 		}
 	}
 	return false, nil
 }
 
+// Id to find a replication among active tasks. Continuous replications are identified by
+// the replication id CouchDB reports when they start, others only have a session id.
+func (repl *Replication) id() string {
+	if repl.localID != "" {
+		return repl.localID
+	}
+	return repl.sessionID
+}
+
+// ReplicationStatus describes the progress of a replication. LastSeq is the last checkpointed
+// sequence of the source, Err is set if the status couldn't be determined.
+type ReplicationStatus struct {
+	Active  bool
+	LastSeq Seq
+	Err     error
+}
+
+// Status returns whether a replication is active and how far it got.
+func (repl *Replication) Status(opts ...Option) ReplicationStatus {
+	task, err := repl.task(opts)
+	if err != nil {
+		return ReplicationStatus{Err: err}
+	}
+	if task == nil {
+		return ReplicationStatus{}
+	}
+	return ReplicationStatus{Active: true, LastSeq: task.CheckpointedSourceSeq}
+}
+
+// Active task of a replication, nil if it isn't active
+func (repl *Replication) task(opts []Option) (*ReplicationTask, error) {
+	var tasks []ReplicationTask
+	if err := repl.runner.Server().TasksByType(TaskReplication, &tasks, opts...); err != nil {
+		return nil, err
+	}
+	for i, task := range tasks {
+		if task.ReplicationID != "" && replicationIDBase(task.ReplicationID) == replicationIDBase(repl.id()) {
+			return &tasks[i], nil
+		}
+	}
+	return nil, nil
+}
+
 // IsActive returns whether a sync is active or not. A sync process consists of
 // two replications. If one is active and the other isn't, you get an error message.
 func (sync *Sync) IsActive() (bool, error) {
@@ -98,7 +351,7 @@ func (sync *Sync) IsActive() (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	b2aIsActive, err := sync.replA2B.IsActive()
+	b2aIsActive, err := sync.replB2A.IsActive()
 	if err != nil {
 		return false, err
 	}
@@ -122,17 +375,37 @@ func (sync *Sync) IsActive() (bool, error) {
 
 // Cancel a continuously running replication
 func (repl *Replication) Cancel() error {
-	req := replRequest{CreateTarget: true, Source: repl.source.URL(), Target: repl.target.URL(), Continuous: repl.continuous, Cancel: true}
-	_, err := Do(repl.Source().replicationURL(), "POST", repl.source.Cred(), req, nil)
+	req := repl.req
+	req.Cancel = true
+	_, err := do(repl.runner.replicationURL(), "POST", repl.runner.Cred(), req, nil, repl.runner.server.withClient(nil))
+	if err == nil {
+		repl.cancelled = true
+	}
 	return err
 }
 
-// Returns replication source
+// Restart cancels a continuous replication and starts it again with the same settings, e.g. because
+// it is stuck. A replication that isn't running anymore is just started again.
+func (repl *Replication) Restart(opts ...Option) error {
+	if err := repl.Cancel(); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	var resp replResponse
+	req := repl.req
+	req.Cancel = false
+	if _, err := do(repl.runner.replicationURL(), "POST", repl.runner.Cred(), req, &resp, repl.runner.server.withClient(opts)); err != nil {
+		return err
+	}
+	repl.sessionID, repl.localID, repl.cancelled = resp.SessionID, resp.LocalID, false
+	return nil
+}
+
+// Returns replication source, nil if it was started with ReplicateFromURL()
 func (repl *Replication) Source() *Database {
 	return repl.source
 }
 
-// Returns replication target
+// Returns replication target, nil if it was started with ReplicateToURL()
 func (repl *Replication) Target() *Database {
 	return repl.target
 }
@@ -168,6 +441,27 @@ func (db *Database) SyncWith(target *Database, continuously bool) (*Sync, error)
 	return sync, nil
 }
 
+// AtoB returns the replication from the database SyncWith() was called on to the target.
+func (sync *Sync) AtoB() *Replication {
+	return sync.replA2B
+}
+
+// BtoA returns the replication from the target back to the database SyncWith() was called on.
+func (sync *Sync) BtoA() *Replication {
+	return sync.replB2A
+}
+
+// SyncStatus describes both directions of a sync, they can differ, e.g. if one replication crashed.
+type SyncStatus struct {
+	AtoB ReplicationStatus
+	BtoA ReplicationStatus
+}
+
+// Status returns the status of both replications of a sync.
+func (sync *Sync) Status(opts ...Option) SyncStatus {
+	return SyncStatus{AtoB: sync.replA2B.Status(opts...), BtoA: sync.replB2A.Status(opts...)}
+}
+
 // Cancel a continuously running sync
 func (sync *Sync) Cancel() error {
 	// Call cancel directly on both replications, if replA2B.Cancel() leads to
@@ -182,13 +476,36 @@ func (sync *Sync) Cancel() error {
 }
 
 // Not safe, only used body of replication request
-func (db *Database) urlWithCredentials() string {
-	result, _ := url.Parse(db.URL())
-	cred := db.Cred()
+func urlWithCredentials(rawURL string, cred *Credentials) (string, error) {
+	result, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
 	if cred != nil {
-		result.User = url.UserPassword(db.server.cred.user, db.server.cred.password)
+		result.User = url.UserPassword(cred.user, cred.password)
+	}
+	return result.String(), nil
+}
+
+// Endpoint of a database for a replication run by a server, with the credentials of the
+// database if withCred is set
+func (db *Database) replicationEndpoint(runner *Server, withCred bool) (replEndpoint, error) {
+	if !withCred {
+		return replEndpoint{url: db.URL()}, nil
+	}
+	return runner.replicationEndpoint(db.URL(), db.Cred())
+}
+
+// Endpoint at a URL for a replication run by a server, credentials are passed the way the server is configured to
+func (s *Server) replicationEndpoint(rawURL string, cred *Credentials) (replEndpoint, error) {
+	if cred == nil {
+		return replEndpoint{url: rawURL}, nil
+	}
+	if s.replAuth == ReplicationAuthBasic {
+		return replEndpoint{url: rawURL, cred: cred}, nil
 	}
-	return result.String()
+	u, err := urlWithCredentials(rawURL, cred)
+	return replEndpoint{url: u}, err
 }
 
 func (db *Database) replicationURL() string {
@@ -0,0 +1,100 @@
+package couch
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReplicationState is the state of a replication as reported by CouchDB, e.g. in the
+// _replication_state field of replication documents.
+type ReplicationState string
+
+// States of a replication. A replication starts initializing, then runs until it's completed,
+// which only happens to replications that aren't continuous. Crashing replications are retried
+// by CouchDB, failed ones are not.
+const (
+	ReplicationInitializing ReplicationState = "initializing"
+	ReplicationRunning      ReplicationState = "running"
+	ReplicationCompleted    ReplicationState = "completed"
+	ReplicationCrashing     ReplicationState = "crashing"
+	ReplicationFailed       ReplicationState = "failed"
+	ReplicationError        ReplicationState = "error"
+	ReplicationPending      ReplicationState = "pending"
+)
+
+// Final returns true if a replication doesn't leave a state on its own anymore.
+func (s ReplicationState) Final() bool {
+	return s == ReplicationCompleted || s == ReplicationFailed
+}
+
+// How often WaitForState() asks for the state of a replication
+const replicationPollInterval = 500 * time.Millisecond
+
+// Replication job of the scheduler, see http://docs.couchdb.org/en/latest/api/server/common.html#scheduler-jobs
+type schedulerJob struct {
+	ID      string `json:"id"`
+	History []struct {
+		Type string `json:"type"`
+	} `json:"history"`
+}
+
+// State returns the state of a replication. Replications that aren't continuous are completed
+// once ReplicateTo() returns. Continuous ones are looked up in the scheduler of CouchDB 2.x or later,
+// they are completed after Cancel() and failed if they are gone otherwise.
+func (repl *Replication) State(opts ...Option) (ReplicationState, error) {
+	if !repl.continuous {
+		return ReplicationCompleted, nil
+	}
+	var result struct {
+		Jobs []schedulerJob `json:"jobs"`
+	}
+	s := repl.runner.Server()
+	_, err := do(s.URL()+"/_scheduler/jobs", "GET", s.Cred(), nil, &result, s.withDefaults(opts))
+	if err != nil {
+		return "", err
+	}
+	for _, job := range result.Jobs {
+		if job.ID != repl.localID {
+			continue
+		}
+		// History is ordered from the latest event to the oldest one
+		if len(job.History) == 0 {
+			return ReplicationInitializing, nil
+		}
+		switch job.History[0].Type {
+		case "crashed":
+			return ReplicationCrashing, nil
+		case "started":
+			return ReplicationRunning, nil
+		}
+		return ReplicationInitializing, nil
+	}
+	if repl.cancelled {
+		return ReplicationCompleted, nil
+	}
+	return ReplicationFailed, nil
+}
+
+// WaitForState waits until a replication reaches a state. It returns an error if ctx is
+// done first or the replication reaches a final state other than the one waited for.
+func (repl *Replication) WaitForState(ctx context.Context, state ReplicationState, opts ...Option) error {
+	opts = withOptions(opts, WithContext(ctx))
+	for {
+		current, err := repl.State(opts...)
+		if err != nil {
+			return err
+		}
+		if current == state {
+			return nil
+		}
+		if current.Final() {
+			return fmt.Errorf("couch: replication is %s, can't become %s", current, state)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-repl.runner.server.clock().After(replicationPollInterval):
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package couch_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestReplicationState(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	history := `[{"type":"added"}]`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/_replicate":
+			w.Write([]byte(`{"ok":true,"_local_id":"abc+continuous"}`))
+		case "/_scheduler/jobs":
+			w.Write([]byte(`{"jobs":[{"id":"abc+continuous+create_target","history":[{"type":"started"}]},{"id":"abc+continuous","history":` + history + `}]}`))
+			history = `[{"type":"started"},{"type":"added"}]`
+		}
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	repl, err := s.Database("a").ReplicateTo(s.Database("b"), true)
+	if err != nil {
+		t.Fatal("Replication returned error:", err)
+	}
+	state, err := repl.State()
+	if err != nil || state != couch.ReplicationInitializing {
+		t.Error("Replication should be initializing, got", state, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = repl.WaitForState(ctx, couch.ReplicationRunning); err != nil {
+		t.Error("Waiting for running replication returned error:", err)
+	}
+
+	once, err := s.Database("a").ReplicateTo(s.Database("b"), false)
+	if err != nil {
+		t.Fatal("Replication returned error:", err)
+	}
+	if err = once.WaitForState(ctx, couch.ReplicationRunning); err == nil {
+		t.Error("Waiting for a completed replication to run should return error")
+	}
+}
@@ -0,0 +1,51 @@
+package couch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+// Key of request ids in contexts
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a context that makes calls send id in their X-Request-ID header,
+// e.g. the id of the request a service is handling. Pass it to calls with WithContext().
+// Calls without one send a random id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request id set with ContextWithRequestID(), if any.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID returns the id CouchDB reported for the request that failed with err, to find it
+// in CouchDB's logs. If CouchDB didn't report one, it is the id the request was sent with.
+// It returns an empty string for errors that didn't originate from CouchDB.
+func RequestID(err error) string {
+	var cErr couchError
+	errors.As(err, &cErr)
+	return cErr.RequestID
+}
+
+// Random id for a request
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Id to identify a request by, the one of CouchDB if it reported one
+func responseRequestID(resp *http.Response, sent string) string {
+	if resp != nil {
+		if id := resp.Header.Get("X-Couch-Request-ID"); id != "" {
+			return id
+		}
+	}
+	return sent
+}
@@ -0,0 +1,37 @@
+package couch_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+	var sent []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get("X-Request-ID"))
+		w.Header().Set("X-Couch-Request-ID", "couch-"+r.Header.Get("X-Request-ID"))
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error":"conflict","reason":"Document update conflict."}`))
+	}))
+	defer ts.Close()
+	db := couch.NewServer(ts.URL, nil).Database("people")
+
+	ctx := couch.ContextWithRequestID(context.Background(), "abc")
+	err := db.Insert(&Person{Name: "Peter"}, couch.WithContext(ctx))
+	if couch.RequestID(err) != "couch-abc" || !strings.Contains(err.Error(), "[request couch-abc]") {
+		t.Error("Error should carry the request id of CouchDB, got", err)
+	}
+	db.Insert(&Person{Name: "Anna"})
+	if len(sent) != 2 || sent[0] != "abc" || len(sent[1]) != 16 {
+		t.Error("Requests should be sent with the request id of the context or a random one, got", sent)
+	}
+	if couch.RequestID(nil) != "" {
+		t.Error("Errors not from CouchDB shouldn't have a request id")
+	}
+}
@@ -0,0 +1,46 @@
+package couch
+
+import "time"
+
+// ResolutionMethod tells how a conflict has been resolved, see ConflictResolution.
+type ResolutionMethod string
+
+// Ways of resolving a conflict
+const (
+	ResolvedWithDoc    ResolutionMethod = "solve_with" // Conflict.SolveWith() wrote a final document
+	ResolvedByChoosing ResolutionMethod = "choose"     // Conflict.SolveByChoosing() kept one of the revisions
+	ResolvedByMerge    ResolutionMethod = "merge"      // A BulkResolver merged a write conflict, see WithMerge()
+)
+
+// ConflictResolution reports a conflict resolved by this package, see OnConflictResolved().
+// Losing holds the revisions whose branches have been closed, it is empty for write conflicts
+// resolved by a merge since they leave no revisions behind.
+type ConflictResolution struct {
+	DocID  string
+	Method ResolutionMethod
+	Rev    string // Revision of the document after the resolution
+	Losing []string
+	Time   time.Time
+}
+
+// OnConflictResolved sets a function called whenever a conflict of a document in the database has
+// been resolved by Conflict.SolveWith(), Conflict.SolveByChoosing(), Insert() with WithMerge() or
+// InsertBulkResolving(), e.g. to audit automated resolutions. It is called synchronously after
+// the resolution has been written. Pass nil (the default) to stop reporting.
+func (db *Database) OnConflictResolved(fn func(ConflictResolution)) {
+	db.onResolved = fn
+}
+
+// Report a resolution to the hook of the database, if it has one
+func (db *Database) reportResolution(docID string, method ResolutionMethod, rev string, losing []string) {
+	if db.onResolved == nil {
+		return
+	}
+	db.onResolved(ConflictResolution{
+		DocID:  docID,
+		Method: method,
+		Rev:    rev,
+		Losing: losing,
+		Time:   db.server.clock().Now(),
+	})
+}
@@ -0,0 +1,123 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Serves a document with three conflicting revisions, bulk writes succeed with revision 3-x
+func threeWayConflictServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/_bulk_docs"):
+			var body struct{ Docs []map[string]interface{} }
+			json.NewDecoder(r.Body).Decode(&body)
+			var results []string
+			for _, doc := range body.Docs {
+				rev := "3-x"
+				if doc["_deleted"] == true {
+					rev = "3-" + doc["_rev"].(string)
+				}
+				results = append(results, fmt.Sprintf(`{"id": "anna", "rev": "%s", "ok": true}`, rev))
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(results, ","))
+		case r.URL.Query().Get("open_revs") == "all":
+			w.Write([]byte(`[
+				{"ok": {"_id": "anna", "_rev": "2-a", "Name": "A"}},
+				{"ok": {"_id": "anna", "_rev": "2-b", "Name": "B"}},
+				{"ok": {"_id": "anna", "_rev": "2-c", "Name": "C"}}
+			]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestConflictResolutionEvents(t *testing.T) {
+	t.Parallel()
+	ts := threeWayConflictServer(t)
+	defer ts.Close()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := couch.NewServer(ts.URL, nil)
+	s.SetClock(couch.NewManualClock(now))
+	db := s.Database("people")
+	var events []couch.ConflictResolution
+	db.OnConflictResolved(func(e couch.ConflictResolution) {
+		events = append(events, e)
+	})
+
+	conflict, err := db.ConflictFor("anna")
+	if err != nil {
+		t.Fatal("Getting conflict returned error:", err)
+	}
+	if err = conflict.SolveByChoosing("2-b"); err != nil {
+		t.Fatal("Choosing a revision returned error:", err)
+	}
+	if conflict, err = db.ConflictFor("anna"); err != nil {
+		t.Fatal("Getting conflict returned error:", err)
+	}
+	if err = conflict.SolveWith(&Person{Name: "ABC"}); err != nil {
+		t.Fatal("Solving conflict returned error:", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatal("Expected an event for every resolution, got", events)
+	}
+	chosen, solved := events[0], events[1]
+	if chosen.DocID != "anna" || chosen.Method != couch.ResolvedByChoosing || chosen.Rev != "2-b" || fmt.Sprint(chosen.Losing) != "[2-a 2-c]" || !chosen.Time.Equal(now) {
+		t.Error("Unexpected event for choosing a revision", chosen)
+	}
+	if solved.Method != couch.ResolvedWithDoc || solved.Rev != "3-x" || fmt.Sprint(solved.Losing) != "[2-b 2-c]" {
+		t.Error("Unexpected event for solving with a document", solved)
+	}
+}
+
+func TestMergeResolutionEvents(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`{"_id": "anna", "_rev": "2-b", "Name": "Anna"}`))
+			return
+		}
+		var doc map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&doc)
+		if doc["_rev"] != "2-b" {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error": "conflict", "reason": "Document update conflict."}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok": true, "id": "anna", "rev": "3-c"}`))
+	}))
+	defer ts.Close()
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	var events []couch.ConflictResolution
+	db.OnConflictResolved(func(e couch.ConflictResolution) {
+		events = append(events, e)
+	})
+
+	merge := func(doc couch.Identifiable, current couch.DynamicDoc) (couch.Identifiable, error) {
+		_, rev := current.IDRev()
+		doc.SetIDRev("anna", rev)
+		return doc, nil
+	}
+	if err := db.Insert(&Person{Doc: couch.Doc{ID: "anna", Rev: "2-b"}}, couch.WithMerge(merge, 1)); err != nil {
+		t.Fatal("Insert returned error:", err)
+	}
+	if len(events) != 0 {
+		t.Error("Insert without conflict shouldn't report a resolution, got", events)
+	}
+	if err := db.Insert(&Person{Doc: couch.Doc{ID: "anna", Rev: "1-a"}}, couch.WithMerge(merge, 1)); err != nil {
+		t.Fatal("Insert with merge returned error:", err)
+	}
+	if len(events) != 1 || events[0].Method != couch.ResolvedByMerge || events[0].Rev != "3-c" || events[0].Losing != nil {
+		t.Error("Merged write conflict should be reported, got", events)
+	}
+}
@@ -0,0 +1,30 @@
+package couch
+
+// Security is the security object of a database, see
+// http://docs.couchdb.org/en/latest/api/database/security.html
+type Security struct {
+	Admins  SecurityGroup `json:"admins"`
+	Members SecurityGroup `json:"members"`
+}
+
+// SecurityGroup lists the users and roles that are admins or members of a database.
+type SecurityGroup struct {
+	Names []string `json:"names"`
+	Roles []string `json:"roles"`
+}
+
+// Security returns the security object of a database.
+func (db *Database) Security(opts ...Option) (*Security, error) {
+	sec := &Security{}
+	_, err := do(db.URL()+"/_security", "GET", db.Cred(), nil, sec, db.server.withDefaults(opts))
+	if err != nil {
+		return nil, err
+	}
+	return sec, nil
+}
+
+// SetSecurity replaces the security object of a database.
+func (db *Database) SetSecurity(sec *Security, opts ...Option) error {
+	_, err := do(db.URL()+"/_security", "PUT", db.Cred(), sec, nil, db.server.withDefaults(opts))
+	return err
+}
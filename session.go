@@ -0,0 +1,174 @@
+package couch
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Name of the cookie CouchDB authenticates sessions with
+const sessionCookieName = "AuthSession"
+
+// Lifetime assumed for a session cookie without an expiry, CouchDB's default session timeout
+const defaultSessionTimeout = 10 * time.Minute
+
+// SessionState is what a SessionStore keeps of a session: the user, the cookie and when it has
+// been issued for how long.
+type SessionState struct {
+	Name     string
+	Cookie   string
+	Issued   time.Time
+	Lifetime time.Duration
+}
+
+// SessionStore keeps the session of a server between runs of a program, e.g. in a file, so that
+// short-lived command line tools don't log in on every run. Load returns nil if there is no session,
+// Save is called with every cookie the server receives, including a state without cookie on Logout().
+type SessionStore interface {
+	Load() (*SessionState, error)
+	Save(state SessionState) error
+}
+
+// SetSessionStore sets where a server keeps its session, see Login(). Pass nil to keep it in memory only.
+func (s *Server) SetSessionStore(store SessionStore) {
+	s.sessionStore = store
+}
+
+// Session of a server logged in with cookie authentication
+type session struct {
+	server   *Server
+	store    SessionStore
+	name     string
+	password string
+
+	mu       sync.Mutex
+	cookie   string
+	issued   time.Time
+	lifetime time.Duration
+}
+
+// Login authenticates with CouchDB's cookie authentication instead of sending credentials with
+// every call. The server and its databases then send the AuthSession cookie, credentials set with
+// NewServer() or SetCred() are ignored until Logout(), WithCredentials() still applies to single
+// calls. The cookie is renewed transparently: CouchDB sends a fresh one along with responses and
+// once half of its lifetime has passed anyway, the server logs in again before the next call.
+// With a SessionStore, a fresh session of the same user is restored instead of logging in. If the
+// server rejects the cookie, e.g. because it has been restarted with a new secret, the server logs
+// in again and repeats the call.
+func (s *Server) Login(name, password string, opts ...Option) error {
+	sess := &session{server: s, store: s.sessionStore, name: name, password: password}
+	restored, err := sess.restore()
+	if err != nil {
+		return err
+	}
+	if !restored {
+		if err := sess.login(opts); err != nil {
+			return err
+		}
+	}
+	s.session = sess
+	return nil
+}
+
+// Logout ends the session started with Login(), later calls use the credentials of
+// the server and its databases again.
+func (s *Server) Logout(opts ...Option) error {
+	sess := s.session
+	if sess == nil {
+		return nil
+	}
+	s.session = nil
+	sess.save(SessionState{Name: sess.name})
+	_, err := do(s.url+"/_session", "DELETE", nil, nil, nil, withOptions(s.withDefaults(opts), useSession(sess)))
+	return err
+}
+
+// Authenticate a call with the session of a server
+func useSession(sess *session) Option {
+	return func(o *callOptions) {
+		o.session = sess
+	}
+}
+
+// Post the credentials to _session and keep the cookie
+func (sess *session) login(opts []Option) error {
+	body := map[string]string{"name": sess.name, "password": sess.password}
+	resp, err := do(sess.server.url+"/_session", "POST", nil, body, nil, withOptions(sess.server.withDefaults(opts), useSession(nil)))
+	if err != nil {
+		return err
+	}
+	if !sess.update(resp) {
+		return errors.New("couch: login didn't return a session cookie")
+	}
+	return nil
+}
+
+// Take over the session kept by the store if it belongs to the same user and is still fresh,
+// returns whether it did
+func (sess *session) restore() (bool, error) {
+	if sess.store == nil {
+		return false, nil
+	}
+	state, err := sess.store.Load()
+	if err != nil || state == nil || state.Name != sess.name || state.Cookie == "" {
+		return false, err
+	}
+	sess.cookie, sess.issued, sess.lifetime = state.Cookie, state.Issued, state.Lifetime
+	return sess.fresh(), nil
+}
+
+// Whether less than half of the lifetime of the cookie has passed
+func (sess *session) fresh() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.server.clock().Now().Sub(sess.issued) < sess.lifetime/2
+}
+
+// Log in again if half of the lifetime of the cookie has passed, opts are those of the
+// call that needs the session so that cancelling it cancels the login as well
+func (sess *session) renew(opts []Option) error {
+	if sess.fresh() {
+		return nil
+	}
+	return sess.login(opts)
+}
+
+// Pass the state of a session to the store, errors go to the error handler of the server
+func (sess *session) save(state SessionState) {
+	if sess.store != nil {
+		sess.server.handleError(sess.store.Save(state))
+	}
+}
+
+// Keep a session cookie sent with a response, returns false if there is none
+func (sess *session) update(resp *http.Response) bool {
+	if resp == nil {
+		return false
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name != sessionCookieName || c.Value == "" {
+			continue
+		}
+		now := sess.server.clock().Now()
+		lifetime := defaultSessionTimeout
+		if c.MaxAge > 0 {
+			lifetime = time.Duration(c.MaxAge) * time.Second
+		} else if !c.Expires.IsZero() && c.Expires.After(now) {
+			lifetime = c.Expires.Sub(now)
+		}
+		sess.mu.Lock()
+		sess.cookie, sess.issued, sess.lifetime = c.Value, now, lifetime
+		sess.mu.Unlock()
+		sess.save(SessionState{Name: sess.name, Cookie: c.Value, Issued: now, Lifetime: lifetime})
+		return true
+	}
+	return false
+}
+
+// Add the session cookie to a request
+func (sess *session) authorize(req *http.Request) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: sess.cookie})
+}
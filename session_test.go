@@ -0,0 +1,258 @@
+package couch_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestSession(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	logins := 0
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/_session" {
+			switch r.Method {
+			case "POST":
+				var body map[string]string
+				json.NewDecoder(r.Body).Decode(&body)
+				if body["name"] != "anna" || body["password"] != "secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					w.Write([]byte(`{"error": "unauthorized", "reason": "Name or password is incorrect."}`))
+					return
+				}
+				logins++
+				http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: fmt.Sprintf("login%d", logins), MaxAge: 600})
+				w.Write([]byte(`{"ok": true, "name": "anna", "roles": []}`))
+			case "DELETE":
+				http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: ""})
+				w.Write([]byte(`{"ok": true}`))
+			}
+			return
+		}
+		auth := "none"
+		if c, err := r.Cookie("AuthSession"); err == nil {
+			auth = c.Value
+		} else if user, _, ok := r.BasicAuth(); ok {
+			auth = "basic:" + user
+		}
+		seen = append(seen, auth)
+		if len(seen) == 3 {
+			// CouchDB refreshes cookies along with responses
+			http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: "refreshed", MaxAge: 600})
+		}
+		w.Write([]byte(`{"db_name": "db"}`))
+	}))
+	defer server.Close()
+
+	clock := couch.NewManualClock(time.Now())
+	s := couch.NewServer(server.URL, couch.NewCredentials("admin", "pw"))
+	s.SetClock(clock)
+	db := s.Database("db")
+	call := func(opts ...couch.Option) {
+		if _, err := db.Info(opts...); err != nil {
+			t.Fatal("Request returned error:", err)
+		}
+	}
+
+	if err := s.Login("anna", "wrong"); couch.ErrorType(err) != "unauthorized" {
+		t.Error("Login with a wrong password should fail, got", err)
+	}
+	if err := s.Login("anna", "secret"); err != nil {
+		t.Fatal("Login returned error:", err)
+	}
+	call()
+	call(couch.WithCredentials(couch.NewCredentials("other", "pw")))
+	call()                         // Receives a refreshed cookie
+	call()                         // Uses the refreshed cookie
+	clock.Advance(5 * time.Minute) // Half of the lifetime of the refreshed cookie passed
+	call()                         // Logs in again first
+	if err := s.Logout(); err != nil {
+		t.Fatal("Logout returned error:", err)
+	}
+	call()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(seen) != "[login1 basic:other login1 refreshed login2 basic:admin]" || logins != 2 {
+		t.Error("Unexpected authentication", seen, logins)
+	}
+}
+
+// SessionStore keeping the state in memory, like a file would between runs
+type memorySessionStore struct {
+	mu    sync.Mutex
+	state *couch.SessionState
+	saves int
+}
+
+func (m *memorySessionStore) Load() (*couch.SessionState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state, nil
+}
+
+func (m *memorySessionStore) Save(state couch.SessionState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = &state
+	m.saves++
+	return nil
+}
+
+func TestSessionStore(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	logins := 0
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/_session" {
+			if r.Method == "POST" {
+				logins++
+				http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: fmt.Sprintf("login%d", logins), MaxAge: 600})
+			}
+			w.Write([]byte(`{"ok": true}`))
+			return
+		}
+		c, _ := r.Cookie("AuthSession")
+		seen = append(seen, fmt.Sprint(c))
+		w.Write([]byte(`{"db_name": "db"}`))
+	}))
+	defer server.Close()
+
+	store := &memorySessionStore{}
+	clock := couch.NewManualClock(time.Now())
+	run := func(name string) {
+		s := couch.NewServer(server.URL, nil)
+		s.SetClock(clock)
+		s.SetSessionStore(store)
+		if err := s.Login(name, "secret"); err != nil {
+			t.Fatal("Login returned error:", err)
+		}
+		if _, err := s.Database("db").Info(); err != nil {
+			t.Fatal("Request returned error:", err)
+		}
+	}
+
+	run("anna")                    // Logs in and saves the cookie
+	run("anna")                    // Restores the session without logging in
+	run("bert")                    // Session of another user isn't restored
+	clock.Advance(5 * time.Minute) // Half of the lifetime passed
+	run("bert")                    // Stale session isn't restored
+
+	mu.Lock()
+	if fmt.Sprint(seen) != "[AuthSession=login1 AuthSession=login1 AuthSession=login2 AuthSession=login3]" || logins != 3 {
+		t.Error("Unexpected sessions", seen, logins)
+	}
+	mu.Unlock()
+	if state, _ := store.Load(); state.Name != "bert" || state.Cookie != "login3" || state.Lifetime != 10*time.Minute {
+		t.Error("Store should keep the latest session, got", state)
+	}
+
+	s := couch.NewServer(server.URL, nil)
+	s.SetClock(clock)
+	s.SetSessionStore(store)
+	s.Login("bert", "secret")
+	if err := s.Logout(); err != nil {
+		t.Fatal("Logout returned error:", err)
+	}
+	if state, _ := store.Load(); state.Cookie != "" {
+		t.Error("Logout should clear the stored session, got", state)
+	}
+}
+
+func TestSessionStoreRejected(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/_session" {
+			logins++
+			http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: "valid", MaxAge: 600})
+			w.Write([]byte(`{"ok": true}`))
+			return
+		}
+		if c, _ := r.Cookie("AuthSession"); c == nil || c.Value != "valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "unauthorized", "reason": "You are not authorized to access this db."}`))
+			return
+		}
+		w.Write([]byte(`{"db_name": "db"}`))
+	}))
+	defer server.Close()
+
+	// Fresh cookie the server doesn't accept anymore, e.g. after changing its secret
+	clock := couch.NewManualClock(time.Now())
+	store := &memorySessionStore{state: &couch.SessionState{
+		Name: "anna", Cookie: "revoked", Issued: clock.Now(), Lifetime: 10 * time.Minute,
+	}}
+	s := couch.NewServer(server.URL, nil)
+	s.SetClock(clock)
+	s.SetSessionStore(store)
+	if err := s.Login("anna", "secret"); err != nil {
+		t.Fatal("Login returned error:", err)
+	}
+	if _, err := s.Database("db").Info(); err != nil {
+		t.Fatal("Request with rejected session returned error:", err)
+	}
+	if _, err := s.Database("db").Info(); err != nil {
+		t.Fatal("Request returned error:", err)
+	}
+	mu.Lock()
+	if logins != 1 {
+		t.Error("Rejected session should log in once, logins:", logins)
+	}
+	mu.Unlock()
+	if state, _ := store.Load(); state.Cookie != "valid" {
+		t.Error("Store should keep the new session, got", state)
+	}
+}
+
+func TestSessionRenewalWithContext(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/_session" {
+			logins++
+			http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: "cookie", MaxAge: 600})
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	clock := couch.NewManualClock(time.Now())
+	s := couch.NewServer(server.URL, nil)
+	s.SetClock(clock)
+	if err := s.Login("anna", "secret"); err != nil {
+		t.Fatal("Login returned error:", err)
+	}
+	clock.Advance(5 * time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Database("db").Info(couch.WithContext(ctx)); !errors.Is(err, context.Canceled) {
+		t.Error("Cancelling a call should cancel its renewal, got", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if logins != 1 {
+		t.Error("Renewal of a cancelled call shouldn't reach the server, got logins:", logins)
+	}
+}
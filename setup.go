@@ -0,0 +1,67 @@
+package couch
+
+// DatabaseSetup declares what a database should contain besides documents,
+// see EnsureDatabase(). Every element is optional.
+type DatabaseSetup struct {
+	Security     *Security       `json:"security,omitempty"`
+	DesignDocs   []*DesignDoc    `json:"design_docs,omitempty"`
+	Indexes      []IndexDef      `json:"indexes,omitempty"`
+	MangoIndexes []MangoIndexDef `json:"mango_indexes,omitempty"`
+}
+
+// IndexDef declares an index, see IndexFields(). Type is optional.
+type IndexDef struct {
+	Type   string   `json:"type,omitempty"`
+	Fields []string `json:"fields"`
+}
+
+// MangoIndexDef declares an index used by Mango queries, see
+// http://docs.couchdb.org/en/latest/api/database/find.html#db-index.
+// Name and DesignDoc are optional, CouchDB generates them if they are empty. An index with a
+// PartialFilterSelector only covers the documents matching it.
+type MangoIndexDef struct {
+	Name                  string                 `json:"name,omitempty"`
+	DesignDoc             string                 `json:"ddoc,omitempty"`
+	Fields                []string               `json:"fields"`
+	PartialFilterSelector map[string]interface{} `json:"partial_filter_selector,omitempty"`
+}
+
+// EnsureDatabase creates a database unless it already exists and brings it in line with setup,
+// which may be nil. Security is replaced, design documents are only written if they differ and
+// indexes, including Mango indexes, are deployed if they are missing, so it is safe to call on
+// every start of an application:
+//
+//	db, err := server.EnsureDatabase("people", &couch.DatabaseSetup{
+//		Security: &couch.Security{Members: couch.SecurityGroup{Roles: []string{"staff"}}},
+//		Indexes:  []couch.IndexDef{{Type: "person", Fields: []string{"name"}}},
+//	})
+func (s *Server) EnsureDatabase(name string, setup *DatabaseSetup, opts ...Option) (*Database, error) {
+	db := s.Database(name)
+	if err := db.Create(opts...); err != nil && ErrorType(err) != "file_exists" {
+		return nil, err
+	}
+	if setup == nil {
+		return db, nil
+	}
+	if setup.Security != nil {
+		if err := db.SetSecurity(setup.Security, opts...); err != nil {
+			return nil, err
+		}
+	}
+	for _, d := range setup.DesignDocs {
+		if err := db.EnsureDesignDoc(d, opts...); err != nil {
+			return nil, err
+		}
+	}
+	for _, idx := range setup.Indexes {
+		if _, err := db.indexFields(idx.Type, idx.Fields, opts); err != nil {
+			return nil, err
+		}
+	}
+	for _, idx := range setup.MangoIndexes {
+		if _, err := db.CreateMangoIndex(idx, opts...); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
@@ -0,0 +1,101 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestEnsureExistingDatabase(t *testing.T) {
+	t.Parallel()
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == "PUT" && r.URL.Path == "/people" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte(`{"error":"file_exists","reason":"The database could not be created, the file already exists."}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	setup := &couch.DatabaseSetup{Security: &couch.Security{}}
+	db, err := couch.NewServer(ts.URL, nil).EnsureDatabase("people", setup)
+	if err != nil {
+		t.Fatal("Existing database should not be an error, got", err)
+	}
+	if db.Name() != "people" {
+		t.Error("Handle should refer to database people, got", db.Name())
+	}
+	if len(requests) != 2 || requests[1] != "PUT /people/_security" {
+		t.Error("Security should be applied to existing database, requests were", requests)
+	}
+}
+
+func TestEnsureDatabaseOptions(t *testing.T) {
+	t.Parallel()
+	var unauthorized []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, _, ok := r.BasicAuth(); !ok || user != "admin" {
+			unauthorized = append(unauthorized, r.Method+" "+r.URL.Path)
+		}
+		if r.Method == "GET" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not_found","reason":"missing"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true,"id":"_design/index_person_name","rev":"1-a"}`))
+	}))
+	defer ts.Close()
+
+	setup := &couch.DatabaseSetup{Indexes: []couch.IndexDef{{Type: "person", Fields: []string{"name"}}}}
+	_, err := couch.NewServer(ts.URL, nil).EnsureDatabase("people", setup, couch.WithCredentials(couch.NewCredentials("admin", "secret")))
+	if err != nil {
+		t.Fatal("Ensuring database returned error:", err)
+	}
+	if len(unauthorized) != 0 {
+		t.Error("Indexes should be deployed with the options of the call, requests without them:", unauthorized)
+	}
+}
+
+func TestIntegrationEnsureDatabase(t *testing.T) {
+	db := database()
+	if db.Exists() {
+		db.DropDatabase()
+	}
+	design := couch.NewDesignDoc("people")
+	design.Views["by_name"] = couch.View{Map: `function(doc) { emit(doc.Name, null); }`}
+	setup := &couch.DatabaseSetup{
+		Security:   &couch.Security{Members: couch.SecurityGroup{Roles: []string{"staff"}}},
+		DesignDocs: []*couch.DesignDoc{design},
+		Indexes:    []couch.IndexDef{{Fields: []string{"Height"}}},
+	}
+	db, err := server().EnsureDatabase(testDB, setup)
+	if err != nil {
+		t.Fatal("Ensuring new database returned error:", err)
+	}
+	defer tearDownDatabase(db, t)
+	rev := design.Rev
+
+	// A second call must not change anything
+	if _, err = server().EnsureDatabase(testDB, setup); err != nil {
+		t.Fatal("Ensuring existing database returned error:", err)
+	}
+	if design.Rev != rev {
+		t.Error("Unchanged design document should not be written again")
+	}
+	if !db.HasView("people", "by_name") || !db.HasView("index_Height", "by_value") {
+		t.Error("Design documents and indexes should be deployed")
+	}
+	sec, err := db.Security()
+	if err != nil {
+		t.Fatal("Retrieving security returned error:", err)
+	}
+	if len(sec.Members.Roles) != 1 || sec.Members.Roles[0] != "staff" {
+		t.Error("Security should be applied, got", sec)
+	}
+}
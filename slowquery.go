@@ -0,0 +1,101 @@
+package couch
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Number of slow queries a database keeps
+const slowQueryLogSize = 100
+
+// SlowQuery is a query that took longer than the threshold set with SetSlowQueryThreshold().
+type SlowQuery struct {
+	Time      time.Time
+	Duration  time.Duration
+	Kind      string      // "view", "find" or "all_docs"
+	Path      string      // e.g. the design document and view
+	Params    interface{} // Options of a view query, the query itself for Mango queries
+	Rows      int
+	Err       error
+	RequestID string // Id of the request in CouchDB's logs
+}
+
+// Ring buffer of slow queries
+type slowQueryLog struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	entries   []SlowQuery
+	next      int
+}
+
+// SetSlowQueryThreshold makes a database record view, Mango and _all_docs queries taking longer
+// than d, see SlowQueries(). They are also logged if the server has a logger. Pass 0 to stop
+// recording, this also discards the queries recorded so far.
+func (db *Database) SetSlowQueryThreshold(d time.Duration) {
+	if d <= 0 {
+		db.slowLog = nil
+		return
+	}
+	if db.slowLog == nil {
+		db.slowLog = &slowQueryLog{}
+	}
+	db.slowLog.mu.Lock()
+	db.slowLog.threshold = d
+	db.slowLog.mu.Unlock()
+}
+
+// SlowQueries returns the most recent slow queries of a database, the oldest first.
+// Only the last 100 are kept.
+func (db *Database) SlowQueries() []SlowQuery {
+	l := db.slowLog
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < slowQueryLogSize {
+		return append([]SlowQuery(nil), l.entries...)
+	}
+	return append(append([]SlowQuery(nil), l.entries[l.next:]...), l.entries[:l.next]...)
+}
+
+// Record a query started at start if it was slow
+func (db *Database) recordQuery(kind, path string, params interface{}, rows int, resp *http.Response, err error, start time.Time) {
+	l := db.slowLog
+	if l == nil {
+		return
+	}
+	q := SlowQuery{Time: start, Duration: time.Since(start), Kind: kind, Path: path, Params: params, Rows: rows, Err: err}
+	if err != nil {
+		q.RequestID = RequestID(err)
+	} else {
+		q.RequestID = responseRequestID(resp, "")
+	}
+	l.mu.Lock()
+	if q.Duration < l.threshold {
+		l.mu.Unlock()
+		return
+	}
+	if len(l.entries) < slowQueryLogSize {
+		l.entries = append(l.entries, q)
+	} else {
+		l.entries[l.next] = q
+		l.next = (l.next + 1) % slowQueryLogSize
+	}
+	l.mu.Unlock()
+	db.server.logf("couch: slow %s query %s on %s took %v (%d rows) [request %s]: %v", kind, path, db.name, q.Duration, rows, q.RequestID, params)
+}
+
+// Number of elements of the slice docs points to
+func sliceLen(docs interface{}) int {
+	v := reflect.ValueOf(docs)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return 0
+	}
+	return v.Len()
+}
@@ -0,0 +1,58 @@
+package couch_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestSlowQueries(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/slow") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		w.Write([]byte(`{"rows": [{"id": "a", "key": "a"}, {"id": "b", "key": "b"}]}`))
+	}))
+	defer ts.Close()
+
+	var logged bytes.Buffer
+	s := couch.NewServer(ts.URL, nil)
+	s.SetLogger(log.New(&logged, "", 0))
+	db := s.Database("people")
+	db.SetSlowQueryThreshold(10 * time.Millisecond)
+
+	db.Query("people", "fast", nil)
+	db.Query("people", "slow", map[string]interface{}{"limit": 2})
+	slow := db.SlowQueries()
+	if len(slow) != 1 {
+		t.Fatal("Only the slow query should be recorded, got", slow)
+	}
+	if slow[0].Kind != "view" || slow[0].Path != "people/slow" || slow[0].Rows != 2 || slow[0].Duration < 10*time.Millisecond {
+		t.Error("Slow query should be described, got", slow[0])
+	}
+	if !strings.Contains(logged.String(), "people/slow") {
+		t.Error("Slow query should be logged, got", logged.String())
+	}
+
+	// Only the most recent queries are kept
+	db.SetSlowQueryThreshold(time.Nanosecond)
+	for i := 0; i < 150; i++ {
+		db.Query("people", "fast", map[string]interface{}{"skip": i})
+	}
+	slow = db.SlowQueries()
+	if len(slow) != 100 || slow[99].Params.(map[string]interface{})["skip"] != 149 {
+		t.Error("Log should keep the last 100 queries in order")
+	}
+
+	db.SetSlowQueryThreshold(0)
+	if len(db.SlowQueries()) != 0 {
+		t.Error("Disabling the log should discard recorded queries")
+	}
+}
@@ -0,0 +1,47 @@
+package couch
+
+// SnapshotReport tells whether a database changed while a set of reads was running.
+type SnapshotReport struct {
+	StartSeq    Seq
+	EndSeq      Seq
+	Changed     bool     // Whether the database has been updated during the reads
+	ChangedDocs []string // Ids of the documents updated during the reads, or right after them
+}
+
+// ReadSnapshot runs a set of reads and reports whether the database changed in the meantime.
+// CouchDB has no multi-request transactions, this approximates a consistent snapshot for reporting
+// jobs: if nothing changed, all reads saw the same state of the database, otherwise they can be
+// repeated or the changed documents be read again.
+//
+//	report, err := db.ReadSnapshot(func() error {
+//		// Queries and retrievals
+//	})
+//	if report.Changed { ... }
+//
+// The update sequence of the database is recorded before and after reads is called, the database
+// counts as changed if the number of updates differs, see Seq.Compare(). A smaller number, e.g. from
+// a cluster node lagging behind, counts as well, since it can't tell that nothing changed. If reads
+// returns an error, it is returned without a report.
+func (db *Database) ReadSnapshot(reads func() error, opts ...Option) (*SnapshotReport, error) {
+	before, err := db.Info(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err = reads(); err != nil {
+		return nil, err
+	}
+	after, err := db.Info(opts...)
+	if err != nil {
+		return nil, err
+	}
+	report := &SnapshotReport{StartSeq: before.UpdateSeq, EndSeq: after.UpdateSeq}
+	// Nodes of a cluster may encode the same state differently, compare the number of updates
+	if report.StartSeq.Compare(report.EndSeq) == 0 {
+		return report, nil
+	}
+	report.Changed = true
+	if report.ChangedDocs, err = db.changedDocIDs(report.StartSeq, opts); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
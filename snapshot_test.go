@@ -0,0 +1,89 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestReadSnapshotChanged(t *testing.T) {
+	t.Parallel()
+	var infos int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/people":
+			if atomic.AddInt32(&infos, 1) == 1 {
+				w.Write([]byte(`{"update_seq": "5-a"}`))
+			} else {
+				w.Write([]byte(`{"update_seq": "7-b"}`))
+			}
+		case "/people/_changes":
+			if r.URL.Query().Get("since") != "5-a" {
+				t.Error("Changes should be read since the first sequence, got", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"results": [{"id": "anna", "seq": "6-x"}, {"id": "anna", "seq": "7-b"}]}`))
+		}
+	}))
+	defer ts.Close()
+
+	report, err := couch.NewServer(ts.URL, nil).Database("people").ReadSnapshot(func() error { return nil })
+	if err != nil {
+		t.Fatal("Reading snapshot returned error:", err)
+	}
+	if !report.Changed || len(report.ChangedDocs) != 1 || report.ChangedDocs[0] != "anna" {
+		t.Error("Changed document should be reported once, got", report)
+	}
+}
+
+func TestReadSnapshotClusterNodes(t *testing.T) {
+	t.Parallel()
+	var infos int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/people" {
+			t.Error("Unchanged database shouldn't read changes, got", r.URL)
+		}
+		// Two nodes answer with different encodings of the same state
+		if atomic.AddInt32(&infos, 1) == 1 {
+			w.Write([]byte(`{"update_seq": "5-g1AAAABneJzLYWBgYMpgTmHg"}`))
+		} else {
+			w.Write([]byte(`{"update_seq": "5-g1AAAABneJzLYWBgYMpgTmHh"}`))
+		}
+	}))
+	defer ts.Close()
+
+	report, err := couch.NewServer(ts.URL, nil).Database("people").ReadSnapshot(func() error { return nil })
+	if err != nil || report.Changed {
+		t.Error("Same number of updates shouldn't count as a change, got", report, err)
+	}
+}
+
+func TestIntegrationReadSnapshot(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+	peter := &Person{Name: "Peter"}
+	insertTestDoc(peter, db, t)
+
+	report, err := db.ReadSnapshot(func() error {
+		return db.Retrieve(peter.ID, new(Person))
+	})
+	if err != nil {
+		t.Fatal("Reading snapshot returned error:", err)
+	}
+	if report.Changed {
+		t.Error("Database should not change during reads, got", report)
+	}
+
+	report, err = db.ReadSnapshot(func() error {
+		peter.Name = "Paul"
+		return db.Insert(peter)
+	})
+	if err != nil {
+		t.Fatal("Reading snapshot returned error:", err)
+	}
+	if !report.Changed || len(report.ChangedDocs) != 1 || report.ChangedDocs[0] != peter.ID {
+		t.Error("Edited document should be reported, got", report)
+	}
+}
@@ -0,0 +1,187 @@
+package couch
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SyncState is the state of a SyncAgent.
+type SyncState string
+
+// States of a SyncAgent
+const (
+	SyncStarting SyncState = "starting" // First health check is pending
+	SyncOnline   SyncState = "online"   // Central server is reachable, replications are running
+	SyncOffline  SyncState = "offline"  // Central server is unreachable, replications are paused
+	SyncStopped  SyncState = "stopped"  // Agent has been stopped
+)
+
+// SyncEvent reports a change of the state of a SyncAgent. Err is the reason for going offline.
+type SyncEvent struct {
+	From SyncState
+	To   SyncState
+	Err  error
+	Time time.Time
+}
+
+// SyncAgent keeps a local database in sync with a database on a central server, e.g. on an IoT
+// or mobile gateway with an unreliable connection. It checks regularly whether the central server
+// is reachable and pauses both replications while it isn't, so that the local CouchDB doesn't keep
+// failing and retrying them:
+//
+//	agent := couch.NewSyncAgent(local, central, 30*time.Second)
+//	agent.Start()
+//	for e := range agent.Events() {
+//		log.Println("sync is", e.To, e.Err)
+//	}
+//
+// Replications are managed by documents in the _replicator database of the local server and run
+// continuously while the agent is online, see Topology.
+type SyncAgent struct {
+	local    *Database
+	central  *Database
+	interval time.Duration
+	topology *Topology
+	events   chan SyncEvent
+
+	mu       sync.Mutex
+	state    SyncState
+	started  bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Number of events buffered for a slow receiver
+const syncEventBuffer = 16
+
+// NewSyncAgent returns an agent syncing local with central, checking the connection
+// to the central server every interval.
+func NewSyncAgent(local, central *Database, interval time.Duration) *SyncAgent {
+	return &SyncAgent{
+		local:    local,
+		central:  central,
+		interval: interval,
+		topology: NewTopology(syncTopologyName(local, central)).HubSpoke(central, local),
+		events:   make(chan SyncEvent, syncEventBuffer),
+		state:    SyncStarting,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Name of the topology of an agent, with a hash of both databases so that agents syncing
+// databases of the same name with different central ones don't share replication documents
+func syncTopologyName(local, central *Database) string {
+	sum := sha1.Sum([]byte(local.URL() + " " + central.URL()))
+	return "sync-" + local.Name() + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Start runs the agent in the background until Stop() is called.
+func (a *SyncAgent) Start() error {
+	if a.interval <= 0 {
+		return errors.New("couch: sync agent interval must be positive")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.started || a.state == SyncStopped {
+		return errors.New("couch: sync agent can only be started once")
+	}
+	for _, s := range a.servers() {
+		if err := s.register(a, a.Stop); err != nil {
+			return err
+		}
+	}
+	a.started = true
+	go a.run()
+	return nil
+}
+
+// Servers an agent runs on, it stops when one of them is closed
+func (a *SyncAgent) servers() []*Server {
+	return []*Server{a.local.Server(), a.central.Server()}
+}
+
+// Stop stops the agent and pauses the replications, the Events() channel is closed.
+func (a *SyncAgent) Stop() error {
+	var err error
+	a.stopOnce.Do(func() {
+		close(a.stop)
+		a.mu.Lock()
+		started := a.started
+		a.mu.Unlock()
+		if started {
+			<-a.done
+		}
+		err = a.topology.Teardown()
+		a.setState(SyncStopped, nil)
+		close(a.events)
+		for _, s := range a.servers() {
+			s.unregister(a)
+		}
+	})
+	return err
+}
+
+// Events returns a channel receiving every change of state. Events are dropped
+// rather than blocking the agent if the channel is full.
+func (a *SyncAgent) Events() <-chan SyncEvent {
+	return a.events
+}
+
+// State returns the current state of the agent.
+func (a *SyncAgent) State() SyncState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state
+}
+
+// Check the connection every interval until the agent is stopped
+func (a *SyncAgent) run() {
+	defer close(a.done)
+	clock := a.local.Server().clock()
+	for {
+		a.check()
+		select {
+		case <-a.stop:
+			return
+		case <-clock.After(a.interval):
+		}
+	}
+}
+
+// Pause or resume replications depending on whether the central server is reachable
+func (a *SyncAgent) check() {
+	if err := a.central.Server().ping(WithTimeout(a.interval)); err != nil {
+		if a.State() == SyncOnline {
+			a.topology.Teardown()
+		}
+		a.setState(SyncOffline, err)
+		return
+	}
+	if a.State() != SyncOnline {
+		if err := a.topology.Apply(); err != nil {
+			a.setState(SyncOffline, err)
+			return
+		}
+		a.setState(SyncOnline, nil)
+	}
+}
+
+// Change the state and emit an event if it is a new one
+func (a *SyncAgent) setState(state SyncState, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == state {
+		return
+	}
+	e := SyncEvent{From: a.state, To: state, Err: err, Time: a.local.Server().clock().Now()}
+	a.state = state
+	select {
+	case a.events <- e:
+	default:
+	}
+}
@@ -0,0 +1,164 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestSyncAgent(t *testing.T) {
+	t.Parallel()
+	var reachable int32 = 1
+	central := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&reachable) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"couchdb":"Welcome"}`))
+	}))
+	defer central.Close()
+	var replicatorWrites int32
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_replicator/_all_docs":
+			w.Write([]byte(`{"rows":[]}`))
+		case strings.HasPrefix(r.URL.Path, "/_replicator/") && r.Method == "GET":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not_found","reason":"missing"}`))
+		case strings.HasPrefix(r.URL.Path, "/_replicator/") && r.Method == "PUT":
+			atomic.AddInt32(&replicatorWrites, 1)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true,"id":"sync","rev":"1-a"}`))
+		}
+	}))
+	defer local.Close()
+
+	agent := couch.NewSyncAgent(couch.NewServer(local.URL, nil).Database("gateway"),
+		couch.NewServer(central.URL, nil).Database("fleet"), 10*time.Millisecond)
+	if err := agent.Start(); err != nil {
+		t.Fatal("Starting agent returned error:", err)
+	}
+	expectEvent := func(state couch.SyncState) {
+		select {
+		case e := <-agent.Events():
+			if e.To != state {
+				t.Fatalf("Expected agent to go %s, went %s", state, e.To)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected agent to go %s", state)
+		}
+	}
+	expectEvent(couch.SyncOnline)
+	if atomic.LoadInt32(&replicatorWrites) != 2 {
+		t.Error("Going online should set up both replications, writes:", replicatorWrites)
+	}
+	atomic.StoreInt32(&reachable, 0)
+	expectEvent(couch.SyncOffline)
+	atomic.StoreInt32(&reachable, 1)
+	expectEvent(couch.SyncOnline)
+
+	if err := agent.Stop(); err != nil {
+		t.Error("Stopping agent returned error:", err)
+	}
+	expectEvent(couch.SyncStopped)
+	if _, open := <-agent.Events(); open {
+		t.Error("Events should be closed after stopping")
+	}
+}
+
+func TestSyncAgentsSharingServer(t *testing.T) {
+	t.Parallel()
+	central := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"couchdb":"Welcome"}`))
+	}))
+	defer central.Close()
+	var mu sync.Mutex
+	docs := map[string]map[string]interface{}{}
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		id := strings.TrimPrefix(r.URL.Path, "/_replicator/")
+		switch {
+		case id == "_all_docs":
+			var prefix string
+			json.Unmarshal([]byte(r.URL.Query().Get("startkey")), &prefix)
+			var rows []map[string]interface{}
+			for id, doc := range docs {
+				if strings.HasPrefix(id, prefix) {
+					rows = append(rows, map[string]interface{}{"id": id, "doc": doc})
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"rows": rows})
+		case r.Method == "GET" && docs[id] != nil:
+			json.NewEncoder(w).Encode(docs[id])
+		case r.Method == "GET":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not_found","reason":"missing"}`))
+		case r.Method == "PUT":
+			var doc map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&doc)
+			doc["_id"], doc["_rev"] = id, "1-a"
+			docs[id] = doc
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true,"id":"` + id + `","rev":"1-a"}`))
+		case r.Method == "DELETE":
+			delete(docs, id)
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer local.Close()
+
+	// Agents syncing "orders", a database whose name starts like it, and "orders" with
+	// another central database all keep their replication documents on the same server
+	server := couch.NewServer(local.URL, nil)
+	orders := couch.NewSyncAgent(server.Database("orders"),
+		couch.NewServer(central.URL, nil).Database("orders"), 10*time.Millisecond)
+	others := []*couch.SyncAgent{
+		couch.NewSyncAgent(server.Database("orders-archive"),
+			couch.NewServer(central.URL, nil).Database("orders-archive"), 10*time.Millisecond),
+		couch.NewSyncAgent(server.Database("orders"),
+			couch.NewServer(central.URL, nil).Database("orders-eu"), 10*time.Millisecond),
+	}
+	expectOnline := func(agent *couch.SyncAgent) {
+		select {
+		case e := <-agent.Events():
+			if e.To != couch.SyncOnline {
+				t.Fatalf("Expected agent to go online, went %s", e.To)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected agent to go online")
+		}
+	}
+	for _, agent := range append([]*couch.SyncAgent{orders}, others...) {
+		if err := agent.Start(); err != nil {
+			t.Fatal("Starting agent returned error:", err)
+		}
+		expectOnline(agent)
+	}
+	mu.Lock()
+	if len(docs) != 6 {
+		t.Error("Every agent should set up its own replications, documents:", len(docs))
+	}
+	mu.Unlock()
+
+	for _, agent := range others {
+		if err := agent.Stop(); err != nil {
+			t.Error("Stopping agent returned error:", err)
+		}
+	}
+	mu.Lock()
+	if len(docs) != 2 {
+		t.Error("Stopping agents should leave the replications of others alone, documents:", len(docs))
+	}
+	mu.Unlock()
+	if err := orders.Stop(); err != nil {
+		t.Error("Stopping agent returned error:", err)
+	}
+}
@@ -0,0 +1,102 @@
+package couch
+
+import "encoding/json"
+
+// TaskType is the type of an active task.
+type TaskType string
+
+// Types of active tasks
+const (
+	TaskReplication        TaskType = "replication"
+	TaskIndexer            TaskType = "indexer"
+	TaskDatabaseCompaction TaskType = "database_compaction"
+	TaskViewCompaction     TaskType = "view_compaction"
+)
+
+// TaskStatus holds the fields all active tasks share. Times are Unix timestamps in seconds.
+type TaskStatus struct {
+	Type      TaskType `json:"type"`
+	PID       string   `json:"pid"`
+	Node      string   `json:"node"`
+	StartedOn int64    `json:"started_on"`
+	UpdatedOn int64    `json:"updated_on"`
+}
+
+// ReplicationTask is an active task of type replication. Source and Target are
+// the URLs of the databases, with credentials redacted by CouchDB.
+type ReplicationTask struct {
+	TaskStatus
+	ReplicationID         string `json:"replication_id"`
+	DocID                 string `json:"doc_id"`
+	Source                string `json:"source"`
+	Target                string `json:"target"`
+	Continuous            bool   `json:"continuous"`
+	DocsRead              int64  `json:"docs_read"`
+	DocsWritten           int64  `json:"docs_written"`
+	DocWriteFailures      int64  `json:"doc_write_failures"`
+	MissingRevisionsFound int64  `json:"missing_revisions_found"`
+	RevisionsChecked      int64  `json:"revisions_checked"`
+	ChangesPending        *int64 `json:"changes_pending"` // nil if unknown
+	SourceSeq             Seq    `json:"source_seq"`
+	CheckpointedSourceSeq Seq    `json:"checkpointed_source_seq"`
+}
+
+// IndexerTask is an active task of type indexer, building the views of a design document.
+type IndexerTask struct {
+	TaskStatus
+	Database       string `json:"database"`
+	DesignDocument string `json:"design_document"`
+	ChangesDone    int64  `json:"changes_done"`
+	TotalChanges   int64  `json:"total_changes"`
+	Progress       int    `json:"progress"` // percent
+}
+
+// CompactionTask is an active task of type database_compaction or view_compaction.
+// DesignDocument and Phase are only set for view compactions.
+type CompactionTask struct {
+	TaskStatus
+	Database       string `json:"database"`
+	DesignDocument string `json:"design_document"`
+	Phase          string `json:"phase"`
+	ChangesDone    int64  `json:"changes_done"`
+	TotalChanges   int64  `json:"total_changes"`
+	Progress       int    `json:"progress"` // percent
+}
+
+// Type returns the type of a task.
+func (t Task) Type() TaskType {
+	typ, _ := t["type"].(string)
+	return TaskType(typ)
+}
+
+// Decode converts a task to a typed struct like ReplicationTask.
+func (t Task) Decode(v interface{}) error {
+	enc, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(enc, v)
+}
+
+// TasksByType returns the active tasks of a type, decoded into tasks, a pointer
+// to a slice of a typed struct or of Task:
+//
+//	var tasks []couch.IndexerTask
+//	err := s.TasksByType(couch.TaskIndexer, &tasks)
+func (s *Server) TasksByType(typ TaskType, tasks interface{}, opts ...Option) error {
+	all, err := s.ActiveTasks(opts...)
+	if err != nil {
+		return err
+	}
+	matching := make([]Task, 0, len(all))
+	for _, task := range all {
+		if task.Type() == typ {
+			matching = append(matching, task)
+		}
+	}
+	enc, err := json.Marshal(matching)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(enc, tasks)
+}
@@ -0,0 +1,55 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestTasksByType(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[
+			{"type":"replication","pid":"<0.1.0>","replication_id":"abc+continuous","continuous":true,
+			 "docs_written":12,"changes_pending":null,"checkpointed_source_seq":"3-g1AAAA","source_seq":4,"started_on":1500000000},
+			{"type":"indexer","database":"people","design_document":"_design/people","changes_done":50,"total_changes":200,"progress":25},
+			{"type":"view_compaction","database":"people","design_document":"_design/people","phase":"view","progress":10}
+		]`))
+	}))
+	defer ts.Close()
+	s := couch.NewServer(ts.URL, nil)
+
+	var repls []couch.ReplicationTask
+	if err := s.TasksByType(couch.TaskReplication, &repls); err != nil {
+		t.Fatal("Getting replication tasks returned error:", err)
+	}
+	if len(repls) != 1 || !repls[0].Continuous || repls[0].DocsWritten != 12 || repls[0].ChangesPending != nil {
+		t.Error("Replication task not decoded correctly:", repls)
+	}
+	if repls[0].CheckpointedSourceSeq.Number() != 3 || repls[0].SourceSeq.Number() != 4 || repls[0].StartedOn != 1500000000 {
+		t.Error("Replication task sequences not decoded correctly:", repls[0])
+	}
+
+	var indexers []couch.IndexerTask
+	if err := s.TasksByType(couch.TaskIndexer, &indexers); err != nil {
+		t.Fatal("Getting indexer tasks returned error:", err)
+	}
+	if len(indexers) != 1 || indexers[0].Progress != 25 || indexers[0].TotalChanges != 200 || indexers[0].Type != couch.TaskIndexer {
+		t.Error("Indexer task not decoded correctly:", indexers)
+	}
+
+	var compactions []couch.CompactionTask
+	if err := s.TasksByType(couch.TaskDatabaseCompaction, &compactions); err != nil || len(compactions) != 0 {
+		t.Error("There shouldn't be database compactions, got", compactions, err)
+	}
+	var tasks []couch.Task
+	if err := s.TasksByType(couch.TaskViewCompaction, &tasks); err != nil || len(tasks) != 1 {
+		t.Fatal("There should be a view compaction, got", tasks, err)
+	}
+	var compaction couch.CompactionTask
+	if err := tasks[0].Decode(&compaction); err != nil || compaction.Phase != "view" {
+		t.Error("View compaction not decoded correctly:", compaction, err)
+	}
+}
@@ -0,0 +1,259 @@
+package couch
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// Topology declares continuous replications between many databases, possibly on different
+// servers, e.g. a fleet of edge instances synchronizing with a central one:
+//
+//	topo := couch.NewTopology("fleet").HubSpoke(central, edge1, edge2)
+//	err := topo.Apply()
+//
+// Every replication is managed by a document in the _replicator database of the server
+// that runs it. The ids of these documents start with the name of the topology, which
+// therefore has to be unique among the topologies sharing a server.
+type Topology struct {
+	name  string
+	links []TopologyLink
+}
+
+// TopologyLink is a replication of a topology from Source to Target, run by Runner.
+type TopologyLink struct {
+	Source *Database
+	Target *Database
+	Runner *Server
+}
+
+// Length of the hash ending the ids of link documents
+const linkHashLen = 16
+
+// Id of the document in the _replicator database managing a link, with
+// the database prefix of the runner to keep environments apart
+func (l TopologyLink) docID(topology string) string {
+	sum := sha1.Sum([]byte(l.Source.URL() + " " + l.Target.URL()))
+	return l.Runner.dbPrefix + topology + "-" + hex.EncodeToString(sum[:linkHashLen/2])
+}
+
+// Replication document of a link
+func (l TopologyLink) replication(topology string) (ManifestReplication, error) {
+	source, err := l.Source.replicationEndpoint(l.Runner, true)
+	if err != nil {
+		return ManifestReplication{}, err
+	}
+	target, err := l.Target.replicationEndpoint(l.Runner, true)
+	if err != nil {
+		return ManifestReplication{}, err
+	}
+	return ManifestReplication{
+		ID:           l.docID(topology),
+		Source:       source.url,
+		Target:       target.url,
+		Continuous:   true,
+		CreateTarget: true,
+		sourceCred:   source.cred,
+		targetCred:   target.cred,
+	}, nil
+}
+
+// NewTopology returns an empty topology.
+func NewTopology(name string) *Topology {
+	return &Topology{name: name}
+}
+
+// Link adds a one-way replication from source to target, run by the server of the source.
+func (t *Topology) Link(source, target *Database) *Topology {
+	t.links = append(t.links, TopologyLink{Source: source, Target: target, Runner: source.Server()})
+	return t
+}
+
+// Mesh adds replications in both directions between every pair of databases,
+// each run by the server of its source.
+func (t *Topology) Mesh(dbs ...*Database) *Topology {
+	for _, source := range dbs {
+		for _, target := range dbs {
+			if source != target {
+				t.Link(source, target)
+			}
+		}
+	}
+	return t
+}
+
+// HubSpoke adds replications in both directions between a hub and every spoke. They are
+// run by the servers of the spokes, so the hub doesn't need to be able to reach them.
+func (t *Topology) HubSpoke(hub *Database, spokes ...*Database) *Topology {
+	for _, spoke := range spokes {
+		t.links = append(t.links,
+			TopologyLink{Source: hub, Target: spoke, Runner: spoke.Server()},
+			TopologyLink{Source: spoke, Target: hub, Runner: spoke.Server()})
+	}
+	return t
+}
+
+// Links returns all replications of a topology.
+func (t *Topology) Links() []TopologyLink {
+	return t.links
+}
+
+// Servers running the replications of a topology, each one once
+func (t *Topology) runners() []*Server {
+	seen := make(map[string]bool)
+	var runners []*Server
+	for _, l := range t.links {
+		if !seen[l.Runner.URL()] {
+			seen[l.Runner.URL()] = true
+			runners = append(runners, l.Runner)
+		}
+	}
+	return runners
+}
+
+// Apply creates or updates the replication documents of all links. Documents of links
+// that were removed from the topology are deleted. Applying it again doesn't change anything.
+func (t *Topology) Apply(opts ...Option) error {
+	for _, l := range t.links {
+		repl, err := l.replication(t.name)
+		if err != nil {
+			return err
+		}
+		if err = l.Runner.ensureReplication(repl, opts); err != nil {
+			return err
+		}
+	}
+	drifts, err := t.Drift(opts...)
+	if err != nil {
+		return err
+	}
+	for _, d := range drifts {
+		if d.Kind == DriftUnexpected {
+			if err = d.Runner.Database(replicatorDB).Delete(d.DocID, d.rev, opts...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Teardown deletes the replication documents of a topology, which stops its replications.
+func (t *Topology) Teardown(opts ...Option) error {
+	for _, runner := range t.runners() {
+		docs, err := t.docs(runner, opts)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err = runner.Database(replicatorDB).Delete(doc.ID, doc.Rev, opts...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DriftKind describes how the actual state of a replication differs from its topology.
+type DriftKind string
+
+// Kinds of drift
+const (
+	DriftMissing    DriftKind = "missing"    // No replication document
+	DriftChanged    DriftKind = "changed"    // Replication document differs from the link
+	DriftFailed     DriftKind = "failed"     // CouchDB gave up on the replication
+	DriftUnexpected DriftKind = "unexpected" // Replication document without a link
+)
+
+// TopologyDrift is a replication that isn't in the state its topology declares.
+type TopologyDrift struct {
+	Kind   DriftKind
+	DocID  string
+	Runner *Server
+	Link   *TopologyLink // nil for unexpected documents
+	rev    string
+}
+
+// Drift compares a topology with the replication documents on the servers running it. An empty
+// result means everything is in place, see Apply() to fix drift.
+func (t *Topology) Drift(opts ...Option) ([]TopologyDrift, error) {
+	var drifts []TopologyDrift
+	for _, runner := range t.runners() {
+		docs, err := t.docs(runner, opts)
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[string]replicatorDoc, len(docs))
+		for _, doc := range docs {
+			existing[doc.ID] = doc
+		}
+		for i := range t.links {
+			l := &t.links[i]
+			if l.Runner.URL() != runner.URL() {
+				continue
+			}
+			repl, err := l.replication(t.name)
+			if err != nil {
+				return nil, err
+			}
+			doc, ok := existing[repl.ID]
+			delete(existing, repl.ID)
+			drift := TopologyDrift{DocID: repl.ID, Runner: runner, Link: l, rev: doc.Rev}
+			switch {
+			case !ok:
+				drift.Kind = DriftMissing
+			case !doc.matches(repl):
+				drift.Kind = DriftChanged
+			case doc.State == ReplicationError || doc.State == ReplicationFailed:
+				drift.Kind = DriftFailed
+			default:
+				continue
+			}
+			drifts = append(drifts, drift)
+		}
+		for id, doc := range existing {
+			drifts = append(drifts, TopologyDrift{Kind: DriftUnexpected, DocID: id, Runner: runner, rev: doc.Rev})
+		}
+	}
+	return drifts, nil
+}
+
+// Replication documents of a topology on a runner. The prefix of their ids also matches the documents
+// of topologies named like this one plus a dash, e.g. "fleet-eu" for "fleet", so only ids ending
+// in a hash right after the prefix count
+func (t *Topology) docs(runner *Server, opts []Option) ([]replicatorDoc, error) {
+	prefix := runner.dbPrefix + t.name + "-"
+	docs, err := runner.replicatorDocs(prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+	own := docs[:0]
+	for _, doc := range docs {
+		hash := strings.TrimPrefix(doc.ID, prefix)
+		if _, err := hex.DecodeString(hash); err == nil && len(hash) == linkHashLen && hash != doc.ID {
+			own = append(own, doc)
+		}
+	}
+	return own, nil
+}
+
+// Documents in the _replicator database of a server whose ids start with prefix
+func (s *Server) replicatorDocs(prefix string, opts []Option) ([]replicatorDoc, error) {
+	var result struct {
+		Rows []struct {
+			Doc replicatorDoc `json:"doc"`
+		} `json:"rows"`
+	}
+	start, _ := json.Marshal(prefix)
+	end, _ := json.Marshal(prefix + HighString)
+	options := map[string]interface{}{"startkey": string(start), "endkey": string(end), "include_docs": true}
+	url := s.Database(replicatorDB).URL() + "/_all_docs" + urlEncode(options)
+	if _, err := do(url, "GET", s.Cred(), nil, &result, s.withDefaults(opts)); err != nil {
+		return nil, err
+	}
+	docs := make([]replicatorDoc, len(result.Rows))
+	for i, row := range result.Rows {
+		docs[i] = row.Doc
+	}
+	return docs, nil
+}
@@ -0,0 +1,139 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestTopologyLinks(t *testing.T) {
+	t.Parallel()
+	central := couch.NewServer("http://central:5984", nil).Database("fleet")
+	edge1 := couch.NewServer("http://edge1:5984", nil).Database("fleet")
+	edge2 := couch.NewServer("http://edge2:5984", nil).Database("fleet")
+
+	links := couch.NewTopology("fleet").HubSpoke(central, edge1, edge2).Links()
+	if len(links) != 4 {
+		t.Fatal("Hub and two spokes should have four links, got", len(links))
+	}
+	for _, l := range links {
+		if l.Runner.URL() == "http://central:5984" {
+			t.Error("Hub should not run replications of spokes")
+		}
+	}
+
+	links = couch.NewTopology("fleet").Mesh(central, edge1, edge2).Links()
+	if len(links) != 6 {
+		t.Fatal("Mesh of three should have six links, got", len(links))
+	}
+	for _, l := range links {
+		if l.Runner != l.Source.Server() {
+			t.Error("Mesh replications should be run by the server of their source")
+		}
+	}
+}
+
+func TestTopologyNamePrefix(t *testing.T) {
+	t.Parallel()
+	// A topology named "fleet" shares the prefix of its ids with one named "fleet-eu"
+	docs := []string{"fleet-eu-0123456789abcdef"}
+	var mu sync.Mutex
+	var deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_replicator/_all_docs":
+			var prefix string
+			json.Unmarshal([]byte(r.URL.Query().Get("startkey")), &prefix)
+			var rows []string
+			for _, id := range docs {
+				if strings.HasPrefix(id, prefix) {
+					rows = append(rows, `{"id":"`+id+`","doc":{"_id":"`+id+`","_rev":"1-a"}}`)
+				}
+			}
+			w.Write([]byte(`{"rows":[` + strings.Join(rows, ",") + `]}`))
+		case r.Method == "DELETE":
+			mu.Lock()
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/_replicator/"))
+			mu.Unlock()
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer ts.Close()
+	runner := couch.NewServer(ts.URL, nil)
+	central := couch.NewServer("http://central:5984", nil).Database("fleet")
+
+	drifts, err := couch.NewTopology("fleet").Link(runner.Database("fleet"), central).Drift()
+	if err != nil {
+		t.Fatal("Detecting drift returned error:", err)
+	}
+	if len(drifts) != 1 || drifts[0].Kind != couch.DriftMissing {
+		t.Error("Documents of another topology should not drift, got", drifts)
+	}
+	if err = couch.NewTopology("fleet").Link(runner.Database("fleet"), central).Teardown(); err != nil {
+		t.Fatal("Tearing down topology returned error:", err)
+	}
+	if len(deleted) != 0 {
+		t.Error("Teardown should not delete documents of another topology, deleted", deleted)
+	}
+
+	drifts, err = couch.NewTopology("fleet-eu").Link(runner.Database("fleet"), central).Drift()
+	if err != nil {
+		t.Fatal("Detecting drift returned error:", err)
+	}
+	unexpected := 0
+	for _, d := range drifts {
+		if d.Kind == couch.DriftUnexpected && d.DocID == docs[0] {
+			unexpected++
+		}
+	}
+	if unexpected != 1 {
+		t.Error("Topology should still find its own documents, got", drifts)
+	}
+}
+
+func TestIntegrationTopology(t *testing.T) {
+	db := setUpDatabase(t)
+	defer tearDownDatabase(db, t)
+	repl := server().Database(testReplDB)
+	defer repl.DropDatabase()
+
+	topo := couch.NewTopology("couch-test").Mesh(db, repl)
+	drifts, err := topo.Drift()
+	if err != nil {
+		t.Fatal("Detecting drift returned error:", err)
+	}
+	if len(drifts) != 2 || drifts[0].Kind != couch.DriftMissing {
+		t.Error("Replications should be missing before applying topology, got", drifts)
+	}
+	if err = topo.Apply(); err != nil {
+		t.Fatal("Applying topology returned error:", err)
+	}
+	defer topo.Teardown()
+	if drifts, err = topo.Drift(); err != nil || len(drifts) != 0 {
+		t.Error("Applied topology should not drift, got", drifts, err)
+	}
+
+	// Links removed from the topology are unexpected and deleted on apply
+	smaller := couch.NewTopology("couch-test").Link(db, repl)
+	if drifts, err = smaller.Drift(); err != nil || len(drifts) != 1 || drifts[0].Kind != couch.DriftUnexpected {
+		t.Error("Removed link should be unexpected, got", drifts, err)
+	}
+	if err = smaller.Apply(); err != nil {
+		t.Fatal("Applying smaller topology returned error:", err)
+	}
+	if drifts, err = smaller.Drift(); err != nil || len(drifts) != 0 {
+		t.Error("Applied topology should not drift, got", drifts, err)
+	}
+
+	if err = topo.Teardown(); err != nil {
+		t.Fatal("Tearing down topology returned error:", err)
+	}
+	if drifts, err = topo.Drift(); err != nil || len(drifts) != 2 {
+		t.Error("Replications should be missing after teardown, got", drifts, err)
+	}
+}
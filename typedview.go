@@ -0,0 +1,107 @@
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Placeholder for a struct field in the template of a typed view, e.g. {{Name}} or {{Address.City}}
+var fieldPlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)\s*\}\}`)
+
+// TypedView builds a view from a JavaScript map function template whose placeholders refer to fields
+// of a Go struct. This keeps view logic next to the type it indexes and fails early if a field is
+// renamed:
+//
+//	d := couch.NewDesignDoc("people")
+//	d.Views["by_name"], err = db.TypedView(Person{}, `function(doc) { emit({{Name}}, {{Address.City}}); }`, "")
+//	db.EnsureDesignDoc(d)
+//
+// A placeholder is replaced by the expression reading the field from doc, using the name the codec of
+// the database encodes it with, e.g. doc["address"]["city"]. Fields of embedded structs are accessed
+// directly. reduce is used as is.
+func (db *Database) TypedView(example interface{}, mapTmpl, reduce string) (View, error) {
+	t := reflect.TypeOf(example)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return View{}, fmt.Errorf("couch: typed view needs a struct, got %v", t)
+	}
+	_, convention := db.Codec().(ConventionCodec)
+	var err error
+	mapFn := fieldPlaceholder.ReplaceAllStringFunc(mapTmpl, func(placeholder string) string {
+		path := fieldPlaceholder.FindStringSubmatch(placeholder)[1]
+		expr, pathErr := fieldExpr(t, strings.Split(path, "."), convention)
+		if pathErr != nil && err == nil {
+			err = pathErr
+		}
+		return expr
+	})
+	if err != nil {
+		return View{}, err
+	}
+	return View{Map: mapFn, Reduce: reduce}, nil
+}
+
+// JavaScript expression reading a possibly nested field from doc
+func fieldExpr(t reflect.Type, path []string, convention bool) (string, error) {
+	expr := "doc"
+	for _, goName := range path {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return "", fmt.Errorf("couch: %s is not a struct, can't access field %s", t, goName)
+		}
+		name, ft, ok := encodedField(t, goName, convention)
+		if !ok {
+			return "", fmt.Errorf("couch: %s has no encoded field %s", t, goName)
+		}
+		enc, _ := json.Marshal(name)
+		expr += "[" + string(enc) + "]"
+		t = ft
+	}
+	return expr, nil
+}
+
+// Name a struct field is encoded with and its type, fields of embedded structs included
+func encodedField(t reflect.Type, goName string, convention bool) (string, reflect.Type, bool) {
+	if convention {
+		for _, f := range conventionFields(t) {
+			sf := t.FieldByIndex(f.index)
+			if sf.Name == goName {
+				return f.name, sf.Type, true
+			}
+		}
+		return "", nil, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && (!hasTag || name == "") && ft.Kind() == reflect.Struct {
+			if name, ft, ok := encodedField(ft, goName, false); ok {
+				return name, ft, true
+			}
+			continue
+		}
+		if f.PkgPath != "" || f.Name != goName {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		return name, f.Type, true
+	}
+	return "", nil, false
+}
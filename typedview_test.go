@@ -0,0 +1,47 @@
+package couch_test
+
+import (
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+type typedAddress struct {
+	City string `json:"city"`
+}
+
+type typedPerson struct {
+	couch.Doc
+	Name       string `json:"name"`
+	HeightInCm int
+	Address    *typedAddress `json:"address"`
+	Nickname   string        `json:"-"`
+}
+
+func TestTypedView(t *testing.T) {
+	t.Parallel()
+	db := couch.NewServer(testHost, nil).Database("people")
+	v, err := db.TypedView(typedPerson{}, `function(doc) { emit([{{Name}}, {{ Address.City }}], {{HeightInCm}}); }`, "_sum")
+	if err != nil {
+		t.Fatal("Building typed view returned error:", err)
+	}
+	expected := `function(doc) { emit([doc["name"], doc["address"]["city"]], doc["HeightInCm"]); }`
+	if v.Map != expected || v.Reduce != "_sum" {
+		t.Errorf("Expected %s, got %s", expected, v.Map)
+	}
+
+	db.SetCodec(couch.ConventionCodec{})
+	v, err = db.TypedView(&typedPerson{}, `function(doc) { emit({{HeightInCm}}, {{ID}}); }`, "")
+	if err != nil {
+		t.Fatal("Building typed view returned error:", err)
+	}
+	if v.Map != `function(doc) { emit(doc["height_in_cm"], doc["_id"]); }` {
+		t.Error("Fields should be named as the codec encodes them, got", v.Map)
+	}
+
+	for _, tmpl := range []string{`{{Age}}`, `{{Nickname}}`, `{{Name.First}}`} {
+		if _, err = db.TypedView(typedPerson{}, tmpl, ""); err == nil {
+			t.Error("Unknown field should be an error:", tmpl)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package couch
+
+// SetUpdateHandler makes sure a design document contains an update function, e.g.
+//
+//	function(doc, req) { doc.visits = (doc.visits || 0) + 1; return [doc, "ok"]; }
+//
+// Creates the design document if necessary, keeps everything else it has.
+// Call it with CallUpdate().
+func (db *Database) SetUpdateHandler(designID, name, fn string, opts ...Option) error {
+	return db.updateDesignDoc(designID, opts, func(d *DesignDoc) bool {
+		if d.Updates[name] == fn {
+			return false
+		}
+		if d.Updates == nil {
+			d.Updates = make(map[string]string)
+		}
+		d.Updates[name] = fn
+		return true
+	})
+}
+
+// CallUpdate invokes the update handler designID/name for doc, sending body as the request body.
+// If doc has no id, the handler is called without a document and may create one. Like Insert(),
+// it sets the id and the new revision id CouchDB reports for the written document on doc, which
+// keeps doc in sync with the database even though the handler changed it on the server. Handlers
+// that don't write a document leave doc as it is. If response isn't nil, the response of the
+// handler is decoded into it, which requires it to be JSON.
+func (db *Database) CallUpdate(designID, name string, doc Identifiable, body, response interface{}, opts ...Option) error {
+	id, _ := doc.IDRev()
+	if err := validateDocID(id); err != nil {
+		return err
+	}
+	url, method := db.URL()+"/_design/"+designID+"/_update/"+name, "POST"
+	if id != "" {
+		url, method = url+"/"+id, "PUT"
+	}
+	resp, err := do(url, method, db.Cred(), body, response, db.server.withDefaults(opts))
+	if err != nil {
+		return err
+	}
+	if rev := resp.Header.Get("X-Couch-Update-NewRev"); rev != "" {
+		if newID := resp.Header.Get("X-Couch-Id"); newID != "" {
+			id = newID
+		}
+		doc.SetIDRev(id, rev)
+	}
+	return nil
+}
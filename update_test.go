@@ -0,0 +1,53 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestCallUpdate(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/people/_design/people/_update/visit/anna":
+			w.Header().Set("X-Couch-Update-NewRev", "3-c")
+			w.Header().Set("X-Couch-Id", "anna")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"visits": 2}`))
+		case r.Method == "POST" && r.URL.Path == "/people/_design/people/_update/visit":
+			w.Header().Set("X-Couch-Update-NewRev", "1-a")
+			w.Header().Set("X-Couch-Id", "generated")
+			w.WriteHeader(http.StatusCreated)
+		case r.URL.Path == "/people/_design/people/_update/noop/anna":
+			w.Write([]byte(`unchanged`))
+		default:
+			t.Error("Unexpected request", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	db := couch.NewServer(ts.URL, nil).Database("people")
+	anna := &Person{Doc: couch.Doc{ID: "anna", Rev: "2-b"}}
+	var response struct{ Visits int }
+	if err := db.CallUpdate("people", "visit", anna, map[string]int{"by": 1}, &response); err != nil {
+		t.Fatal("Calling update handler returned error:", err)
+	}
+	if anna.Rev != "3-c" || response.Visits != 2 {
+		t.Error("Document should have the new revision and the response be decoded, got", anna.Rev, response)
+	}
+
+	created := &Person{}
+	if err := db.CallUpdate("people", "visit", created, nil, nil); err != nil {
+		t.Fatal("Calling update handler without a document returned error:", err)
+	}
+	if created.ID != "generated" || created.Rev != "1-a" {
+		t.Error("Created document should get its id and revision, got", created.ID, created.Rev)
+	}
+
+	if err := db.CallUpdate("people", "noop", anna, nil, nil); err != nil || anna.Rev != "3-c" {
+		t.Error("Handler that doesn't write should leave the document alone, got", anna.Rev, err)
+	}
+}
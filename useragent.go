@@ -0,0 +1,42 @@
+package couch
+
+import "net/http"
+
+// Version of this package, sent in the default User-Agent
+const Version = "0.1"
+
+// User-Agent sent unless a server is configured with another one
+const defaultUserAgent = "couch-go/" + Version + " (+https://github.com/patrickjuchli/couch)"
+
+// SetUserAgent sets the User-Agent header sent with every call to the server and its databases,
+// by default it names this package and its version. Pass an empty string to use the default again.
+func (s *Server) SetUserAgent(userAgent string) {
+	s.userAgent = userAgent
+}
+
+// SetClientName sends name in an X-Client-Name header with every call to the server and its
+// databases, so that logs of proxies and CouchDB can attribute traffic to the service using this
+// client. An empty name, the default, omits the header.
+func (s *Server) SetClientName(name string) {
+	s.clientName = name
+}
+
+// Identify the client sending a call
+func identifyAs(userAgent, clientName string) Option {
+	return func(o *callOptions) {
+		o.userAgent = userAgent
+		o.clientName = clientName
+	}
+}
+
+// Set the identification headers of a call
+func (o *callOptions) identify(req *http.Request) {
+	userAgent := o.userAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if o.clientName != "" {
+		req.Header.Set("X-Client-Name", o.clientName)
+	}
+}
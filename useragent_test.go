@@ -0,0 +1,42 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestUserAgent(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var userAgent, clientName string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgent, clientName = r.Header.Get("User-Agent"), r.Header.Get("X-Client-Name")
+		mu.Unlock()
+		w.Write([]byte(`{"db_name": "people"}`))
+	}))
+	defer ts.Close()
+
+	server := couch.NewServer(ts.URL, nil)
+	db := server.Database("people")
+	if _, err := db.Info(); err != nil {
+		t.Fatal("Getting info returned error:", err)
+	}
+	if !strings.HasPrefix(userAgent, "couch-go/"+couch.Version) || clientName != "" {
+		t.Error("Package and version should be sent by default, got", userAgent, clientName)
+	}
+
+	server.SetUserAgent("billing/2.3")
+	server.SetClientName("billing-worker")
+	if _, err := db.Info(); err != nil {
+		t.Fatal("Getting info returned error:", err)
+	}
+	if userAgent != "billing/2.3" || clientName != "billing-worker" {
+		t.Error("Configured identification should be sent, got", userAgent, clientName)
+	}
+}
@@ -0,0 +1,70 @@
+package couch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+// IDGenerator returns a new document id. A database uses it to assign ids to new
+// documents before sending them to CouchDB, see Database.SetIDGenerator().
+type IDGenerator func() (string, error)
+
+// RandomID generates a random id client-side. Like the ids generated by
+// CouchDB it consists of 32 hex characters.
+func RandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CouchDB response to _uuids
+type uuidsResponse struct {
+	UUIDs []string `json:"uuids"`
+}
+
+// UUIDs fetches a number of fresh ids from the _uuids endpoint of a CouchDB instance.
+func (s *Server) UUIDs(count int, opts ...Option) ([]string, error) {
+	var resp uuidsResponse
+	url := s.URL() + "/_uuids" + urlEncode(map[string]interface{}{"count": count})
+	_, err := do(url, "GET", s.Cred(), nil, &resp, s.withDefaults(opts))
+	return resp.UUIDs, err
+}
+
+// UUIDGenerator returns an IDGenerator that uses ids from the _uuids endpoint of
+// the CouchDB instance. Ids are fetched in batches of batchSize to save round trips.
+func (s *Server) UUIDGenerator(batchSize int) IDGenerator {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	var mu sync.Mutex
+	var ids []string
+	return func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(ids) == 0 {
+			fetched, err := s.UUIDs(batchSize)
+			if err != nil {
+				return "", err
+			}
+			if len(fetched) == 0 {
+				return "", errors.New("couch: _uuids returned no ids")
+			}
+			ids = fetched
+		}
+		id := ids[0]
+		ids = ids[1:]
+		return id, nil
+	}
+}
+
+// SetIDGenerator makes Insert() assign an id to documents that don't have one yet
+// before sending them. This makes creating documents safe to retry: A retried
+// request can't create a duplicate document but will fail with a conflict instead.
+// Pass nil to let CouchDB assign ids again.
+func (db *Database) SetIDGenerator(gen IDGenerator) {
+	db.idGen = gen
+}
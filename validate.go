@@ -0,0 +1,84 @@
+package couch
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rules for database names, see http://docs.couchdb.org/en/latest/api/database/common.html#put--db
+var dbNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_$()+/-]*$`)
+
+// Longest database name CouchDB accepts
+const maxDBNameLength = 238
+
+// System databases are the only ones allowed to start with an underscore
+var systemDBs = map[string]bool{
+	"_users":          true,
+	"_replicator":     true,
+	"_global_changes": true,
+}
+
+// Document ids starting with an underscore are reserved, except for these prefixes
+var reservedIDPrefixes = []string{"_design/", "_local/"}
+
+// InvalidNameError is returned when a database name violates CouchDB's naming rules.
+// The name is checked before any request is made.
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *InvalidNameError) Error() string {
+	return "couch: invalid database name " + `"` + e.Name + `" (` + e.Reason + ")"
+}
+
+// InvalidIDError is returned when a document id is reserved by CouchDB or isn't valid UTF-8.
+// The id is checked before any request is made.
+type InvalidIDError struct {
+	ID     string
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *InvalidIDError) Error() string {
+	return "couch: invalid document id " + `"` + e.ID + `" (` + e.Reason + ")"
+}
+
+// Check a database name against CouchDB's naming rules
+func validateDBName(name string) error {
+	switch {
+	case name == "":
+		return &InvalidNameError{name, "name is empty"}
+	case systemDBs[name]:
+		return nil
+	case len(name) > maxDBNameLength:
+		return &InvalidNameError{name, "name is longer than 238 characters"}
+	case strings.HasPrefix(name, "_"):
+		return &InvalidNameError{name, "only system databases may start with an underscore"}
+	case !dbNamePattern.MatchString(name):
+		return &InvalidNameError{name, "must start with a lowercase letter and contain only a-z, 0-9 and _$()+-/"}
+	}
+	return nil
+}
+
+// Check that a document id is valid UTF-8 and not reserved. An empty id is valid,
+// CouchDB will assign one when the document is created.
+func validateDocID(id string) error {
+	if !utf8.ValidString(id) {
+		return &InvalidIDError{id, "id is not valid UTF-8"}
+	}
+	if !strings.HasPrefix(id, "_") {
+		return nil
+	}
+	for _, prefix := range reservedIDPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			if len(id) == len(prefix) {
+				return &InvalidIDError{id, "missing name after " + prefix}
+			}
+			return nil
+		}
+	}
+	return &InvalidIDError{id, "ids starting with an underscore are reserved, except for _design/ and _local/"}
+}
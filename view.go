@@ -1,58 +1,378 @@
 package couch
 
-// CouchDB Design Document (not yet public)
-type design struct {
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DesignDoc is a CouchDB design document. Elements of a design document that
+// don't have a field of their own, like shows or lists, are kept in Extras.
+type DesignDoc struct {
 	Doc
-	Views map[string]view `json:"views"`
-	// There a more elements to a design document, they will be added when they are implemented
+	Language          string            `json:"language,omitempty"`
+	Views             map[string]View   `json:"views,omitempty"`
+	Filters           map[string]string `json:"filters,omitempty"`
+	Updates           map[string]string `json:"updates,omitempty"`
+	ValidateDocUpdate string            `json:"validate_doc_update,omitempty"`
+	Extras            Extras            `json:"-"`
 }
 
-// CouchDB View (not yet public)
-type view struct {
+// View holds the map and reduce functions of a view.
+type View struct {
 	Map    string `json:"map,omitempty"`
 	Reduce string `json:"reduce,omitempty"`
 }
 
+// NewDesignDoc returns an empty design document with the id _design/<name>.
+func NewDesignDoc(name string) *DesignDoc {
+	d := &DesignDoc{Views: make(map[string]View)}
+	d.SetIDRev("_design/"+name, "")
+	return d
+}
+
+// Name returns the name of a design document, its id without the _design/ prefix.
+func (d *DesignDoc) Name() string {
+	return strings.TrimPrefix(d.ID, "_design/")
+}
+
+// Whether two design documents have the same content, regardless of their revisions
+func (d *DesignDoc) sameAs(other *DesignDoc) bool {
+	a, b := *d, *other
+	a.Rev, b.Rev = "", ""
+	encA, errA := JSONCodec{}.Marshal(&a)
+	encB, errB := JSONCodec{}.Marshal(&b)
+	return errA == nil && errB == nil && bytes.Equal(encA, encB)
+}
+
+// EnsureDesignDoc makes sure a database contains a design document with exactly the content
+// of d. The design document is only written if it is missing or differs, so it is safe to call
+// on every start of an application. The revision of d is set to the current one.
+func (db *Database) EnsureDesignDoc(d *DesignDoc, opts ...Option) error {
+	existing := &DesignDoc{}
+	err := db.Retrieve(d.ID, existing, opts...)
+	if ErrorType(err) == "not_found" {
+		d.SetIDRev(d.ID, "")
+		return db.Insert(d, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	d.SetIDRev(d.ID, existing.Rev)
+	if d.sameAs(existing) {
+		return nil
+	}
+	return db.Insert(d, opts...)
+}
+
+// DesignDocs returns all design documents of a database.
+func (db *Database) DesignDocs(opts ...Option) ([]*DesignDoc, error) {
+	start := time.Now()
+	var result struct {
+		Rows []struct {
+			Doc json.RawMessage `json:"doc"`
+		} `json:"rows"`
+	}
+	options := map[string]interface{}{
+		"startkey":     `"_design/"`,
+		"endkey":       `"_design0"`,
+		"include_docs": true,
+	}
+	url := db.URL() + "/_all_docs" + urlEncode(options)
+	resp, err := do(url, "GET", db.Cred(), nil, &result, db.server.withDefaults(opts))
+	db.recordQuery("all_docs", "_design/", options, len(result.Rows), resp, err, start)
+	if err != nil {
+		return nil, err
+	}
+	// Decode documents one by one so that the codec keeps unknown elements in Extras
+	docs := make([]*DesignDoc, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		d := &DesignDoc{}
+		if err = db.Codec().Unmarshal(row.Doc, d); err != nil {
+			return nil, err
+		}
+		docs = append(docs, d)
+	}
+	return docs, nil
+}
+
+// Upper bound of an id prefix range in _all_docs. Unlike views, _all_docs compares ids byte-wise,
+// so HighString would miss ids continuing with characters beyond it, like emoji.
+const highIDString = "\U0010ffff"
+
+// DocsWithPrefix writes all documents whose ids start with prefix into docs, a pointer to a slice,
+// e.g. all documents with ids like "person:anna" for the prefix "person:". Documents are in the
+// order of their ids.
+func (db *Database) DocsWithPrefix(prefix string, docs interface{}, opts ...Option) error {
+	start := time.Now()
+	options, err := KeyRange(prefix, prefix+highIDString)
+	if err != nil {
+		return err
+	}
+	options["include_docs"] = true
+	result := &ViewResult{}
+	url := db.URL() + "/_all_docs" + urlEncode(options)
+	resp, err := do(url, "GET", db.Cred(), nil, result, db.server.withDefaults(opts))
+	db.recordQuery("all_docs", prefix, options, len(result.Rows), resp, err, start)
+	if err != nil {
+		return err
+	}
+	return result.decodeDocs(docs, db.Codec())
+}
+
 // Container for ViewResultRows
 type ViewResult struct {
-	Offset uint64
-	Rows   []ViewResultRow
+	TotalRows uint64 `json:"total_rows"`
+	Offset    uint64
+	Rows      []ViewResultRow
+	codec     Codec // Codec of the database, see DecodeDocs()
 }
 
-// A single view result
+// A single view result, Doc is only set when the view is queried with include_docs.
+// Error is set for keys of AllDocs() that don't exist.
 type ViewResultRow struct {
 	ID    string
 	Key   interface{}
 	Value interface{}
+	Doc   json.RawMessage `json:",omitempty"`
+	Error string          `json:",omitempty"`
 }
 
+// ValueInt returns the value of a row as an int, or 0 if it isn't a number.
+//
+// Deprecated: ValueInt can't tell a value of 0 from a value of another type, use ValueFloat() or
+// ValueInto() instead.
 func (r *ViewResultRow) ValueInt() int {
-	num, _ := r.Value.(float64)
-	return int(num)
+	switch num := r.Value.(type) {
+	case float64:
+		return int(num)
+	case json.Number:
+		n, _ := num.Int64()
+		return int(n)
+	}
+	return 0
+}
+
+// ValueFloat returns the value of a row as a number, e.g. the result of a _sum or _count reduce.
+// It fails if the value isn't a number.
+func (r *ViewResultRow) ValueFloat() (float64, error) {
+	switch num := r.Value.(type) {
+	case float64:
+		return num, nil
+	case json.Number:
+		return num.Float64()
+	}
+	return 0, r.valueTypeError("a number")
+}
+
+// ValueString returns the value of a row as a string. It fails if the value isn't a string.
+func (r *ViewResultRow) ValueString() (string, error) {
+	if s, ok := r.Value.(string); ok {
+		return s, nil
+	}
+	return "", r.valueTypeError("a string")
+}
+
+// ValueInto writes the value of a row into v, e.g. a struct for values emitted as objects or
+// an int64 for large integers of a database decoding them as json.Number, see JSONCodec.
+func (r *ViewResultRow) ValueInto(v interface{}) error {
+	enc, err := json.Marshal(r.Value)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(enc, v); err != nil {
+		return fmt.Errorf("couch: value of view row %s: %w", r.ID, err)
+	}
+	return nil
+}
+
+// KeyStrings returns the key of a row as a list of strings, the common shape of compound keys
+// like [type, name]. It fails if the key isn't an array or has elements other than strings.
+func (r *ViewResultRow) KeyStrings() ([]string, error) {
+	list, ok := r.Key.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("couch: key of view row %s is %T, not an array", r.ID, r.Key)
+	}
+	keys := make([]string, len(list))
+	for i, k := range list {
+		if keys[i], ok = k.(string); !ok {
+			return nil, fmt.Errorf("couch: key of view row %s has %T at %d, not a string", r.ID, k, i)
+		}
+	}
+	return keys, nil
 }
 
-// Checks if a view really exists
+// Error for a row value of an unexpected type
+func (r *ViewResultRow) valueTypeError(expected string) error {
+	return fmt.Errorf("couch: value of view row %s is %T, not %s", r.ID, r.Value, expected)
+}
+
+// Checks if a view really exists, errors are passed to the error handler of the server
 func (db *Database) HasView(designID, viewID string) bool {
-	ok, _ := checkHead(db.viewURL(designID, viewID))
+	ok, err := checkHead(db.viewURL(designID, viewID), db.Cred(), db.server.withDefaults(nil))
+	db.server.handleError(err)
 	return ok
 }
 
-// Query a view with options, see http://docs.couchdb.org/en/latest/api/ddoc/views.html#db-design-design-doc-view-view-name
-func (db *Database) Query(designID, viewID string, options map[string]interface{}) (*ViewResult, error) {
-	result := &ViewResult{}
+// Query a view with options, the result is decoded with the codec of the database, see http://docs.couchdb.org/en/latest/api/ddoc/views.html#db-design-design-doc-view-view-name
+func (db *Database) Query(designID, viewID string, options map[string]interface{}, opts ...Option) (*ViewResult, error) {
+	key := cacheKey("view", designID+"/"+viewID, options)
+	seq, cached := db.cache.lookup(db, key, opts)
+	if cached != nil {
+		return cached.view.copy(), nil
+	}
+	start := time.Now()
+	result := &ViewResult{codec: db.Codec()}
 	url := db.viewURL(designID, viewID) + urlEncode(options)
-	_, err := Do(url, "GET", db.Cred(), nil, &result)
+	resp, err := do(url, "GET", db.Cred(), nil, result, withOptions(db.server.withDefaults(opts), decodeWith(db.Codec())))
+	db.recordQuery("view", designID+"/"+viewID, options, len(result.Rows), resp, err, start)
+	if err == nil {
+		db.cache.store(seq, &cacheEntry{key: key, view: result.copy()})
+	}
 	return result, err
 }
 
-// Create a new design document (not yet public)
-func newDesign() *design {
-	d := &design{}
-	d.Views = make(map[string]view)
-	return d
+// QueryDocs queries a view including documents and writes the documents of its rows into
+// docs, a pointer to a slice. Rows without a document are skipped.
+func (db *Database) QueryDocs(designID, viewID string, options map[string]interface{}, docs interface{}, opts ...Option) error {
+	params := map[string]interface{}{"include_docs": true}
+	for k, v := range options {
+		params[k] = v
+	}
+	result, err := db.Query(designID, viewID, params, opts...)
+	if err != nil {
+		return err
+	}
+	return result.decodeDocs(docs, db.Codec())
+}
+
+// DecodeDocs writes the documents included in the rows of a view result, queried with
+// include_docs, into docs, a pointer to a slice. Rows without a document are skipped. Documents
+// are decoded with the codec of the database the result comes from, elements implementing
+// Identifiable get their id and revision with SetIDRev() even if their struct doesn't encode them,
+// so that they can be written back with Insert() right away:
+//
+//	result, err := db.Query("people", "by_city", map[string]interface{}{"key": "Berlin", "include_docs": true})
+//	var people []*Person
+//	err = result.DecodeDocs(&people)
+func (r *ViewResult) DecodeDocs(docs interface{}) error {
+	codec := r.codec
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return r.decodeDocs(docs, codec)
+}
+
+// Decode the documents included in the rows of a view result into docs,
+// a pointer to a slice, using a codec. Rows without a document are skipped.
+func (r *ViewResult) decodeDocs(docs interface{}, codec Codec) error {
+	raw := make([]json.RawMessage, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		if len(row.Doc) > 0 && string(row.Doc) != "null" {
+			raw = append(raw, row.Doc)
+		}
+	}
+	enc, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	if err = codec.Unmarshal(enc, docs); err != nil {
+		return err
+	}
+	return setIDRevs(raw, docs)
+}
+
+// Set id and revision of the decoded documents in docs, a pointer to a slice, that are
+// Identifiable. raw holds the documents in their original encoding.
+func setIDRevs(raw []json.RawMessage, docs interface{}) error {
+	v := reflect.ValueOf(docs)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice || v.Elem().Len() != len(raw) {
+		return nil
+	}
+	v = v.Elem()
+	for i, doc := range raw {
+		elem := v.Index(i)
+		if elem.Kind() != reflect.Ptr && elem.Kind() != reflect.Map && elem.Kind() != reflect.Interface {
+			elem = elem.Addr()
+		}
+		if elem.IsNil() {
+			continue
+		}
+		identifiable, ok := elem.Interface().(Identifiable)
+		if !ok {
+			continue
+		}
+		var meta struct {
+			ID  string `json:"_id"`
+			Rev string `json:"_rev"`
+		}
+		if err := json.Unmarshal(doc, &meta); err != nil {
+			return err
+		}
+		identifiable.SetIDRev(meta.ID, meta.Rev)
+	}
+	return nil
+}
+
+// Make sure a design document contains a view with the given functions.
+// Creates the design document if necessary, keeps any other views it has.
+func (db *Database) ensureView(designID, viewID string, v View, opts []Option) error {
+	return db.updateDesignDoc(designID, opts, func(d *DesignDoc) bool {
+		if existing, ok := d.Views[viewID]; ok && existing == v {
+			return false
+		}
+		if d.Views == nil {
+			d.Views = make(map[string]View)
+		}
+		d.Views[viewID] = v
+		return true
+	})
+}
+
+// Change a design document with edit, which returns whether it changed anything. A missing
+// design document is passed to edit as an empty one and only created if edit changes it.
+func (db *Database) updateDesignDoc(designID string, opts []Option, edit func(*DesignDoc) bool) error {
+	d := NewDesignDoc(designID)
+	err := db.Retrieve(d.ID, d, opts...)
+	if err != nil && ErrorType(err) != "not_found" {
+		return err
+	}
+	if !edit(d) {
+		return nil
+	}
+	return db.Insert(d, opts...)
 }
 
 // Get the complete url to a view of a design document
 func (db *Database) viewURL(designID string, viewID string) string {
 	return db.URL() + "/_design/" + designID + "/_view/" + viewID
 }
+
+// Row of _all_docs when queried by keys. Error is set for keys
+// that don't exist, Value.Deleted for deleted documents.
+type allDocsRow struct {
+	ID    string `json:"id"`
+	Key   string `json:"key"`
+	Value struct {
+		Rev     string `json:"rev"`
+		Deleted bool   `json:"deleted"`
+	} `json:"value"`
+	Doc   json.RawMessage `json:"doc"`
+	Error string          `json:"error"`
+}
+
+// Query _all_docs for a set of document ids, rows are in the same order as keys
+func (db *Database) allDocsByKeys(keys []string, includeDocs bool, opts []Option) ([]allDocsRow, error) {
+	start := time.Now()
+	var result struct {
+		Rows []allDocsRow `json:"rows"`
+	}
+	body := map[string]interface{}{"keys": keys}
+	url := db.URL() + "/_all_docs" + urlEncode(map[string]interface{}{"include_docs": includeDocs})
+	resp, err := do(url, "POST", db.Cred(), body, &result, db.server.withDefaults(opts))
+	db.recordQuery("all_docs", "keys", body, len(result.Rows), resp, err, start)
+	return result.Rows, err
+}
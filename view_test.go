@@ -0,0 +1,113 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestViewResultRowAccessors(t *testing.T) {
+	t.Parallel()
+	var result couch.ViewResult
+	codec := couch.JSONCodec{UseNumber: true}
+	err := codec.Unmarshal([]byte(`{"rows": [
+		{"id": "anna", "key": ["person", "anna"], "value": 9007199254740993},
+		{"id": "bert", "key": "bert", "value": "Bert"},
+		{"id": "carl", "key": ["person", 3], "value": {"name": "Carl", "height": 180}}
+	]}`), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anna, bert, carl := result.Rows[0], result.Rows[1], result.Rows[2]
+
+	if f, err := anna.ValueFloat(); err != nil || f != 9007199254740992 {
+		t.Error("Number should be returned as float, got", f, err)
+	}
+	var n int64
+	if err := anna.ValueInto(&n); err != nil || n != 9007199254740993 {
+		t.Error("Large integer should be decoded exactly, got", n, err)
+	}
+	if keys, err := anna.KeyStrings(); err != nil || fmt.Sprint(keys) != "[person anna]" {
+		t.Error("Compound key should be returned as strings, got", keys, err)
+	}
+	if s, err := bert.ValueString(); err != nil || s != "Bert" {
+		t.Error("String value should be returned, got", s, err)
+	}
+
+	if _, err := bert.ValueFloat(); err == nil {
+		t.Error("String value shouldn't pass as a number")
+	}
+	if _, err := anna.ValueString(); err == nil {
+		t.Error("Number value shouldn't pass as a string")
+	}
+	if _, err := bert.KeyStrings(); err == nil {
+		t.Error("String key shouldn't pass as an array")
+	}
+	if _, err := carl.KeyStrings(); err == nil {
+		t.Error("Key with a number shouldn't pass as strings")
+	}
+
+	var p struct {
+		Name   string `json:"name"`
+		Height int    `json:"height"`
+	}
+	if err := carl.ValueInto(&p); err != nil || p.Name != "Carl" || p.Height != 180 {
+		t.Error("Object value should be decoded, got", p, err)
+	}
+	var s string
+	var typeErr *json.UnmarshalTypeError
+	if err := carl.ValueInto(&s); !errors.As(err, &typeErr) {
+		t.Error("Decoding into a mismatching type should fail, got", err)
+	}
+}
+
+// Document keeping its id and revision out of its encoding
+type taggedNote struct {
+	id, rev string
+	Text    string `json:"text"`
+}
+
+func (n *taggedNote) SetIDRev(id, rev string) { n.id, n.rev = id, rev }
+func (n *taggedNote) IDRev() (string, string) { return n.id, n.rev }
+
+func TestViewResultDecodeDocs(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("include_docs") != "true" {
+			t.Error("Unexpected request", r.URL)
+		}
+		// The second row emits a linked document, its id differs from the one of the row
+		w.Write([]byte(`{"total_rows": 3, "rows": [
+			{"id": "anna", "key": "a", "value": null, "doc": {"_id": "anna", "_rev": "2-a", "text": "Hi", "Name": "Anna"}},
+			{"id": "bert", "key": "b", "value": {"_id": "carl"}, "doc": {"_id": "carl", "_rev": "1-c", "text": "Yo", "Name": "Carl"}},
+			{"id": "dora", "key": "d", "value": {"_id": "gone"}, "doc": null}
+		]}`))
+	}))
+	defer server.Close()
+	db := couch.NewServer(server.URL, nil).Database("db")
+
+	result, err := db.Query("notes", "by_key", map[string]interface{}{"include_docs": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notes []taggedNote
+	if err = result.DecodeDocs(&notes); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 || notes[0].id != "anna" || notes[0].rev != "2-a" || notes[1].id != "carl" || notes[1].rev != "1-c" || notes[1].Text != "Yo" {
+		t.Error("Documents should get the id and revision they were included with, got", notes)
+	}
+	var people []*Person
+	if err = result.DecodeDocs(&people); err != nil || len(people) != 2 || people[1].ID != "carl" || people[1].Name != "Carl" {
+		t.Error("Unexpected documents", people, err)
+	}
+	var docs []couch.DynamicDoc
+	if err = db.QueryDocs("notes", "by_key", nil, &docs); err != nil || len(docs) != 2 || docs[0]["_rev"] != "2-a" {
+		t.Error("Unexpected documents", docs, err)
+	}
+}
@@ -0,0 +1,126 @@
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Emit is a key/value pair emitted by a map function.
+type Emit struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// ViewSpec describes which rows a map function is expected to emit for a set of sample
+// documents. Use it to test view logic before shipping it in a design document:
+//
+//	spec := couch.NewViewSpec(`function(doc) { if (doc.type === "person") { emit(doc.name, 1); } }`).
+//		Given(couch.DynamicDoc{"type": "person", "name": "Anna"}, couch.DynamicDoc{"type": "car"}).
+//		Emits("Anna", 1)
+//	if err := spec.Check(server); err != nil {
+//		t.Error(err)
+//	}
+//
+// The map function is executed by a real CouchDB instance: Check() creates a scratch
+// database, inserts the sample documents, deploys the view, queries it and drops the
+// database again.
+type ViewSpec struct {
+	mapFn    string
+	docs     []interface{}
+	expected []Emit
+}
+
+// NewViewSpec returns a spec for a map function.
+func NewViewSpec(mapFn string) *ViewSpec {
+	return &ViewSpec{mapFn: mapFn}
+}
+
+// Given adds sample documents the map function will be executed on.
+func (s *ViewSpec) Given(docs ...interface{}) *ViewSpec {
+	s.docs = append(s.docs, docs...)
+	return s
+}
+
+// Emits adds a row the map function is expected to emit. Rows can be expected in any order.
+func (s *ViewSpec) Emits(key, value interface{}) *ViewSpec {
+	s.expected = append(s.expected, Emit{key, value})
+	return s
+}
+
+// Run executes the map function on the sample documents and returns all emitted rows in view order.
+func (s *ViewSpec) Run(server *Server) ([]Emit, error) {
+	id, err := RandomID()
+	if err != nil {
+		return nil, err
+	}
+	db := server.Database("viewspec_" + id)
+	if err = db.Create(); err != nil {
+		return nil, err
+	}
+	defer db.DropDatabase()
+
+	if len(s.docs) > 0 {
+		body := map[string]interface{}{"docs": s.docs}
+		if _, err = do(db.URL()+"/_bulk_docs", "POST", db.Cred(), body, nil, db.server.withDefaults(nil)); err != nil {
+			return nil, err
+		}
+	}
+	if err = db.ensureView("spec", "spec", View{Map: s.mapFn}, nil); err != nil {
+		return nil, err
+	}
+	result, err := db.Query("spec", "spec", nil)
+	if err != nil {
+		return nil, err
+	}
+	emits := make([]Emit, len(result.Rows))
+	for i, row := range result.Rows {
+		emits[i] = Emit{row.Key, row.Value}
+	}
+	return emits, nil
+}
+
+// Check executes the map function and returns an error describing all missing
+// and unexpected rows if the emitted rows don't match the expected ones.
+func (s *ViewSpec) Check(server *Server) error {
+	actual, err := s.Run(server)
+	if err != nil {
+		return err
+	}
+
+	// Compare canonical JSON encodings as multisets
+	remaining := make(map[string]int)
+	for _, e := range actual {
+		remaining[canonicalEmit(e)]++
+	}
+	var missing, unexpected []string
+	for _, e := range s.expected {
+		enc := canonicalEmit(e)
+		if remaining[enc] > 0 {
+			remaining[enc]--
+		} else {
+			missing = append(missing, enc)
+		}
+	}
+	for enc, n := range remaining {
+		for ; n > 0; n-- {
+			unexpected = append(unexpected, enc)
+		}
+	}
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return nil
+	}
+	sort.Strings(unexpected)
+	return fmt.Errorf("couch: view spec failed, missing rows: [%s], unexpected rows: [%s]",
+		strings.Join(missing, " "), strings.Join(unexpected, " "))
+}
+
+// Encode an emitted row so that equal rows have equal encodings
+func canonicalEmit(e Emit) string {
+	enc, _ := json.Marshal([]interface{}{e.Key, e.Value})
+	var v interface{}
+	json.Unmarshal(enc, &v)
+	enc, _ = json.Marshal(v)
+	return string(enc)
+}
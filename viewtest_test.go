@@ -0,0 +1,72 @@
+package couch_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestViewSpecSession(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var unauthorized []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_session" {
+			http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: "cookie", MaxAge: 600})
+			w.Write([]byte(`{"ok": true}`))
+			return
+		}
+		if c, _ := r.Cookie("AuthSession"); c == nil {
+			mu.Lock()
+			unauthorized = append(unauthorized, r.Method+" "+r.URL.Path)
+			mu.Unlock()
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_design/spec") && r.Method == "GET":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "not_found", "reason": "missing"}`))
+		case strings.HasSuffix(r.URL.Path, "/_view/spec"):
+			w.Write([]byte(`{"total_rows": 1, "rows": [{"id": "anna", "key": "Anna", "value": 170}]}`))
+		case strings.HasSuffix(r.URL.Path, "/_bulk_docs"):
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`[{"ok": true, "id": "anna", "rev": "1-a"}]`))
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok": true, "id": "_design/spec", "rev": "1-a"}`))
+		}
+	}))
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	if err := s.Login("anna", "secret"); err != nil {
+		t.Fatal("Login returned error:", err)
+	}
+	spec := couch.NewViewSpec(`function(doc) { emit(doc.name, doc.height); }`).
+		Given(couch.DynamicDoc{"name": "Anna", "height": 170})
+	if err := spec.Emits("Anna", 170).Check(s); err != nil {
+		t.Error("Spec matching map function failed:", err)
+	}
+	mu.Lock()
+	if len(unauthorized) != 0 {
+		t.Error("Spec should use the session of the server, calls without it:", unauthorized)
+	}
+	mu.Unlock()
+}
+
+func TestIntegrationViewSpec(t *testing.T) {
+	mapFn := `function(doc) { if (doc.type === "person") { emit(doc.name, doc.height); } }`
+	spec := couch.NewViewSpec(mapFn).
+		Given(couch.DynamicDoc{"type": "person", "name": "Anna", "height": 170}).
+		Given(couch.DynamicDoc{"type": "car", "name": "Beetle"})
+
+	if err := spec.Emits("Anna", 170).Check(server()); err != nil {
+		t.Error("Spec matching map function failed:", err)
+	}
+	if err := spec.Emits("Beetle", nil).Check(server()); err == nil {
+		t.Error("Spec expecting a row that isn't emitted should fail")
+	}
+}
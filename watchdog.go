@@ -0,0 +1,160 @@
+package couch
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ReplicationProgress is the result of checking a continuous replication. SourceSeq is the
+// sequence of the source the replication has read up to, SourceUpdateSeq the latest sequence of
+// the source database, which is only known if the replication has been started with a source
+// Database. Idle is how long SourceSeq hasn't advanced.
+type ReplicationProgress struct {
+	Time            time.Time
+	Active          bool
+	SourceSeq       Seq
+	SourceUpdateSeq Seq
+	Idle            time.Duration
+	Stalled         bool // Whether the replication is stuck while the source keeps changing
+	Restarted       bool // Whether the replication has been restarted because it stalled
+}
+
+// ReplicationWatchdog detects a continuous replication that is stuck: CouchDB still lists it as
+// active, so IsActive() reports it as fine, but it stopped reading changes while the source keeps
+// changing. Such a replication usually only recovers once it is restarted:
+//
+//	watchdog := repl.Watchdog(10 * time.Minute)
+//	watchdog.Start(time.Minute, true, func(p *couch.ReplicationProgress, err error) {
+//		if p != nil && p.Restarted {
+//			log.Println("restarted replication stalled at", p.SourceSeq)
+//		}
+//	})
+//
+// A watchdog can also check the replication manually with Check().
+type ReplicationWatchdog struct {
+	repl       *Replication
+	stallAfter time.Duration
+
+	mu        sync.Mutex
+	seq       Seq       // Source sequence of the replication at the last check
+	updateSeq Seq       // Update sequence of the source when seq was first seen
+	since     time.Time // When seq was first seen
+	stop      chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+// Watchdog returns a watchdog considering a replication stalled once it hasn't
+// advanced for stallAfter while the source changed.
+func (repl *Replication) Watchdog(stallAfter time.Duration) *ReplicationWatchdog {
+	return &ReplicationWatchdog{repl: repl, stallAfter: stallAfter}
+}
+
+// Check compares the progress of the replication with the previous check. The source counts as
+// changing if its update sequence moved on since the replication last advanced or, if the source
+// isn't known, if CouchDB reports pending changes.
+func (w *ReplicationWatchdog) Check(opts ...Option) (*ReplicationProgress, error) {
+	task, err := w.repl.task(opts)
+	if err != nil {
+		return nil, err
+	}
+	progress := &ReplicationProgress{Time: w.repl.runner.server.clock().Now()}
+	if task == nil {
+		w.reset()
+		return progress, nil
+	}
+	progress.Active, progress.SourceSeq = true, task.SourceSeq
+	if source := w.repl.source; source != nil {
+		info, err := source.Info(opts...)
+		if err != nil {
+			return nil, err
+		}
+		progress.SourceUpdateSeq = info.UpdateSeq
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.since.IsZero() || task.SourceSeq.Compare(w.seq) != 0 {
+		w.seq, w.updateSeq, w.since = task.SourceSeq, progress.SourceUpdateSeq, progress.Time
+		return progress, nil
+	}
+	progress.Idle = progress.Time.Sub(w.since)
+	sourceChanged := task.ChangesPending != nil && *task.ChangesPending > 0
+	if progress.SourceUpdateSeq != "" {
+		sourceChanged = progress.SourceUpdateSeq.Compare(w.updateSeq) > 0
+	}
+	progress.Stalled = sourceChanged && progress.Idle >= w.stallAfter
+	return progress, nil
+}
+
+// Forget the progress seen so far
+func (w *ReplicationWatchdog) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq, w.updateSeq, w.since = "", "", time.Time{}
+}
+
+// Start checks the replication every interval in the background until Stop() is called. If
+// autoRestart is enabled, the replication is restarted whenever it stalled. Every progress
+// or error is passed to notify, which may be nil.
+func (w *ReplicationWatchdog) Start(interval time.Duration, autoRestart bool, notify func(*ReplicationProgress, error)) error {
+	if interval <= 0 {
+		return errors.New("couch: replication watchdog interval must be positive")
+	}
+	if !w.repl.continuous {
+		return errors.New("couch: only continuous replications can be watched")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stop != nil {
+		return errors.New("couch: replication watchdog is already running")
+	}
+	err := w.repl.runner.server.register(w, func() error {
+		w.Stop()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run(interval, autoRestart, notify)
+	return nil
+}
+
+// Stop ends checking started with Start().
+func (w *ReplicationWatchdog) Stop() {
+	w.mu.Lock()
+	stop, done := w.stop, w.done
+	w.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	w.stopOnce.Do(func() { close(stop) })
+	<-done
+	w.repl.runner.server.unregister(w)
+}
+
+// Check every interval until stopped
+func (w *ReplicationWatchdog) run(interval time.Duration, autoRestart bool, notify func(*ReplicationProgress, error)) {
+	defer close(w.done)
+	clock := w.repl.runner.server.clock()
+	for {
+		progress, err := w.Check()
+		if err == nil && autoRestart && progress.Stalled {
+			if err = w.repl.Restart(); err == nil {
+				progress.Restarted = true
+				w.reset()
+			}
+		}
+		if notify != nil {
+			notify(progress, err)
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-clock.After(interval):
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+// Serves a continuous replication stuck at sequence 5 of a source that keeps changing,
+// once restarted it keeps up with the source
+func stuckReplicationServer(t *testing.T, requests *[]map[string]interface{}) *httptest.Server {
+	var mu sync.Mutex
+	updates := 10
+	restarted := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/_replicate":
+			var req map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&req)
+			*requests = append(*requests, req)
+			if req["cancel"] == true {
+				w.Write([]byte(`{"ok": true}`))
+				return
+			}
+			restarted = len(*requests) > 1
+			w.Write([]byte(`{"ok": true, "_local_id": "1234+continuous"}`))
+		case "/_active_tasks":
+			sourceSeq := 5
+			if restarted {
+				sourceSeq = updates
+			}
+			fmt.Fprintf(w, `[{"type": "replication", "replication_id": "1234+continuous", "continuous": true, "source_seq": %d}]`, sourceSeq)
+		case "/a":
+			updates++
+			fmt.Fprintf(w, `{"db_name": "a", "update_seq": %d}`, updates)
+		default:
+			t.Error("Unexpected request", r.URL.Path)
+		}
+	}))
+}
+
+func TestReplicationWatchdog(t *testing.T) {
+	t.Parallel()
+	var requests []map[string]interface{}
+	ts := stuckReplicationServer(t, &requests)
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	repl, err := s.Database("a").ReplicateTo(s.Database("b"), true)
+	if err != nil {
+		t.Fatal("Replication returned error:", err)
+	}
+	watchdog := repl.Watchdog(0)
+	progress, err := watchdog.Check()
+	if err != nil || !progress.Active || progress.SourceSeq != "5" || progress.Stalled {
+		t.Fatal("First check should only record the progress, got", progress, err)
+	}
+	progress, err = watchdog.Check()
+	if err != nil || !progress.Stalled {
+		t.Fatal("Replication should be stalled while the source changes, got", progress, err)
+	}
+
+	restarted := make(chan *couch.ReplicationProgress, 1)
+	err = watchdog.Start(time.Millisecond, true, func(p *couch.ReplicationProgress, err error) {
+		if err != nil {
+			t.Error("Watchdog returned error:", err)
+		}
+		if p != nil && p.Restarted {
+			select {
+			case restarted <- p:
+			default:
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal("Starting watchdog returned error:", err)
+	}
+	select {
+	case <-restarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stalled replication should have been restarted")
+	}
+	watchdog.Stop()
+	if len(requests) != 3 || requests[1]["cancel"] != true || requests[2]["cancel"] != nil {
+		t.Error("Replication should have been cancelled and started again, got", requests)
+	}
+	if progress, err = watchdog.Check(); err != nil || progress.Stalled {
+		t.Error("Restarted replication shouldn't be stalled, got", progress, err)
+	}
+}
+
+func TestReplicationWatchdogClusterNodes(t *testing.T) {
+	t.Parallel()
+	for _, growing := range []bool{false, true} {
+		var mu sync.Mutex
+		checks := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			// Nodes answer with different encodings of the same sequences
+			node := "g1AAAABneJzLYWBgYMpgTmHg"
+			if checks%2 == 1 {
+				node = "g1AAAABneJzLYWBgYMpgTmHh"
+			}
+			switch r.URL.Path {
+			case "/_replicate":
+				w.Write([]byte(`{"ok": true, "_local_id": "1234+continuous"}`))
+			case "/_active_tasks":
+				fmt.Fprintf(w, `[{"type": "replication", "replication_id": "1234+continuous", "continuous": true, "source_seq": "5-%s"}]`, node)
+			case "/a":
+				updates := 10
+				if growing {
+					updates += checks
+				}
+				fmt.Fprintf(w, `{"db_name": "a", "update_seq": "%d-%s"}`, updates, node)
+				checks++
+			}
+		}))
+		defer ts.Close()
+
+		s := couch.NewServer(ts.URL, nil)
+		repl, err := s.Database("a").ReplicateTo(s.Database("b"), true)
+		if err != nil {
+			t.Fatal("Replication returned error:", err)
+		}
+		watchdog := repl.Watchdog(0)
+		if _, err = watchdog.Check(); err != nil {
+			t.Fatal("Checking replication returned error:", err)
+		}
+		progress, err := watchdog.Check()
+		if err != nil || progress.Stalled != growing {
+			t.Errorf("Replication should be stalled only if the source grows (%v), got %v %v", growing, progress, err)
+		}
+	}
+}
+
+func TestReplicationWatchdogOneShot(t *testing.T) {
+	t.Parallel()
+	var requests []map[string]interface{}
+	ts := stuckReplicationServer(t, &requests)
+	defer ts.Close()
+
+	s := couch.NewServer(ts.URL, nil)
+	repl, err := s.Database("a").ReplicateTo(s.Database("b"), false)
+	if err != nil {
+		t.Fatal("Replication returned error:", err)
+	}
+	if err = repl.Watchdog(time.Minute).Start(time.Second, true, nil); err == nil {
+		t.Error("Only continuous replications should be watched")
+	}
+}
@@ -0,0 +1,135 @@
+package couch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Header carrying the HMAC-SHA256 signature of a webhook payload
+const webhookSignatureHeader = "X-Couch-Signature"
+
+// Number of changes a webhook bridge processes at once
+const webhookBatchSize = 100
+
+// Webhook is an HTTP endpoint receiving changes of a database as JSON POST requests.
+type Webhook struct {
+	URL string
+	// Secret signs every payload with HMAC-SHA256, the signature is sent as hex
+	// in the header X-Couch-Signature in the form "sha256=<signature>"
+	Secret []byte
+	// Filter selects the changes sent to the endpoint, all changes if nil
+	Filter func(ChangeEvent) bool
+	// Transform turns a change into the payload, the change itself is sent if nil
+	Transform func(ChangeEvent) (interface{}, error)
+	// MaxRetries is the number of retries of a failed delivery
+	MaxRetries int
+	// Backoff sets the delays between retries, the one of the server if nil, see Server.SetBackoff()
+	Backoff Backoff
+}
+
+// WebhookBridge delivers the changes of a database to webhooks:
+//
+//	bridge := couch.NewWebhookBridge(db.Follower("webhooks"), &couch.Webhook{
+//		URL:        "https://example.com/hooks/people",
+//		Secret:     secret,
+//		MaxRetries: 5,
+//	})
+//	err := bridge.Run(ctx)
+//
+// Delivery is at-least-once: the follower's checkpoint only advances once all webhooks have
+// received a batch of changes. If a delivery still fails after all retries, Run() returns the
+// error and the next run sends the batch again, including to the webhooks that already received
+// it. Receivers should therefore ignore changes they already know by their id and sequence.
+type WebhookBridge struct {
+	follower *Follower
+	hooks    []*Webhook
+}
+
+// NewWebhookBridge returns a bridge delivering the changes processed by a follower to webhooks.
+func NewWebhookBridge(follower *Follower, hooks ...*Webhook) *WebhookBridge {
+	return &WebhookBridge{follower: follower, hooks: hooks}
+}
+
+// Run delivers changes until ctx is done or a delivery fails.
+func (b *WebhookBridge) Run(ctx context.Context) error {
+	return b.follower.ProcessBatches(ctx, webhookBatchSize, func(changes []ChangeEvent) error {
+		for _, change := range changes {
+			for _, hook := range b.hooks {
+				if hook.Filter != nil && !hook.Filter(change) {
+					continue
+				}
+				if err := hook.deliver(ctx, change, b.follower.db.server); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Send a change to the endpoint, retrying failed attempts with the delays
+// of the webhook or the server
+func (hook *Webhook) deliver(ctx context.Context, change ChangeEvent, server *Server) error {
+	var payload interface{} = change
+	if hook.Transform != nil {
+		var err error
+		if payload, err = hook.Transform(change); err != nil {
+			return err
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	backoff := hook.Backoff
+	if backoff == nil {
+		backoff = server.backoff()
+	}
+	for attempt := 0; ; attempt++ {
+		err = hook.post(ctx, body)
+		if err == nil || attempt >= hook.MaxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-server.clock().After(backoff.Delay(attempt)):
+		}
+	}
+}
+
+// Make a single delivery attempt, any status but 2xx is a failure
+func (hook *Webhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if hook.Secret != nil {
+		req.Header.Set(webhookSignatureHeader, "sha256="+SignWebhookPayload(hook.Secret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	closeBody(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("couch: webhook %s answered with status %d", hook.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 signature of a payload.
+// Receivers use it to verify the X-Couch-Signature header.
+func SignWebhookPayload(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,66 @@
+package couch_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestWebhookBridge(t *testing.T) {
+	t.Parallel()
+	couchdb := followerServer(t)
+	defer couchdb.Close()
+
+	secret := []byte("secret")
+	var mu sync.Mutex
+	var received []string
+	attempts := 0
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("X-Couch-Signature") != "sha256="+couch.SignWebhookPayload(secret, body) {
+			t.Error("Payload should be signed")
+		}
+		var payload map[string]string
+		json.Unmarshal(body, &payload)
+		received = append(received, payload["doc"])
+		if len(received) == 2 {
+			cancel()
+		}
+	}))
+	defer receiver.Close()
+
+	f := couch.NewServer(couchdb.URL, nil).Database("people").Follower("webhooks")
+	f.SetPollInterval(time.Millisecond)
+	bridge := couch.NewWebhookBridge(f, &couch.Webhook{
+		URL:        receiver.URL,
+		Secret:     secret,
+		MaxRetries: 1,
+		Filter:     func(c couch.ChangeEvent) bool { return c.ID != "doc2" },
+		Transform: func(c couch.ChangeEvent) (interface{}, error) {
+			return map[string]string{"doc": c.ID}, nil
+		},
+	})
+	if err := bridge.Run(ctx); err != context.Canceled {
+		t.Error("Bridge should run until cancelled, got", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) < 2 || received[0] != "doc1" || received[1] != "doc3" {
+		t.Error("Filtered changes should be delivered after a retry, got", received)
+	}
+}
@@ -0,0 +1,122 @@
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Feature is an optional capability a CouchDB instance announces in its welcome message.
+type Feature string
+
+// Features announced by CouchDB 2.x and later, depending on version and configuration
+const (
+	FeatureFIPS           Feature = "fips"
+	FeatureSearch         Feature = "search"
+	FeatureNouveau        Feature = "nouveau"
+	FeaturePartitioned    Feature = "partitioned"
+	FeatureReshard        Feature = "reshard"
+	FeatureScheduler      Feature = "scheduler"
+	FeatureAccessReady    Feature = "access-ready"
+	FeatureStorageEngines Feature = "pluggable-storage-engines"
+)
+
+// FeatureSet is a set of features, decoded from the JSON array CouchDB sends.
+type FeatureSet map[Feature]bool
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (fs *FeatureSet) UnmarshalJSON(data []byte) error {
+	var list []Feature
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*fs = make(FeatureSet, len(list))
+	for _, f := range list {
+		(*fs)[f] = true
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (fs FeatureSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fs.List())
+}
+
+// Has returns whether a set contains a feature.
+func (fs FeatureSet) Has(f Feature) bool {
+	return fs[f]
+}
+
+// List returns the features of a set in alphabetical order.
+func (fs FeatureSet) List() []Feature {
+	list := make([]Feature, 0, len(fs))
+	for f := range fs {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// Welcome is the message a CouchDB instance answers requests to its root with.
+// CouchDB 1.x doesn't announce features, Features is empty then.
+type Welcome struct {
+	CouchDB  string     `json:"couchdb"`
+	Version  string     `json:"version"`
+	GitSHA   string     `json:"git_sha,omitempty"`
+	UUID     string     `json:"uuid,omitempty"`
+	Features FeatureSet `json:"features,omitempty"`
+	Vendor   struct {
+		Name    string `json:"name,omitempty"`
+		Version string `json:"version,omitempty"`
+	} `json:"vendor"`
+}
+
+// Welcome message of a server, once it has been retrieved
+type welcomeCache struct {
+	mu      sync.Mutex
+	welcome *Welcome
+}
+
+// Welcome returns the welcome message of a CouchDB instance. It is only retrieved once and kept
+// for the lifetime of the server handle, since features only change when the instance restarts.
+func (s *Server) Welcome(opts ...Option) (*Welcome, error) {
+	s.welcome.mu.Lock()
+	defer s.welcome.mu.Unlock()
+	if s.welcome.welcome != nil {
+		return s.welcome.welcome, nil
+	}
+	var w Welcome
+	if _, err := do(s.URL()+"/", "GET", s.Cred(), nil, &w, s.withDefaults(opts)); err != nil {
+		return nil, err
+	}
+	s.welcome.welcome = &w
+	return &w, nil
+}
+
+// HasFeature returns whether a CouchDB instance announces a feature, see Welcome().
+func (s *Server) HasFeature(f Feature, opts ...Option) (bool, error) {
+	w, err := s.Welcome(opts...)
+	if err != nil {
+		return false, err
+	}
+	return w.Features.Has(f), nil
+}
+
+// RequireFeature returns an error matching ErrUnsupported if a CouchDB instance doesn't announce
+// a feature. Call it before using a feature to fail with a clear error instead of whatever
+// CouchDB answers to an unknown endpoint or parameter:
+//
+//	if err := server.RequireFeature(couch.FeatureSearch); err != nil {
+//		return err
+//	}
+func (s *Server) RequireFeature(f Feature, opts ...Option) error {
+	ok, err := s.HasFeature(f, opts...)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("couch: feature %s of %s: %w", f, s.URL(), ErrUnsupported)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package couch_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/patrickjuchli/couch"
+)
+
+func TestWelcomeFeatures(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			t.Error("Unexpected path", r.URL.Path)
+		}
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"couchdb": "Welcome", "version": "3.3.3", "git_sha": "40afbcfc7",
+			"uuid": "a1b2", "features": ["access-ready", "partitioned", "pluggable-storage-engines", "reshard", "scheduler"],
+			"vendor": {"name": "The Apache Software Foundation"}}`))
+	}))
+	defer server.Close()
+	s := couch.NewServer(server.URL, nil)
+
+	w, err := s.Welcome()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Version != "3.3.3" || w.Vendor.Name != "The Apache Software Foundation" || len(w.Features) != 5 {
+		t.Error("Unexpected welcome", w)
+	}
+	if ok, err := s.HasFeature(couch.FeaturePartitioned); !ok || err != nil {
+		t.Error("Partitioned should be supported, got", ok, err)
+	}
+	if ok, err := s.HasFeature(couch.FeatureSearch); ok || err != nil {
+		t.Error("Search shouldn't be supported, got", ok, err)
+	}
+	err = s.RequireFeature(couch.FeatureSearch)
+	if !errors.Is(err, couch.ErrUnsupported) || couch.Message(err) != "The server doesn't support this." {
+		t.Error("Missing feature should be ErrUnsupported, got", err)
+	}
+	if err := s.RequireFeature(couch.FeatureReshard); err != nil {
+		t.Error(err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Error("Welcome should only be retrieved once, got", calls)
+	}
+
+	enc, _ := json.Marshal(w.Features)
+	if string(enc) != `["access-ready","partitioned","pluggable-storage-engines","reshard","scheduler"]` {
+		t.Error("Features should encode as sorted array, got", string(enc))
+	}
+}
+
+func TestWelcomeWithoutFeatures(t *testing.T) {
+	t.Parallel()
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"couchdb": "Welcome", "version": "1.7.2"}`)
+	}))
+	defer server.Close()
+	s := couch.NewServer(server.URL, nil)
+
+	if _, err := s.HasFeature(couch.FeatureScheduler); couch.StatusCode(err) != http.StatusServiceUnavailable {
+		t.Error("Failed request should return its error, got", err)
+	}
+	fail = false
+	if ok, err := s.HasFeature(couch.FeatureScheduler); ok || err != nil {
+		t.Error("CouchDB 1.x doesn't announce features, got", ok, err)
+	}
+}